@@ -5,8 +5,11 @@ import (
 	httpserver "aumusic/internal/server/http"
 	"aumusic/internal/service"
 	"aumusic/pkg/logger"
-	"aumusic/pkg/minio"
+	"aumusic/pkg/mail"
+	"aumusic/pkg/oidc"
 	"aumusic/pkg/postgres"
+	"aumusic/pkg/storage"
+	"aumusic/pkg/transcode"
 
 	"context"
 )
@@ -27,10 +30,22 @@ func main() {
 		panic(err)
 	}
 	
-	service.MinIO, err = minio.New(ctx, cfg.Minio.Endpoint, cfg.Minio.AccessKey, cfg.Minio.SecretKey, cfg.Minio.UseSSL)
+	service.Storage, err = storage.New(ctx, cfg.Storage, cfg.Minio)
 	if err != nil {
 		panic(err)
 	}
+	service.Transcoder = transcode.New(cfg.Transcode)
+	service.Mail, err = mail.New(ctx, cfg.Mail)
+	if err != nil {
+		panic(err)
+	}
+	if cfg.OIDC.Enabled() {
+		service.OIDC = oidc.New(cfg.OIDC, nil)
+	}
+
+	go service.RunUploadJanitor(ctx, cfg.UploadSessionTTL)
+	go service.RunCoverJanitor(ctx)
+	go service.RunSessionJanitor(ctx)
 
 	if err := httpserver.Run(ctx, cfg); err != nil {
 		panic(err)
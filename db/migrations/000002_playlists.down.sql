@@ -0,0 +1,10 @@
+alter table playlist_tracks drop constraint if exists playlist_tracks_track_id_fkey;
+alter table playlist_tracks add constraint playlist_tracks_track_id_fkey
+    foreign key (track_id) references tracks(id);
+
+alter table playlist_tracks drop constraint if exists playlist_tracks_playlist_id_fkey;
+alter table playlist_tracks add constraint playlist_tracks_playlist_id_fkey
+    foreign key (playlist_id) references playlists(id);
+
+alter table playlists drop constraint if exists playlists_user_id_name_key;
+alter table playlists add constraint playlists_name_key unique (name);
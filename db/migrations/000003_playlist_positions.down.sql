@@ -0,0 +1,2 @@
+alter table playlist_tracks drop constraint if exists playlist_tracks_playlist_id_position_key;
+alter table playlist_tracks drop column if exists position;
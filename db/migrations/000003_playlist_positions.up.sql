@@ -0,0 +1,15 @@
+alter table playlist_tracks add column if not exists position int;
+
+update playlist_tracks pt
+set position = n.rn - 1
+from (
+    select id, row_number() over (partition by playlist_id order by id) as rn
+    from playlist_tracks
+) n
+where pt.id = n.id;
+
+alter table playlist_tracks alter column position set not null;
+
+-- Проверка откладывается до коммита, чтобы можно было сдвигать позиции в одной транзакции
+alter table playlist_tracks add constraint playlist_tracks_playlist_id_position_key
+    unique (playlist_id, position) deferrable initially deferred;
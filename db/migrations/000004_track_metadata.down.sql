@@ -0,0 +1,6 @@
+alter table tracks drop column if exists duration;
+alter table tracks drop column if exists genre;
+alter table tracks drop column if exists year;
+alter table tracks drop column if exists disc_number;
+alter table tracks drop column if exists track_number;
+alter table tracks drop column if exists album_artist;
@@ -0,0 +1,6 @@
+alter table tracks add column if not exists album_artist text not null default '';
+alter table tracks add column if not exists track_number int not null default 0;
+alter table tracks add column if not exists disc_number int not null default 0;
+alter table tracks add column if not exists year int not null default 0;
+alter table tracks add column if not exists genre text not null default '';
+alter table tracks add column if not exists duration double precision not null default 0;
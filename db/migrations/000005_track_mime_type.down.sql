@@ -0,0 +1 @@
+alter table tracks drop column if exists mime_type;
@@ -0,0 +1 @@
+alter table tracks add column if not exists mime_type text not null default 'audio/mpeg';
@@ -0,0 +1,13 @@
+create table if not exists upload_sessions (
+    id uuid primary key unique not null default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    filename text not null,
+    size bigint not null,
+    received bigint not null default 0,
+    artist text not null default '',
+    album text not null default '',
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now()
+);
+
+create index if not exists upload_sessions_updated_at_idx on upload_sessions (updated_at);
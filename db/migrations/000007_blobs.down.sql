@@ -0,0 +1,3 @@
+drop index if exists tracks_user_id_hash_key;
+alter table tracks drop column if exists hash;
+drop table if exists blobs;
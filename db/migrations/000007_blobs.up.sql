@@ -0,0 +1,12 @@
+create table if not exists blobs (
+    hash text primary key not null,
+    path text not null,
+    size bigint not null,
+    mime_type text not null,
+    refcount int not null default 0,
+    created_at timestamp not null default now()
+);
+
+alter table tracks add column if not exists hash text references blobs(hash);
+
+create unique index if not exists tracks_user_id_hash_key on tracks (user_id, hash) where hash is not null;
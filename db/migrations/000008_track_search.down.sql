@@ -0,0 +1,3 @@
+drop index if exists tracks_search_trgm_idx;
+drop index if exists tracks_search_idx;
+alter table tracks drop column if exists search;
@@ -0,0 +1,11 @@
+create extension if not exists pg_trgm;
+
+-- Словарь simple не зависит от языка: названия бывают и на русском, и на английском
+alter table tracks add column if not exists search tsvector generated always as (
+    setweight(to_tsvector('simple', name), 'A') ||
+    setweight(to_tsvector('simple', artist), 'B') ||
+    setweight(to_tsvector('simple', album), 'C')
+) stored;
+
+create index if not exists tracks_search_idx on tracks using gin (search);
+create index if not exists tracks_search_trgm_idx on tracks using gin ((name || ' ' || artist || ' ' || album) gin_trgm_ops);
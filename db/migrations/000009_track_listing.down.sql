@@ -0,0 +1,5 @@
+drop index if exists tracks_user_id_size_idx;
+drop index if exists tracks_user_id_album_idx;
+drop index if exists tracks_user_id_artist_idx;
+drop index if exists tracks_user_id_name_idx;
+drop index if exists tracks_user_id_mod_time_idx;
@@ -0,0 +1,6 @@
+-- Индексы под keyset-пагинацию: каждый повторяет ORDER BY одной из сортировок списка треков
+create index if not exists tracks_user_id_mod_time_idx on tracks (user_id, mod_time, id);
+create index if not exists tracks_user_id_name_idx on tracks (user_id, name, id);
+create index if not exists tracks_user_id_artist_idx on tracks (user_id, artist, album, disc_number, track_number, id);
+create index if not exists tracks_user_id_album_idx on tracks (user_id, album, disc_number, track_number, id);
+create index if not exists tracks_user_id_size_idx on tracks (user_id, size, id);
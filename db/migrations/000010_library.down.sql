@@ -0,0 +1,6 @@
+drop index if exists tracks_album_id_idx;
+drop index if exists tracks_artist_id_idx;
+alter table tracks drop column if exists album_id;
+alter table tracks drop column if exists artist_id;
+drop table if exists albums;
+drop table if exists artists;
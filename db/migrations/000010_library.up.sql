@@ -0,0 +1,47 @@
+create table if not exists artists (
+    id uuid primary key not null default gen_random_uuid(),
+    user_id uuid not null references users(id),
+    name text not null,
+    unique (user_id, name)
+);
+
+-- Альбом принадлежит исполнителю альбома: album_artist трека, а если он не указан — artist
+create table if not exists albums (
+    id uuid primary key not null default gen_random_uuid(),
+    user_id uuid not null references users(id),
+    artist_id uuid not null references artists(id),
+    name text not null,
+    unique (user_id, artist_id, name)
+);
+
+create index if not exists albums_artist_id_idx on albums (artist_id);
+
+alter table tracks add column if not exists artist_id uuid references artists(id);
+alter table tracks add column if not exists album_id uuid references albums(id);
+
+insert into artists (user_id, name)
+select user_id, artist from tracks
+union
+select user_id, coalesce(nullif(album_artist, ''), artist) from tracks
+on conflict do nothing;
+
+insert into albums (user_id, artist_id, name)
+select distinct t.user_id, a.id, t.album
+from tracks t
+join artists a on a.user_id = t.user_id and a.name = coalesce(nullif(t.album_artist, ''), t.artist)
+on conflict do nothing;
+
+update tracks t set artist_id = a.id
+from artists a
+where a.user_id = t.user_id and a.name = t.artist;
+
+update tracks t set album_id = al.id
+from albums al
+join artists a on a.id = al.artist_id
+where al.user_id = t.user_id and al.name = t.album and a.name = coalesce(nullif(t.album_artist, ''), t.artist);
+
+alter table tracks alter column artist_id set not null;
+alter table tracks alter column album_id set not null;
+
+create index if not exists tracks_artist_id_idx on tracks (artist_id);
+create index if not exists tracks_album_id_idx on tracks (album_id, disc_number, track_number);
@@ -0,0 +1,2 @@
+drop index if exists albums_cover_hash_idx;
+alter table albums drop column if exists cover_hash;
@@ -0,0 +1,4 @@
+-- SHA-256 исходного изображения; файлы обложки лежат в хранилище под covers/<hash>/
+alter table albums add column if not exists cover_hash text;
+
+create index if not exists albums_cover_hash_idx on albums (cover_hash) where cover_hash is not null;
@@ -0,0 +1,15 @@
+-- Сессия входа: refresh-токен хранится только в виде SHA-256. previous_hash — хэш
+-- предыдущего токена после ротации; его повторное предъявление означает кражу токена.
+create table if not exists sessions (
+    id uuid primary key not null default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    refresh_hash text not null,
+    previous_hash text not null default '',
+    created_at timestamptz not null default now(),
+    rotated_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    revoked_at timestamptz
+);
+
+create index if not exists sessions_user_id_idx on sessions (user_id) where revoked_at is null;
+create index if not exists sessions_expires_at_idx on sessions (expires_at);
@@ -0,0 +1,15 @@
+-- Персональный API-ключ для скриптов. Сам ключ не хранится, только его SHA-256;
+-- prefix — начало ключа, по которому пользователь узнает его в списке.
+create table if not exists api_keys (
+    id uuid primary key not null default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    name text not null,
+    prefix text not null,
+    key_hash text not null unique,
+    scopes text[] not null,
+    created_at timestamptz not null default now(),
+    expires_at timestamptz,
+    last_used_at timestamptz
+);
+
+create index if not exists api_keys_user_id_idx on api_keys (user_id);
@@ -0,0 +1,12 @@
+-- Учетная запись у внешнего провайдера OpenID Connect, через которую пользователь входит.
+-- issuer и subject вместе однозначно определяют человека у провайдера.
+create table if not exists user_identities (
+    issuer text not null,
+    subject text not null,
+    user_id uuid not null references users(id) on delete cascade,
+    email text not null default '',
+    created_at timestamptz not null default now(),
+    primary key (issuer, subject)
+);
+
+create index if not exists user_identities_user_id_idx on user_identities (user_id);
@@ -0,0 +1,2 @@
+drop table if exists recovery_codes;
+drop table if exists user_totp;
@@ -0,0 +1,21 @@
+-- Второй фактор входа по TOTP. Пока enabled_at пуст, секрет выдан, но первый код еще не подтвержден.
+-- last_step — последний принятый интервал TOTP: коды не новее него повторно не принимаются.
+create table if not exists user_totp (
+    user_id uuid primary key not null references users(id) on delete cascade,
+    secret text not null,
+    enabled_at timestamptz,
+    last_step bigint not null default 0,
+    failed_attempts int not null default 0,
+    locked_until timestamptz,
+    created_at timestamptz not null default now()
+);
+
+-- Одноразовые коды восстановления; хранится только SHA-256 кода
+create table if not exists recovery_codes (
+    id uuid primary key not null default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    code_hash text not null,
+    used_at timestamptz
+);
+
+create index if not exists recovery_codes_user_id_idx on recovery_codes (user_id);
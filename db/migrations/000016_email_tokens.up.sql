@@ -0,0 +1,17 @@
+alter table users add column if not exists email_verified_at timestamptz;
+
+-- Одноразовые токены из писем: подтверждение email (purpose = 'verify') и сброс пароля ('reset').
+-- Хранится только SHA-256 токена; email — адрес, на который ушло письмо.
+create table if not exists email_tokens (
+    id uuid primary key not null default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    purpose text not null,
+    token_hash text not null unique,
+    email text not null,
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    used_at timestamptz
+);
+
+create index if not exists email_tokens_user_id_idx on email_tokens (user_id, purpose, created_at);
+create index if not exists email_tokens_expires_at_idx on email_tokens (expires_at);
@@ -0,0 +1,2 @@
+-- finishing выставляет FinishUpload, чтобы одну загрузку не собирали два запроса сразу
+alter table upload_sessions add column if not exists finishing boolean not null default false;
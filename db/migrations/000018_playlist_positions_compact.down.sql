@@ -0,0 +1 @@
+-- Прежние пропуски в позициях не восстанавливаются
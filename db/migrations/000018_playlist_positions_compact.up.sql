@@ -0,0 +1,8 @@
+-- Удаление трека оставляло пропуски в позициях плейлистов: нумеруем записи заново
+update playlist_tracks pt
+set position = n.rn - 1
+from (
+    select id, row_number() over (partition by playlist_id order by position) as rn
+    from playlist_tracks
+) n
+where pt.id = n.id and pt.position <> n.rn - 1;
@@ -1,18 +1,34 @@
 package config
 
 import (
+	"aumusic/pkg/mail"
 	"aumusic/pkg/minio"
+	"aumusic/pkg/oidc"
 	"aumusic/pkg/postgres"
+	"aumusic/pkg/storage"
+	"aumusic/pkg/transcode"
+
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Postgres postgres.Config `yaml:"POSTGRES" env:"POSTGRES"`
-	Minio    minio.Config    `yaml:"MINIO" env:"MINIO"`
+	Postgres  postgres.Config  `yaml:"POSTGRES" env:"POSTGRES"`
+	Minio     minio.Config     `yaml:"MINIO" env:"MINIO"`
+	Storage   storage.Config   `yaml:"STORAGE" env:"STORAGE"`
+	Transcode transcode.Config `yaml:"TRANSCODE" env:"TRANSCODE"`
+	OIDC      oidc.Config      `yaml:"OIDC" env:"OIDC"`
+	Mail      mail.Config      `yaml:"MAIL" env:"MAIL"`
+
+	Port             string        `yaml:"APP_PORT" env:"APP_PORT" env-default:"8081"`
+	JWTSecret        string        `yaml:"JWT_SECRET" env:"JWT_SECRET" env-default:"secret"`
+	UploadSessionTTL time.Duration `yaml:"UPLOAD_SESSION_TTL" env:"UPLOAD_SESSION_TTL" env-default:"24h"`
+	AccessTokenTTL   time.Duration `yaml:"ACCESS_TOKEN_TTL" env:"ACCESS_TOKEN_TTL" env-default:"15m"`
+	RefreshTokenTTL  time.Duration `yaml:"REFRESH_TOKEN_TTL" env:"REFRESH_TOKEN_TTL" env-default:"720h"`
 
-	Port      string `yaml:"APP_PORT" env:"APP_PORT" env-default:"8081"`
-	JWTSecret string `yaml:"JWT_SECRET" env:"JWT_SECRET" env-default:"secret"`
+	// BaseURL — внешний адрес приложения, от которого строятся ссылки в письмах
+	BaseURL string `yaml:"APP_BASE_URL" env:"APP_BASE_URL" env-default:"http://localhost:8081"`
 }
 
 func New() (*Config, error) {
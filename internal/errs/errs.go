@@ -0,0 +1,82 @@
+// Package errs описывает доменные ошибки, общие для repo, service и HTTP-слоя.
+// Каждая ошибка относится к одному из видов (ErrNotFound, ErrForbidden, ...) и может
+// хранить исходную причину; errors.Is проверяет и вид, и причину.
+package errs
+
+import "errors"
+
+// Виды ошибок. HTTP-слой переводит их в коды ответа.
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrForbidden       = errors.New("forbidden")
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrConflict        = errors.New("conflict")
+	ErrValidation      = errors.New("validation failed")
+)
+
+// Error — доменная ошибка вида Kind с сообщением для клиента и необязательной причиной
+type Error struct {
+	Kind  error
+	Msg   string
+	Cause error
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = e.Kind.Error()
+	}
+	if e.Cause != nil {
+		return msg + ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Cause}
+}
+
+// New создает ошибку вида kind без причины; подходит для объявления сентинелов пакета
+func New(kind error, msg string) error {
+	return &Error{Kind: kind, Msg: msg}
+}
+
+// Wrap создает ошибку вида kind с причиной cause
+func Wrap(kind error, msg string, cause error) error {
+	return &Error{Kind: kind, Msg: msg, Cause: cause}
+}
+
+func NotFound(msg string, cause error) error {
+	return Wrap(ErrNotFound, msg, cause)
+}
+
+func Forbidden(msg string) error {
+	return New(ErrForbidden, msg)
+}
+
+func Unauthenticated(cause error) error {
+	return Wrap(ErrUnauthenticated, "missing or invalid token", cause)
+}
+
+func Conflict(msg string, cause error) error {
+	return Wrap(ErrConflict, msg, cause)
+}
+
+func Validation(msg string) error {
+	return New(ErrValidation, msg)
+}
+
+// Message возвращает сообщение для клиента без технической причины
+func Message(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Msg != "" {
+			return e.Msg
+		}
+		return e.Kind.Error()
+	}
+	return err.Error()
+}
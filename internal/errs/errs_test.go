@@ -0,0 +1,43 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKindAndCause(t *testing.T) {
+	cause := errors.New("no rows in result set")
+	err := fmt.Errorf("get track: %w", NotFound("track not found", cause))
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatal("ожидался вид ErrNotFound")
+	}
+	if !errors.Is(err, cause) {
+		t.Fatal("причина потерялась")
+	}
+	if errors.Is(err, ErrForbidden) {
+		t.Fatal("ошибка не должна быть ErrForbidden")
+	}
+	if got := err.Error(); got != "get track: track not found: no rows in result set" {
+		t.Fatalf("текст ошибки %q", got)
+	}
+	if got := Message(err); got != "track not found" {
+		t.Fatalf("сообщение %q", got)
+	}
+}
+
+func TestSentinel(t *testing.T) {
+	errDuplicate := New(ErrConflict, "track already exists")
+	err := fmt.Errorf("store: %w", errDuplicate)
+
+	if !errors.Is(err, errDuplicate) || !errors.Is(err, ErrConflict) {
+		t.Fatal("обернутая ошибка должна совпадать и с sentinel, и с его видом")
+	}
+	if got := Message(err); got != "track already exists" {
+		t.Fatalf("сообщение %q", got)
+	}
+	if got := Message(&Error{Kind: ErrUnauthenticated}); got != "unauthenticated" {
+		t.Fatalf("сообщение без текста %q, ожидался вид ошибки", got)
+	}
+}
@@ -3,29 +3,131 @@ package models
 import "time"
 
 type Track struct {
-	Id      string    `json:"id"`
-	Name    string    `json:"name"`
-	Artist  string    `json:"artist"`
-	Album   string    `json:"album"`
-	Size    int64     `json:"size"`
-	ModTime time.Time `json:"mod_time"`
+	Id          string    `json:"id"`
+	Name        string    `json:"name"`
+	Artist      string    `json:"artist"`
+	Album       string    `json:"album"`
+	ArtistId    string    `json:"artist_id"`
+	AlbumId     string    `json:"album_id"`
+	AlbumArtist string    `json:"album_artist"`
+	TrackNumber int       `json:"track_number"`
+	DiscNumber  int       `json:"disc_number"`
+	Year        int       `json:"year"`
+	Genre       string    `json:"genre"`
+	Duration    float64   `json:"duration"`
+	MimeType    string    `json:"mime_type"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// Artist — исполнитель из библиотеки пользователя со сводкой по его трекам.
+// AlbumCount считает альбомы, где он указан исполнителем альбома.
+type Artist struct {
+	Id         string  `json:"id"`
+	UserId     string  `json:"-"`
+	Name       string  `json:"name"`
+	AlbumCount int     `json:"album_count"`
+	TrackCount int     `json:"track_count"`
+	Duration   float64 `json:"duration"`
+	Size       int64   `json:"size"`
+}
+
+// Album — альбом из библиотеки пользователя со сводкой по его трекам; Year — наибольший год среди треков.
+// CoverId — идентификатор обложки для /covers/{id}, пустой, если обложки нет.
+type Album struct {
+	Id         string  `json:"id"`
+	UserId     string  `json:"-"`
+	Name       string  `json:"name"`
+	ArtistId   string  `json:"artist_id"`
+	Artist     string  `json:"artist"`
+	Year       int     `json:"year"`
+	TrackCount int     `json:"track_count"`
+	Duration   float64 `json:"duration"`
+	Size       int64   `json:"size"`
+	CoverId    string  `json:"cover_id,omitempty"`
+}
+
+// Поля сортировки списка треков
+const (
+	TrackSortAdded  = "added"
+	TrackSortTitle  = "title"
+	TrackSortArtist = "artist"
+	TrackSortAlbum  = "album"
+	TrackSortSize   = "size"
+)
+
+// TrackQuery — выборка страницы треков пользователя. Пустые фильтры не применяются,
+// нулевые From и To не ограничивают дату добавления. After — последний трек предыдущей страницы.
+type TrackQuery struct {
+	UserId   string
+	Sort     string
+	Desc     bool
+	Artist   string
+	Album    string
+	MimeType string
+	From     time.Time
+	To       time.Time
+	After    *Track
+	Limit    int
+}
+
+// TrackPage — страница списка треков. Total учитывает фильтры, но не курсор;
+// NextCursor пуст на последней странице.
+type TrackPage struct {
+	Tracks     []Track `json:"tracks"`
+	Total      int     `json:"total"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
 
 type TrackDB struct {
-	Id      string
-	UserId  string
-	Name    string
-	Artist  string
-	Album   string
-	Size    int64
-	Path    string
-	ModTime time.Time
+	Id          string
+	UserId      string
+	Name        string
+	Artist      string
+	Album       string
+	ArtistId    string
+	AlbumId     string
+	AlbumArtist string
+	TrackNumber int
+	DiscNumber  int
+	Year        int
+	Genre       string
+	Duration    float64
+	MimeType    string
+	Size        int64
+	Path        string
+	Hash        string
+	ModTime     time.Time
+}
+
+// Blob — содержимое аудиофайла в хранилище, общее для всех треков с тем же SHA-256
+type Blob struct {
+	Hash     string
+	Path     string
+	Size     int64
+	MimeType string
+	Refcount int
+}
+
+// UploadResult — итог загрузки одного файла: ok, rejected, duplicate, error или cover
+type UploadResult struct {
+	File   string `json:"file"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Track  *Track `json:"track,omitempty"`
 }
 
 type Playlist struct {
-	Id     string `json:"id"`
-	UserId string `json:"user_id"`
-	Name   string `json:"name"`
+	Id      string          `json:"id"`
+	UserId  string          `json:"user_id"`
+	Name    string          `json:"name"`
+	Entries []PlaylistEntry `json:"entries,omitempty"`
+}
+
+type PlaylistEntry struct {
+	Id       string `json:"id"`
+	Position int    `json:"position"`
+	Track    Track  `json:"track"`
 }
 
 type User struct {
@@ -34,3 +136,65 @@ type User struct {
 	Pass     string `json:"pass"`
 	Email    string `json:"email"`
 }
+
+// Session — сессия входа пользователя. Access-токены сессии действительны, пока она не отозвана
+// и не истекла; RefreshHash и PreviousHash — SHA-256 текущего и предыдущего refresh-токена.
+type Session struct {
+	Id           string
+	UserId       string
+	RefreshHash  string
+	PreviousHash string
+	CreatedAt    time.Time
+	RotatedAt    time.Time
+	ExpiresAt    time.Time
+	RevokedAt    *time.Time
+}
+
+// APIKey — персональный ключ для скриптов. Запрос с ключом разрешен, только если
+// его действие входит в Scopes; ExpiresAt == nil означает бессрочный ключ.
+type APIKey struct {
+	Id         string     `json:"id"`
+	UserId     string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// TOTP — второй фактор входа пользователя. EnabledAt == nil, пока первый код не подтвержден.
+type TOTP struct {
+	UserId         string
+	Secret         string
+	EnabledAt      *time.Time
+	LastStep       int64
+	FailedAttempts int
+	LockedUntil    *time.Time
+}
+
+// EmailToken — одноразовая ссылка из письма. Email — адрес, на который ушло письмо:
+// подтверждение действует, только пока у пользователя тот же адрес.
+type EmailToken struct {
+	Id        string
+	UserId    string
+	Purpose   string
+	TokenHash string
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type UploadSession struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"user_id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Artist    string    `json:"artist"`
+	Album     string    `json:"album"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func CreateAPIKey(ctx context.Context, pool *pgxpool.Pool, key models.APIKey) (models.APIKey, error) {
+	sql := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+	err := pool.QueryRow(ctx, sql, key.UserId, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.ExpiresAt).Scan(
+		&key.Id,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return models.APIKey{}, wrapErr(err, "api key")
+	}
+	return key, nil
+}
+
+func GetAPIKeys(ctx context.Context, pool *pgxpool.Pool, userId string) ([]models.APIKey, error) {
+	sql := `SELECT id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at
+		FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := pool.Query(ctx, sql, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		err := rows.Scan(&key.Id, &key.UserId, &key.Name, &key.Prefix, &key.Scopes, &key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey удаляет ключ пользователя; чужой ключ неотличим от несуществующего
+func DeleteAPIKey(ctx context.Context, pool *pgxpool.Pool, userId, keyId string) error {
+	sql := "DELETE FROM api_keys WHERE id = $1 AND user_id = $2"
+	tag, err := pool.Exec(ctx, sql, keyId, userId)
+	if err != nil {
+		return wrapErr(err, "api key")
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.NotFound("api key not found", nil)
+	}
+	return nil
+}
+
+// DeleteUserAPIKeys удаляет все ключи пользователя и возвращает, сколько их было
+func DeleteUserAPIKeys(ctx context.Context, db DB, userId string) (int64, error) {
+	tag, err := db.Exec(ctx, "DELETE FROM api_keys WHERE user_id = $1", userId)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// UseAPIKey находит действующий ключ по хэшу, отмечает время использования и возвращает
+// ключ вместе с именем владельца
+func UseAPIKey(ctx context.Context, pool *pgxpool.Pool, keyHash string) (models.APIKey, string, error) {
+	sql := `UPDATE api_keys k SET last_used_at = now()
+		FROM users u
+		WHERE k.key_hash = $1 AND u.id = k.user_id AND (k.expires_at IS NULL OR k.expires_at > now())
+		RETURNING k.id, k.user_id, k.name, k.prefix, k.scopes, k.created_at, k.expires_at, k.last_used_at, u.username`
+	var key models.APIKey
+	var username string
+	err := pool.QueryRow(ctx, sql, keyHash).Scan(
+		&key.Id,
+		&key.UserId,
+		&key.Name,
+		&key.Prefix,
+		&key.Scopes,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&username,
+	)
+	if err != nil {
+		return models.APIKey{}, "", wrapErr(err, "api key")
+	}
+	return key, username, nil
+}
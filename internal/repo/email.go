@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func CreateEmailToken(ctx context.Context, pool *pgxpool.Pool, token models.EmailToken) error {
+	sql := "INSERT INTO email_tokens (user_id, purpose, token_hash, email, expires_at) VALUES ($1, $2, $3, $4, $5)"
+	_, err := pool.Exec(ctx, sql, token.UserId, token.Purpose, token.TokenHash, token.Email, token.ExpiresAt)
+	return wrapErr(err, "email token")
+}
+
+// CountEmailTokens возвращает, сколько писем с назначением purpose пользователь получил после since
+func CountEmailTokens(ctx context.Context, pool *pgxpool.Pool, userId, purpose string, since time.Time) (int, error) {
+	sql := "SELECT count(*) FROM email_tokens WHERE user_id = $1 AND purpose = $2 AND created_at > $3"
+	var n int
+	err := pool.QueryRow(ctx, sql, userId, purpose, since).Scan(&n)
+	return n, err
+}
+
+// UseEmailToken гасит действующий токен: одним запросом, чтобы его нельзя было применить дважды.
+// Неизвестный, истекший или уже использованный токен — errs.ErrNotFound.
+func UseEmailToken(ctx context.Context, db DB, purpose, tokenHash string) (models.EmailToken, error) {
+	sql := `UPDATE email_tokens SET used_at = now()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+		RETURNING id, user_id, purpose, token_hash, email, created_at, expires_at, used_at`
+	var token models.EmailToken
+	err := db.QueryRow(ctx, sql, tokenHash, purpose).Scan(
+		&token.Id,
+		&token.UserId,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.Email,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.UsedAt,
+	)
+	if err != nil {
+		return models.EmailToken{}, wrapErr(err, "email token")
+	}
+	return token, nil
+}
+
+// DeleteEmailTokens удаляет еще не использованные токены пользователя с назначением purpose
+func DeleteEmailTokens(ctx context.Context, db DB, userId, purpose string) error {
+	sql := "DELETE FROM email_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL"
+	_, err := db.Exec(ctx, sql, userId, purpose)
+	return err
+}
+
+// DeleteStaleEmailTokens удаляет токены, истекшие раньше before
+func DeleteStaleEmailTokens(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int64, error) {
+	tag, err := pool.Exec(ctx, "DELETE FROM email_tokens WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SetEmailVerified отмечает email пользователя подтвержденным, если у него все еще адрес email.
+// false — адрес с тех пор сменился.
+func SetEmailVerified(ctx context.Context, db DB, userId, email string) (bool, error) {
+	sql := `UPDATE users SET email_verified_at = coalesce(email_verified_at, now())
+		WHERE id = $1 AND lower(email) = lower($2)`
+	tag, err := db.Exec(ctx, sql, userId, email)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func EmailVerified(ctx context.Context, db DB, userId string) (bool, error) {
+	sql := "SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1"
+	var verified bool
+	err := db.QueryRow(ctx, sql, userId).Scan(&verified)
+	if err != nil {
+		return false, wrapErr(err, "user")
+	}
+	return verified, nil
+}
+
+func UpdatePassword(ctx context.Context, db DB, userId, passHash string) error {
+	tag, err := db.Exec(ctx, "UPDATE users SET password = $2 WHERE id = $1", userId, passHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.NotFound("user not found", nil)
+	}
+	return nil
+}
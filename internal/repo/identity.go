@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"aumusic/internal/models"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetUserByIdentity находит пользователя по учетной записи у провайдера OpenID Connect
+func GetUserByIdentity(ctx context.Context, db DB, issuer, subject string) (models.User, error) {
+	sql := `SELECT u.id, u.username, u.password, u.email
+		FROM user_identities i JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2`
+	var user models.User
+	err := db.QueryRow(ctx, sql, issuer, subject).Scan(&user.Id, &user.Username, &user.Pass, &user.Email)
+	if err != nil {
+		return models.User{}, wrapErr(err, "user")
+	}
+	return user, nil
+}
+
+// GetUserByEmail ищет пользователя по email без учета регистра
+func GetUserByEmail(ctx context.Context, db DB, email string) (models.User, error) {
+	sql := "SELECT id, username, password, email FROM users WHERE lower(email) = lower($1)"
+	var user models.User
+	err := db.QueryRow(ctx, sql, email).Scan(&user.Id, &user.Username, &user.Pass, &user.Email)
+	if err != nil {
+		return models.User{}, wrapErr(err, "user")
+	}
+	return user, nil
+}
+
+// CreateUserIfFree создает пользователя, если его имя и email свободны. ok == false
+// означает, что одно из них занято; в отличие от ошибки это не прерывает транзакцию.
+func CreateUserIfFree(ctx context.Context, db DB, user models.User) (models.User, bool, error) {
+	sql := `INSERT INTO users (username, password, email) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING RETURNING id`
+	err := db.QueryRow(ctx, sql, user.Username, user.Pass, user.Email).Scan(&user.Id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, false, nil
+	}
+	if err != nil {
+		return models.User{}, false, err
+	}
+	return user, true, nil
+}
+
+func LinkIdentity(ctx context.Context, db DB, userId, issuer, subject, email string) error {
+	sql := "INSERT INTO user_identities (issuer, subject, user_id, email) VALUES ($1, $2, $3, $4)"
+	_, err := db.Exec(ctx, sql, issuer, subject, userId, email)
+	return wrapErr(err, "identity")
+}
@@ -0,0 +1,236 @@
+package repo
+
+import (
+	"aumusic/internal/models"
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// albumArtistName — исполнитель, которому принадлежит альбом трека
+func albumArtistName(artist, albumArtist string) string {
+	if albumArtist != "" {
+		return albumArtist
+	}
+	return artist
+}
+
+// upsertArtist возвращает id исполнителя пользователя с таким именем, создавая его при необходимости.
+// DO UPDATE вместо DO NOTHING нужен, чтобы RETURNING вернул id и существующей строки.
+func upsertArtist(ctx context.Context, db DB, userId, name string) (string, error) {
+	sql := `INSERT INTO artists (user_id, name) VALUES ($1, $2)
+		ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id`
+	var id string
+	err := db.QueryRow(ctx, sql, userId, name).Scan(&id)
+	return id, err
+}
+
+// linkLibrary находит или создает исполнителя трека и альбом и возвращает их id
+func linkLibrary(ctx context.Context, db DB, userId, artist, albumArtist, album string) (string, string, error) {
+	artistId, err := upsertArtist(ctx, db, userId, artist)
+	if err != nil {
+		return "", "", err
+	}
+	albumArtistId := artistId
+	if name := albumArtistName(artist, albumArtist); name != artist {
+		albumArtistId, err = upsertArtist(ctx, db, userId, name)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	sql := `INSERT INTO albums (user_id, artist_id, name) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, artist_id, name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id`
+	var albumId string
+	err = db.QueryRow(ctx, sql, userId, albumArtistId, album).Scan(&albumId)
+	if err != nil {
+		return "", "", err
+	}
+	return artistId, albumId, nil
+}
+
+// pruneLibrary удаляет альбом и исполнителей, на которых больше не ссылается ни один трек или альбом
+func pruneLibrary(ctx context.Context, db DB, artistId, albumId string) error {
+	sql := `DELETE FROM albums al WHERE id = $1
+		AND NOT EXISTS (SELECT 1 FROM tracks WHERE album_id = al.id)
+		RETURNING artist_id`
+	albumArtistId := artistId
+	rows, err := db.Query(ctx, sql, albumId)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		if err := rows.Scan(&albumArtistId); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sql = `DELETE FROM artists a WHERE id = ANY($1)
+		AND NOT EXISTS (SELECT 1 FROM tracks WHERE artist_id = a.id)
+		AND NOT EXISTS (SELECT 1 FROM albums WHERE artist_id = a.id)`
+	_, err = db.Exec(ctx, sql, []string{artistId, albumArtistId})
+	return err
+}
+
+const artistSelect = `SELECT a.id, a.user_id, a.name,
+		(SELECT count(*) FROM albums al WHERE al.artist_id = a.id),
+		count(t.id), COALESCE(sum(t.duration), 0), COALESCE(sum(t.size), 0)
+	FROM artists a
+	LEFT JOIN tracks t ON t.artist_id = a.id`
+
+func scanArtist(row interface{ Scan(...any) error }) (models.Artist, error) {
+	var artist models.Artist
+	err := row.Scan(&artist.Id, &artist.UserId, &artist.Name, &artist.AlbumCount, &artist.TrackCount, &artist.Duration, &artist.Size)
+	return artist, err
+}
+
+// GetArtists возвращает исполнителей пользователя по алфавиту. Исполнители, у которых
+// есть только альбомы (album_artist сборников), тоже попадают в список.
+func GetArtists(ctx context.Context, pool *pgxpool.Pool, userId string) ([]models.Artist, error) {
+	sql := artistSelect + ` WHERE a.user_id = $1 GROUP BY a.id ORDER BY a.name, a.id`
+	rows, err := pool.Query(ctx, sql, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var artists []models.Artist
+	for rows.Next() {
+		artist, err := scanArtist(rows)
+		if err != nil {
+			return nil, err
+		}
+		artists = append(artists, artist)
+	}
+	return artists, rows.Err()
+}
+
+func GetArtist(ctx context.Context, pool *pgxpool.Pool, artistId string) (models.Artist, error) {
+	artist, err := scanArtist(pool.QueryRow(ctx, artistSelect+` WHERE a.id = $1 GROUP BY a.id`, artistId))
+	if err != nil {
+		return models.Artist{}, wrapErr(err, "artist")
+	}
+	return artist, nil
+}
+
+const albumSelect = `SELECT al.id, al.user_id, al.name, al.artist_id, a.name,
+		COALESCE(max(t.year), 0), count(t.id), COALESCE(sum(t.duration), 0), COALESCE(sum(t.size), 0),
+		COALESCE(al.cover_hash, '')
+	FROM albums al
+	JOIN artists a ON a.id = al.artist_id
+	LEFT JOIN tracks t ON t.album_id = al.id`
+
+func scanAlbum(row interface{ Scan(...any) error }) (models.Album, error) {
+	var album models.Album
+	err := row.Scan(&album.Id, &album.UserId, &album.Name, &album.ArtistId, &album.Artist,
+		&album.Year, &album.TrackCount, &album.Duration, &album.Size, &album.CoverId)
+	return album, err
+}
+
+// GetAlbums возвращает альбомы пользователя, отсортированные по исполнителю и названию.
+// Непустой artistId оставляет только альбомы этого исполнителя.
+func GetAlbums(ctx context.Context, pool *pgxpool.Pool, userId, artistId string) ([]models.Album, error) {
+	sql := albumSelect + ` WHERE al.user_id = $1 AND ($2 = '' OR al.artist_id::text = $2)
+		GROUP BY al.id, a.name ORDER BY a.name, al.name, al.id`
+	rows, err := pool.Query(ctx, sql, userId, artistId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var albums []models.Album
+	for rows.Next() {
+		album, err := scanAlbum(rows)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, rows.Err()
+}
+
+func GetAlbum(ctx context.Context, pool *pgxpool.Pool, albumId string) (models.Album, error) {
+	album, err := scanAlbum(pool.QueryRow(ctx, albumSelect+` WHERE al.id = $1 GROUP BY al.id, a.name`, albumId))
+	if err != nil {
+		return models.Album{}, wrapErr(err, "album")
+	}
+	return album, nil
+}
+
+// GetAlbumTracks возвращает треки альбома в порядке диска и номера трека
+func GetAlbumTracks(ctx context.Context, pool *pgxpool.Pool, albumId string) ([]models.Track, error) {
+	sql := `SELECT ` + trackColumns("") + ` FROM tracks WHERE album_id = $1
+		ORDER BY disc_number, track_number, name, id`
+	rows, err := pool.Query(ctx, sql, albumId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tracks []models.Track
+	for rows.Next() {
+		var track models.Track
+		if err := rows.Scan(trackFields(&track)...); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, rows.Err()
+}
+
+// RenameArtist переименовывает исполнителя и обновляет имя во всех его треках,
+// в том числе в album_artist треков его альбомов
+func RenameArtist(ctx context.Context, db DB, artistId, name string) error {
+	var oldName string
+	err := db.QueryRow(ctx, "SELECT name FROM artists WHERE id = $1 FOR UPDATE", artistId).Scan(&oldName)
+	if err != nil {
+		return wrapErr(err, "artist")
+	}
+	if _, err = db.Exec(ctx, "UPDATE artists SET name = $2 WHERE id = $1", artistId, name); err != nil {
+		return wrapErr(err, "artist")
+	}
+	if _, err = db.Exec(ctx, "UPDATE tracks SET artist = $2 WHERE artist_id = $1", artistId, name); err != nil {
+		return err
+	}
+	sql := `UPDATE tracks SET album_artist = $3
+		WHERE album_artist = $2 AND album_id IN (SELECT id FROM albums WHERE artist_id = $1)`
+	_, err = db.Exec(ctx, sql, artistId, oldName, name)
+	return err
+}
+
+// RenameAlbum переименовывает альбом и обновляет название во всех его треках
+func RenameAlbum(ctx context.Context, db DB, albumId, name string) error {
+	if _, err := db.Exec(ctx, "UPDATE albums SET name = $2 WHERE id = $1", albumId, name); err != nil {
+		return wrapErr(err, "album")
+	}
+	_, err := db.Exec(ctx, "UPDATE tracks SET album = $2 WHERE album_id = $1", albumId, name)
+	return err
+}
+
+// SetAlbumCover назначает альбому обложку; пустой hash убирает ее
+func SetAlbumCover(ctx context.Context, pool *pgxpool.Pool, albumId, hash string) error {
+	_, err := pool.Exec(ctx, "UPDATE albums SET cover_hash = NULLIF($2, '') WHERE id = $1", albumId, hash)
+	return wrapErr(err, "album")
+}
+
+// GetAlbumCover возвращает хэш обложки альбома или пустую строку, если ее нет
+func GetAlbumCover(ctx context.Context, pool *pgxpool.Pool, albumId string) (string, error) {
+	var hash string
+	err := pool.QueryRow(ctx, "SELECT COALESCE(cover_hash, '') FROM albums WHERE id = $1", albumId).Scan(&hash)
+	if err != nil {
+		return "", wrapErr(err, "album")
+	}
+	return hash, nil
+}
+
+// HasCover сообщает, есть ли обложка hash у альбомов пользователя; пустой userId проверяет все альбомы
+func HasCover(ctx context.Context, pool *pgxpool.Pool, userId, hash string) (bool, error) {
+	sql := "SELECT EXISTS (SELECT 1 FROM albums WHERE cover_hash = $2 AND ($1 = '' OR user_id::text = $1))"
+	var exists bool
+	err := pool.QueryRow(ctx, sql, userId, hash).Scan(&exists)
+	return exists, err
+}
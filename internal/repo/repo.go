@@ -1,125 +1,770 @@
 package repo
 
 import (
+	"aumusic/internal/errs"
 	"aumusic/internal/models"
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func AddTrack(ctx context.Context, pool *pgxpool.Pool, track models.TrackDB) error {
-	sql := "INSERT INTO tracks (user_id, name, artist, album, size, mod_time, path) VALUES ($1, $2, $3, $4, $5, $6, $7)"
-	_, err := pool.Exec(ctx, sql, track.UserId, track.Name, track.Artist, track.Album, track.Size, track.ModTime, track.Path)
+// DB — общие методы *pgxpool.Pool и pgx.Tx, чтобы функции репозитория можно было вызывать внутри транзакции
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// wrapErr переводит ошибки pgx в доменные: отсутствие строки и некорректный id — в errs.ErrNotFound,
+// нарушение уникальности — в errs.ErrConflict. Остальные ошибки возвращаются как есть.
+func wrapErr(err error, what string) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return errs.NotFound(what+" not found", err)
+	case errors.As(err, &pgErr) && pgErr.Code == "22P02":
+		return errs.NotFound(what+" not found", err)
+	case errors.As(err, &pgErr) && pgErr.Code == "23505":
+		return errs.Conflict(what+" already exists", err)
+	}
+	return err
+}
+
+// trackColumns перечисляет столбцы в порядке trackFields; alias задает префикс таблицы в JOIN
+func trackColumns(alias string) string {
+	if alias != "" {
+		alias += "."
+	}
+	columns := []string{"id", "name", "artist", "album", "artist_id", "album_id", "album_artist", "track_number", "disc_number", "year", "genre", "duration", "mime_type", "size", "mod_time"}
+	for i := range columns {
+		columns[i] = alias + columns[i]
+	}
+	return strings.Join(columns, ", ")
+}
+
+// trackFields возвращает указатели на поля трека в порядке trackColumns
+func trackFields(track *models.Track) []any {
+	return []any{
+		&track.Id,
+		&track.Name,
+		&track.Artist,
+		&track.Album,
+		&track.ArtistId,
+		&track.AlbumId,
+		&track.AlbumArtist,
+		&track.TrackNumber,
+		&track.DiscNumber,
+		&track.Year,
+		&track.Genre,
+		&track.Duration,
+		&track.MimeType,
+		&track.Size,
+		&track.ModTime,
+	}
+}
+
+// AddTrack добавляет трек и связывает его с исполнителем и альбомом, создавая их при необходимости.
+// Возвращает трек с заполненными Id, ArtistId и AlbumId.
+func AddTrack(ctx context.Context, db DB, track models.TrackDB) (models.TrackDB, error) {
+	var err error
+	track.ArtistId, track.AlbumId, err = linkLibrary(ctx, db, track.UserId, track.Artist, track.AlbumArtist, track.Album)
 	if err != nil {
-		return err
+		return models.TrackDB{}, err
 	}
-	return nil
+
+	sql := `INSERT INTO tracks (user_id, name, artist, album, album_artist, track_number, disc_number, year, genre, duration, mime_type, size, mod_time, path, hash, artist_id, album_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, ''), $16, $17)
+		RETURNING id`
+	err = db.QueryRow(ctx, sql,
+		track.UserId,
+		track.Name,
+		track.Artist,
+		track.Album,
+		track.AlbumArtist,
+		track.TrackNumber,
+		track.DiscNumber,
+		track.Year,
+		track.Genre,
+		track.Duration,
+		track.MimeType,
+		track.Size,
+		track.ModTime,
+		track.Path,
+		track.Hash,
+		track.ArtistId,
+		track.AlbumId,
+	).Scan(&track.Id)
+	if err != nil {
+		return models.TrackDB{}, wrapErr(err, "track")
+	}
+	return track, nil
 }
 
 func GetTrack(ctx context.Context, pool *pgxpool.Pool, trackId string) (models.TrackDB, error) {
-	sql := "SELECT user_id, name, artist, album, size, mod_time, path FROM tracks WHERE id = $1"
+	sql := `SELECT id, user_id, name, artist, album, artist_id, album_id, album_artist, track_number, disc_number, year, genre, duration, mime_type, size, mod_time, path, COALESCE(hash, '')
+		FROM tracks WHERE id = $1`
 	var track models.TrackDB
 	err := pool.QueryRow(ctx, sql, trackId).Scan(
+		&track.Id,
 		&track.UserId,
 		&track.Name,
 		&track.Artist,
 		&track.Album,
+		&track.ArtistId,
+		&track.AlbumId,
+		&track.AlbumArtist,
+		&track.TrackNumber,
+		&track.DiscNumber,
+		&track.Year,
+		&track.Genre,
+		&track.Duration,
+		&track.MimeType,
 		&track.Size,
 		&track.ModTime,
 		&track.Path,
+		&track.Hash,
 	)
 	if err != nil {
-		return models.TrackDB{}, err
+		return models.TrackDB{}, wrapErr(err, "track")
 	}
 	return track, nil
 }
 
 func GetTracksByUser(ctx context.Context, pool *pgxpool.Pool, userId string) ([]models.Track, error) {
-	sql := "SELECT id, name, artist, album, size, mod_time FROM tracks WHERE user_id = $1"
+	sql := "SELECT " + trackColumns("") + " FROM tracks WHERE user_id = $1 ORDER BY mod_time DESC, id DESC"
 	var tracks []models.Track
 	rows, err := pool.Query(ctx, sql, userId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var track models.Track
-		err := rows.Scan(&track.Id, &track.Name, &track.Artist, &track.Album, &track.Size, &track.ModTime)
+		err := rows.Scan(trackFields(&track)...)
 		if err != nil {
 			return nil, err
 		}
 		tracks = append(tracks, track)
 	}
-	return tracks, nil
+	return tracks, rows.Err()
 }
 
-func DeleteTrack(ctx context.Context, pool *pgxpool.Pool, trackId string) error {
-	sql := "DELETE FROM tracks WHERE id = $1"
-	_, err := pool.Exec(ctx, sql, trackId)
+// trackSortKeys — столбцы ORDER BY для каждой сортировки (id добавляется последним) и значения этих
+// столбцов у трека, от которого продолжается выборка
+var trackSortKeys = map[string]struct {
+	columns []string
+	values  func(t *models.Track) []any
+}{
+	models.TrackSortAdded: {[]string{"mod_time"}, func(t *models.Track) []any { return []any{t.ModTime} }},
+	models.TrackSortTitle: {[]string{"name"}, func(t *models.Track) []any { return []any{t.Name} }},
+	models.TrackSortArtist: {[]string{"artist", "album", "disc_number", "track_number"}, func(t *models.Track) []any {
+		return []any{t.Artist, t.Album, t.DiscNumber, t.TrackNumber}
+	}},
+	models.TrackSortAlbum: {[]string{"album", "disc_number", "track_number"}, func(t *models.Track) []any {
+		return []any{t.Album, t.DiscNumber, t.TrackNumber}
+	}},
+	models.TrackSortSize: {[]string{"size"}, func(t *models.Track) []any { return []any{t.Size} }},
+}
+
+// trackFilter собирает условие WHERE по фильтрам запроса без учета курсора
+func trackFilter(q models.TrackQuery) (string, []any) {
+	where := []string{"user_id = $1"}
+	args := []any{q.UserId}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if q.Artist != "" {
+		add("artist = $%d", q.Artist)
+	}
+	if q.Album != "" {
+		add("album = $%d", q.Album)
+	}
+	if q.MimeType != "" {
+		add("mime_type = $%d", q.MimeType)
+	}
+	if !q.From.IsZero() {
+		add("mod_time >= $%d", q.From)
+	}
+	if !q.To.IsZero() {
+		add("mod_time < $%d", q.To)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// ListTracks возвращает до q.Limit треков, следующих за q.After в порядке q.Sort.
+// Продолжение выборки построено на сравнении кортежей, поэтому не зависит от числа пропущенных строк.
+func ListTracks(ctx context.Context, pool *pgxpool.Pool, q models.TrackQuery) ([]models.Track, error) {
+	key, ok := trackSortKeys[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown track sort %q", q.Sort)
+	}
+	columns := append(slices.Clone(key.columns), "id")
+	op, dir := ">", "ASC"
+	if q.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	where, args := trackFilter(q)
+	if q.After != nil {
+		values := append(key.values(q.After), q.After.Id)
+		params := make([]string, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			params[i] = fmt.Sprintf("$%d", len(args))
+		}
+		where += fmt.Sprintf(" AND (%s) %s (%s)", strings.Join(columns, ", "), op, strings.Join(params, ", "))
+	}
+	order := make([]string, len(columns))
+	for i, column := range columns {
+		order[i] = column + " " + dir
+	}
+	args = append(args, q.Limit)
+	sql := fmt.Sprintf("SELECT %s FROM tracks WHERE %s ORDER BY %s LIMIT $%d",
+		trackColumns(""), where, strings.Join(order, ", "), len(args))
+
+	rows, err := pool.Query(ctx, sql, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+	var tracks []models.Track
+	for rows.Next() {
+		var track models.Track
+		if err := rows.Scan(trackFields(&track)...); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, rows.Err()
 }
 
-func CreatePlaylist(ctx context.Context, pool *pgxpool.Pool, playlist models.Playlist) error {
-	sql := "INSERT INTO playlists (user_id, name) VALUES ($1, $2)"
-	_, err := pool.Exec(ctx, sql, playlist.UserId, playlist.Name)
+// CountTracks считает треки, подходящие под фильтры q; сортировка и курсор не учитываются
+func CountTracks(ctx context.Context, pool *pgxpool.Pool, q models.TrackQuery) (int, error) {
+	where, args := trackFilter(q)
+	var total int
+	err := pool.QueryRow(ctx, "SELECT count(*) FROM tracks WHERE "+where, args...).Scan(&total)
+	return total, err
+}
+
+// SearchTracks ищет треки пользователя по названию, артисту и альбому. tsquery — запрос
+// в синтаксисе to_tsquery (например "road:* & rock:*"). При fuzzy в выдачу попадают и треки,
+// похожие на text по триграммам, что помогает при опечатках. Результаты упорядочены по релевантности.
+func SearchTracks(ctx context.Context, pool *pgxpool.Pool, userId, tsquery, text string, fuzzy bool, limit int) ([]models.Track, error) {
+	sql := `SELECT ` + trackColumns("") + ` FROM tracks
+		WHERE user_id = $1 AND (search @@ to_tsquery('simple', $2)
+			OR ($4 AND $3 <% (name || ' ' || artist || ' ' || album)))
+		ORDER BY ts_rank(search, to_tsquery('simple', $2))
+			+ CASE WHEN $4 THEN word_similarity($3, name || ' ' || artist || ' ' || album) ELSE 0 END DESC,
+			name, id
+		LIMIT $5`
+	rows, err := pool.Query(ctx, sql, userId, tsquery, text, fuzzy, limit)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+	var tracks []models.Track
+	for rows.Next() {
+		var track models.Track
+		if err := rows.Scan(trackFields(&track)...); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, rows.Err()
+}
+
+// UpdateTrack сохраняет изменяемые поля трека (метаданные, путь, хэш и размер) и перепривязывает его
+// к исполнителю и альбому по новым именам. Опустевшие прежние альбом и исполнитель удаляются.
+// Вторым значением возвращает хэш и путь, которые были у строки до изменения: строка заблокирована
+// до конца транзакции, поэтому их можно сверить с прочитанными ранее.
+func UpdateTrack(ctx context.Context, db DB, track models.TrackDB) (models.TrackDB, models.TrackDB, error) {
+	var previous models.TrackDB
+	var oldArtistId, oldAlbumId string
+	sql := "SELECT COALESCE(hash, ''), path, artist_id, album_id FROM tracks WHERE id = $1 FOR UPDATE"
+	err := db.QueryRow(ctx, sql, track.Id).Scan(&previous.Hash, &previous.Path, &oldArtistId, &oldAlbumId)
+	if err != nil {
+		return models.TrackDB{}, models.TrackDB{}, wrapErr(err, "track")
+	}
+	track.ArtistId, track.AlbumId, err = linkLibrary(ctx, db, track.UserId, track.Artist, track.AlbumArtist, track.Album)
+	if err != nil {
+		return models.TrackDB{}, models.TrackDB{}, err
+	}
+
+	sql = `UPDATE tracks SET name = $2, artist = $3, album = $4, album_artist = $5, track_number = $6, year = $7, genre = $8,
+			size = $9, path = $10, hash = NULLIF($11, ''), artist_id = $12, album_id = $13
+		WHERE id = $1`
+	_, err = db.Exec(ctx, sql,
+		track.Id,
+		track.Name,
+		track.Artist,
+		track.Album,
+		track.AlbumArtist,
+		track.TrackNumber,
+		track.Year,
+		track.Genre,
+		track.Size,
+		track.Path,
+		track.Hash,
+		track.ArtistId,
+		track.AlbumId,
+	)
+	if err != nil {
+		return models.TrackDB{}, models.TrackDB{}, wrapErr(err, "track")
+	}
+
+	if oldAlbumId != track.AlbumId {
+		// Трек переезжает в другой альбом вместе с обложкой, если у того своей нет
+		sql = `UPDATE albums SET cover_hash = (SELECT cover_hash FROM albums WHERE id = $2)
+			WHERE id = $1 AND cover_hash IS NULL`
+		if _, err = db.Exec(ctx, sql, track.AlbumId, oldAlbumId); err != nil {
+			return models.TrackDB{}, models.TrackDB{}, err
+		}
+	}
+	if oldArtistId != track.ArtistId || oldAlbumId != track.AlbumId {
+		if err = pruneLibrary(ctx, db, oldArtistId, oldAlbumId); err != nil {
+			return models.TrackDB{}, models.TrackDB{}, err
+		}
+	}
+	return track, previous, nil
+}
+
+// DeleteTrack удаляет трек, а вместе с ним альбом и исполнителя, если у них не осталось треков.
+// Записи трека в плейлистах удаляет каскад, а позиции оставшихся записей сдвигаются без пропусков.
+// Возвращает хэш и путь удаленной строки; если трека уже нет, возвращает errs.ErrNotFound.
+// Вызывается в транзакции: плейлисты с треком блокируются до ее конца, как в lockPlaylist.
+func DeleteTrack(ctx context.Context, db DB, trackId string) (models.TrackDB, error) {
+	sql := `SELECT id FROM playlists
+		WHERE id IN (SELECT playlist_id FROM playlist_tracks WHERE track_id = $1)
+		ORDER BY id FOR UPDATE`
+	rows, err := db.Query(ctx, sql, trackId)
+	if err != nil {
+		return models.TrackDB{}, err
+	}
+	var playlistIds []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return models.TrackDB{}, err
+		}
+		playlistIds = append(playlistIds, id)
+	}
+	if err = rows.Err(); err != nil {
+		return models.TrackDB{}, err
+	}
+
+	sql = "DELETE FROM tracks WHERE id = $1 RETURNING id, COALESCE(hash, ''), path, artist_id, album_id"
+	var track models.TrackDB
+	err = db.QueryRow(ctx, sql, trackId).Scan(&track.Id, &track.Hash, &track.Path, &track.ArtistId, &track.AlbumId)
+	if err != nil {
+		return models.TrackDB{}, wrapErr(err, "track")
+	}
+	if len(playlistIds) > 0 {
+		if err = compactPlaylists(ctx, db, playlistIds); err != nil {
+			return models.TrackDB{}, err
+		}
+	}
+	if err = pruneLibrary(ctx, db, track.ArtistId, track.AlbumId); err != nil {
+		return models.TrackDB{}, err
+	}
+	return track, nil
+}
+
+// HasTrackWithHash сообщает, есть ли у пользователя трек с таким хэшем содержимого
+func HasTrackWithHash(ctx context.Context, db DB, userId, hash string) (bool, error) {
+	sql := "SELECT EXISTS (SELECT 1 FROM tracks WHERE user_id = $1 AND hash = $2)"
+	var exists bool
+	err := db.QueryRow(ctx, sql, userId, hash).Scan(&exists)
+	return exists, err
+}
+
+// HasBlob сообщает, хранится ли уже содержимое с таким хэшем
+func HasBlob(ctx context.Context, db DB, hash string) (bool, error) {
+	sql := "SELECT EXISTS (SELECT 1 FROM blobs WHERE hash = $1)"
+	var exists bool
+	err := db.QueryRow(ctx, sql, hash).Scan(&exists)
+	return exists, err
+}
+
+// AcquireBlob увеличивает счетчик ссылок на blob, создавая запись при первой ссылке.
+// Возвращает путь к объекту и true, если запись новая и объект еще нужно записать.
+// Строка blob остается заблокированной до конца транзакции.
+func AcquireBlob(ctx context.Context, db DB, blob models.Blob) (string, bool, error) {
+	sql := `INSERT INTO blobs (hash, path, size, mime_type, refcount) VALUES ($1, $2, $3, $4, 1)
+		ON CONFLICT (hash) DO UPDATE SET refcount = blobs.refcount + 1
+		RETURNING path, refcount`
+	var path string
+	var refcount int
+	err := db.QueryRow(ctx, sql, blob.Hash, blob.Path, blob.Size, blob.MimeType).Scan(&path, &refcount)
+	if err != nil {
+		return "", false, err
+	}
+	return path, refcount == 1, nil
+}
+
+// ReleaseBlob уменьшает счетчик ссылок на blob и удаляет запись, когда ссылок не осталось.
+// Возвращает true, если запись удалена и объект в хранилище больше не нужен.
+func ReleaseBlob(ctx context.Context, db DB, hash string) (bool, error) {
+	sql := "UPDATE blobs SET refcount = refcount - 1 WHERE hash = $1 RETURNING refcount"
+	var refcount int
+	if err := db.QueryRow(ctx, sql, hash).Scan(&refcount); err != nil {
+		return false, err
+	}
+	if refcount > 0 {
+		return false, nil
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM blobs WHERE hash = $1", hash); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func CreatePlaylist(ctx context.Context, pool *pgxpool.Pool, playlist models.Playlist) (string, error) {
+	sql := "INSERT INTO playlists (user_id, name) VALUES ($1, $2) RETURNING id"
+	var id string
+	err := pool.QueryRow(ctx, sql, playlist.UserId, playlist.Name).Scan(&id)
+	if err != nil {
+		return "", wrapErr(err, "playlist")
+	}
+	return id, nil
+}
+
+func GetPlaylist(ctx context.Context, pool *pgxpool.Pool, playlistId string) (models.Playlist, error) {
+	sql := "SELECT id, user_id, name FROM playlists WHERE id = $1"
+	var playlist models.Playlist
+	err := pool.QueryRow(ctx, sql, playlistId).Scan(&playlist.Id, &playlist.UserId, &playlist.Name)
+	if err != nil {
+		return models.Playlist{}, wrapErr(err, "playlist")
+	}
+	return playlist, nil
 }
 
 func GetPlaylists(ctx context.Context, pool *pgxpool.Pool, userId string) ([]models.Playlist, error) {
-	sql := "SELECT id, name FROM playlists WHERE user_id = $1"
+	sql := "SELECT id, user_id, name FROM playlists WHERE user_id = $1 ORDER BY name"
 	var playlists []models.Playlist
 	rows, err := pool.Query(ctx, sql, userId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var playlist models.Playlist
-		err := rows.Scan(&playlist.Id, &playlist.Name)
+		err := rows.Scan(&playlist.Id, &playlist.UserId, &playlist.Name)
 		if err != nil {
 			return nil, err
 		}
 		playlists = append(playlists, playlist)
 	}
-	return playlists, nil
+	return playlists, rows.Err()
 }
 
-func AddTrackToPlaylist(ctx context.Context, pool *pgxpool.Pool, playlistId string, trackId string) error {
-	sql := "INSERT INTO playlist_tracks (playlist_id, track_id) VALUES ($1, $2)"
-	_, err := pool.Exec(ctx, sql, playlistId, trackId)
+func RenamePlaylist(ctx context.Context, pool *pgxpool.Pool, playlistId string, name string) error {
+	sql := "UPDATE playlists SET name = $2 WHERE id = $1"
+	_, err := pool.Exec(ctx, sql, playlistId, name)
+	if err != nil {
+		return wrapErr(err, "playlist")
+	}
+	return nil
+}
+
+func DeletePlaylist(ctx context.Context, pool *pgxpool.Pool, playlistId string) error {
+	sql := "DELETE FROM playlists WHERE id = $1"
+	_, err := pool.Exec(ctx, sql, playlistId)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func RemoveTrackFromPlaylist(ctx context.Context, pool *pgxpool.Pool, playlistId string, trackId string) error {
-	sql := "DELETE FROM playlist_tracks WHERE playlist_id = $1 AND track_id = $2"
-	_, err := pool.Exec(ctx, sql, playlistId, trackId)
+func GetPlaylistEntries(ctx context.Context, pool *pgxpool.Pool, playlistId string) ([]models.PlaylistEntry, error) {
+	sql := `SELECT pt.id, pt.position, ` + trackColumns("t") + `
+		FROM playlist_tracks pt
+		JOIN tracks t ON t.id = pt.track_id
+		WHERE pt.playlist_id = $1
+		ORDER BY pt.position`
+	var entries []models.PlaylistEntry
+	rows, err := pool.Query(ctx, sql, playlistId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry models.PlaylistEntry
+		err := rows.Scan(append([]any{&entry.Id, &entry.Position}, trackFields(&entry.Track)...)...)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// lockPlaylist блокирует строку плейлиста до конца транзакции и возвращает число записей в нем
+func lockPlaylist(ctx context.Context, tx pgx.Tx, playlistId string) (int, error) {
+	var id string
+	err := tx.QueryRow(ctx, "SELECT id FROM playlists WHERE id = $1 FOR UPDATE", playlistId).Scan(&id)
+	if err != nil {
+		return 0, wrapErr(err, "playlist")
+	}
+	var count int
+	err = tx.QueryRow(ctx, "SELECT count(*) FROM playlist_tracks WHERE playlist_id = $1", playlistId).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// compactPlaylists нумерует записи плейлистов подряд с нуля, сохраняя их порядок
+func compactPlaylists(ctx context.Context, db DB, playlistIds []string) error {
+	sql := `UPDATE playlist_tracks pt SET position = n.rn - 1
+		FROM (
+			SELECT id, row_number() OVER (PARTITION BY playlist_id ORDER BY position) AS rn
+			FROM playlist_tracks WHERE playlist_id = ANY($1)
+		) n
+		WHERE pt.id = n.id AND pt.position <> n.rn - 1`
+	_, err := db.Exec(ctx, sql, playlistIds)
+	return err
+}
+
+// AddTrackToPlaylist вставляет трек на позицию position; отрицательная позиция или позиция
+// за концом списка добавляет трек в конец
+func AddTrackToPlaylist(ctx context.Context, pool *pgxpool.Pool, playlistId string, trackId string, position int) (models.PlaylistEntry, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return models.PlaylistEntry{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	count, err := lockPlaylist(ctx, tx, playlistId)
+	if err != nil {
+		return models.PlaylistEntry{}, err
+	}
+	if position < 0 || position > count {
+		position = count
+	}
+
+	sql := "UPDATE playlist_tracks SET position = position + 1 WHERE playlist_id = $1 AND position >= $2"
+	if _, err = tx.Exec(ctx, sql, playlistId, position); err != nil {
+		return models.PlaylistEntry{}, err
+	}
+
+	entry := models.PlaylistEntry{Position: position}
+	sql = "INSERT INTO playlist_tracks (playlist_id, track_id, position) VALUES ($1, $2, $3) RETURNING id"
+	if err = tx.QueryRow(ctx, sql, playlistId, trackId, position).Scan(&entry.Id); err != nil {
+		return models.PlaylistEntry{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.PlaylistEntry{}, err
+	}
+	return entry, nil
+}
+
+func RemovePlaylistEntry(ctx context.Context, pool *pgxpool.Pool, playlistId string, entryId string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = lockPlaylist(ctx, tx, playlistId); err != nil {
+		return err
+	}
+
+	var position int
+	sql := "DELETE FROM playlist_tracks WHERE id = $1 AND playlist_id = $2 RETURNING position"
+	if err = tx.QueryRow(ctx, sql, entryId, playlistId).Scan(&position); err != nil {
+		return wrapErr(err, "playlist entry")
+	}
+
+	sql = "UPDATE playlist_tracks SET position = position - 1 WHERE playlist_id = $1 AND position > $2"
+	if _, err = tx.Exec(ctx, sql, playlistId, position); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// MovePlaylistEntry переставляет запись на позицию position, сдвигая записи между старой и новой позицией
+func MovePlaylistEntry(ctx context.Context, pool *pgxpool.Pool, playlistId string, entryId string, position int) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	count, err := lockPlaylist(ctx, tx, playlistId)
+	if err != nil {
+		return 0, err
+	}
+
+	var from int
+	sql := "SELECT position FROM playlist_tracks WHERE id = $1 AND playlist_id = $2"
+	if err = tx.QueryRow(ctx, sql, entryId, playlistId).Scan(&from); err != nil {
+		return 0, wrapErr(err, "playlist entry")
+	}
+
+	if position < 0 {
+		position = 0
+	}
+	if position > count-1 {
+		position = count - 1
+	}
+
+	switch {
+	case from < position:
+		sql = "UPDATE playlist_tracks SET position = position - 1 WHERE playlist_id = $1 AND position > $2 AND position <= $3"
+		_, err = tx.Exec(ctx, sql, playlistId, from, position)
+	case from > position:
+		sql = "UPDATE playlist_tracks SET position = position + 1 WHERE playlist_id = $1 AND position >= $3 AND position < $2"
+		_, err = tx.Exec(ctx, sql, playlistId, from, position)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	sql = "UPDATE playlist_tracks SET position = $2 WHERE id = $1"
+	if _, err = tx.Exec(ctx, sql, entryId, position); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return position, nil
+}
+
+func CreateUploadSession(ctx context.Context, pool *pgxpool.Pool, session models.UploadSession) (models.UploadSession, error) {
+	sql := `INSERT INTO upload_sessions (user_id, filename, size, artist, album)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`
+	err := pool.QueryRow(ctx, sql, session.UserId, session.Filename, session.Size, session.Artist, session.Album).Scan(
+		&session.Id,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		return models.UploadSession{}, err
+	}
+	return session, nil
+}
+
+func GetUploadSession(ctx context.Context, pool *pgxpool.Pool, sessionId string) (models.UploadSession, error) {
+	sql := `SELECT id, user_id, filename, size, received, artist, album, created_at, updated_at
+		FROM upload_sessions WHERE id = $1`
+	var session models.UploadSession
+	err := pool.QueryRow(ctx, sql, sessionId).Scan(
+		&session.Id,
+		&session.UserId,
+		&session.Filename,
+		&session.Size,
+		&session.Offset,
+		&session.Artist,
+		&session.Album,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		return models.UploadSession{}, wrapErr(err, "upload session")
+	}
+	return session, nil
+}
+
+// AdvanceUploadSession сдвигает смещение сессии с from на to. Возвращает false, если смещение
+// уже изменил другой запрос.
+func AdvanceUploadSession(ctx context.Context, pool *pgxpool.Pool, sessionId string, from, to int64) (bool, error) {
+	sql := "UPDATE upload_sessions SET received = $3, updated_at = now() WHERE id = $1 AND received = $2"
+	tag, err := pool.Exec(ctx, sql, sessionId, from, to)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ClaimUploadSession помечает полностью принятую сессию как собираемую. Возвращает false,
+// если ее уже собирает другой запрос или получены не все байты.
+func ClaimUploadSession(ctx context.Context, pool *pgxpool.Pool, sessionId string) (bool, error) {
+	sql := "UPDATE upload_sessions SET finishing = true, updated_at = now() WHERE id = $1 AND NOT finishing AND received = size"
+	tag, err := pool.Exec(ctx, sql, sessionId)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReleaseUploadSession снимает отметку ClaimUploadSession, чтобы сборку можно было повторить
+func ReleaseUploadSession(ctx context.Context, pool *pgxpool.Pool, sessionId string) error {
+	sql := "UPDATE upload_sessions SET finishing = false, updated_at = now() WHERE id = $1"
+	_, err := pool.Exec(ctx, sql, sessionId)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func NewUser(ctx context.Context, pool *pgxpool.Pool, user models.User) error {
-	sql := "INSERT INTO users (username, password, email) VALUES ($1, $2, $3)"
-	_, err := pool.Exec(ctx, sql, user.Username, user.Pass, user.Email)
+func DeleteUploadSession(ctx context.Context, pool *pgxpool.Pool, sessionId string) error {
+	sql := "DELETE FROM upload_sessions WHERE id = $1"
+	_, err := pool.Exec(ctx, sql, sessionId)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func GetStaleUploadSessions(ctx context.Context, pool *pgxpool.Pool, before time.Time) ([]string, error) {
+	sql := "SELECT id FROM upload_sessions WHERE updated_at < $1"
+	var ids []string
+	rows, err := pool.Query(ctx, sql, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func NewUser(ctx context.Context, pool *pgxpool.Pool, user models.User) (string, error) {
+	sql := "INSERT INTO users (username, password, email) VALUES ($1, $2, $3) RETURNING id"
+	var id string
+	err := pool.QueryRow(ctx, sql, user.Username, user.Pass, user.Email).Scan(&id)
+	if err != nil {
+		return "", wrapErr(err, "user")
+	}
+	return id, nil
+}
+
 func GetUser(ctx context.Context, pool *pgxpool.Pool, username string) (models.User, error) {
 	sql := "SELECT id, username, password, email FROM users WHERE username = $1"
 	var user models.User
 	err := pool.QueryRow(ctx, sql, username).Scan(&user.Id, &user.Username, &user.Pass, &user.Email)
 	if err != nil {
-		return models.User{}, err
+		return models.User{}, wrapErr(err, "user")
+	}
+	return user, nil
+}
+
+func GetUserById(ctx context.Context, pool *pgxpool.Pool, userId string) (models.User, error) {
+	sql := "SELECT id, username, password, email FROM users WHERE id = $1"
+	var user models.User
+	err := pool.QueryRow(ctx, sql, userId).Scan(&user.Id, &user.Username, &user.Pass, &user.Email)
+	if err != nil {
+		return models.User{}, wrapErr(err, "user")
 	}
 	return user, nil
 }
@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"aumusic/internal/models"
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func CreateSession(ctx context.Context, pool *pgxpool.Pool, session models.Session) (models.Session, error) {
+	sql := `INSERT INTO sessions (user_id, refresh_hash, expires_at) VALUES ($1, $2, $3)
+		RETURNING id, created_at, rotated_at`
+	err := pool.QueryRow(ctx, sql, session.UserId, session.RefreshHash, session.ExpiresAt).Scan(
+		&session.Id,
+		&session.CreatedAt,
+		&session.RotatedAt,
+	)
+	if err != nil {
+		return models.Session{}, wrapErr(err, "session")
+	}
+	return session, nil
+}
+
+// LockSession загружает сессию и блокирует строку до конца транзакции, чтобы два обновления
+// одним refresh-токеном не прошли оба
+func LockSession(ctx context.Context, db DB, sessionId string) (models.Session, error) {
+	sql := `SELECT id, user_id, refresh_hash, previous_hash, created_at, rotated_at, expires_at, revoked_at
+		FROM sessions WHERE id = $1 FOR UPDATE`
+	var session models.Session
+	err := db.QueryRow(ctx, sql, sessionId).Scan(
+		&session.Id,
+		&session.UserId,
+		&session.RefreshHash,
+		&session.PreviousHash,
+		&session.CreatedAt,
+		&session.RotatedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		return models.Session{}, wrapErr(err, "session")
+	}
+	return session, nil
+}
+
+// RotateSession заменяет refresh-токен сессии, запоминая хэш прежнего, и продлевает ее до expiresAt
+func RotateSession(ctx context.Context, db DB, sessionId, refreshHash string, expiresAt time.Time) error {
+	sql := `UPDATE sessions SET previous_hash = refresh_hash, refresh_hash = $2, rotated_at = now(), expires_at = $3
+		WHERE id = $1`
+	_, err := db.Exec(ctx, sql, sessionId, refreshHash, expiresAt)
+	return err
+}
+
+// SessionActive сообщает, что сессия существует, не отозвана и не истекла
+func SessionActive(ctx context.Context, pool *pgxpool.Pool, sessionId string) (bool, error) {
+	sql := "SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > now())"
+	var active bool
+	err := pool.QueryRow(ctx, sql, sessionId).Scan(&active)
+	return active, err
+}
+
+func RevokeSession(ctx context.Context, db DB, sessionId string) error {
+	sql := "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL"
+	_, err := db.Exec(ctx, sql, sessionId)
+	return err
+}
+
+// RevokeUserSessions отзывает все действующие сессии пользователя и возвращает их число
+func RevokeUserSessions(ctx context.Context, db DB, userId string) (int64, error) {
+	sql := "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+	tag, err := db.Exec(ctx, sql, userId)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteStaleSessions удаляет сессии, истекшие или отозванные раньше before
+func DeleteStaleSessions(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int64, error) {
+	sql := "DELETE FROM sessions WHERE expires_at < $1 OR revoked_at < $1"
+	tag, err := pool.Exec(ctx, sql, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
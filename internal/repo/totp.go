@@ -0,0 +1,107 @@
+package repo
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SetPendingTOTP сохраняет новый секрет, пока второй фактор не включен. Если он уже включен,
+// возвращает ErrConflict: сменить секрет можно только после отключения.
+func SetPendingTOTP(ctx context.Context, pool *pgxpool.Pool, userId, secret string) error {
+	sql := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = $2, last_step = 0, failed_attempts = 0, locked_until = NULL, created_at = now()
+		WHERE user_totp.enabled_at IS NULL`
+	tag, err := pool.Exec(ctx, sql, userId, secret)
+	if err != nil {
+		return wrapErr(err, "two-factor authentication")
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.Conflict("two-factor authentication is already enabled", nil)
+	}
+	return nil
+}
+
+// LockTOTP загружает второй фактор пользователя и блокирует строку до конца транзакции,
+// чтобы параллельные попытки не приняли один код дважды и не обошли счетчик ошибок
+func LockTOTP(ctx context.Context, db DB, userId string) (models.TOTP, error) {
+	sql := `SELECT user_id, secret, enabled_at, last_step, failed_attempts, locked_until
+		FROM user_totp WHERE user_id = $1 FOR UPDATE`
+	var totp models.TOTP
+	err := db.QueryRow(ctx, sql, userId).Scan(
+		&totp.UserId,
+		&totp.Secret,
+		&totp.EnabledAt,
+		&totp.LastStep,
+		&totp.FailedAttempts,
+		&totp.LockedUntil,
+	)
+	if err != nil {
+		return models.TOTP{}, wrapErr(err, "two-factor authentication")
+	}
+	return totp, nil
+}
+
+// TOTPEnabled сообщает, включен ли у пользователя второй фактор
+func TOTPEnabled(ctx context.Context, pool *pgxpool.Pool, userId string) (bool, error) {
+	sql := "SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)"
+	var enabled bool
+	err := pool.QueryRow(ctx, sql, userId).Scan(&enabled)
+	return enabled, err
+}
+
+// AcceptTOTP запоминает принятый интервал, сбрасывает счетчик ошибок и включает второй фактор,
+// если он еще не включен
+func AcceptTOTP(ctx context.Context, db DB, userId string, step int64) error {
+	sql := `UPDATE user_totp SET last_step = greatest(last_step, $2), failed_attempts = 0, locked_until = NULL,
+		enabled_at = coalesce(enabled_at, now())
+		WHERE user_id = $1`
+	_, err := db.Exec(ctx, sql, userId, step)
+	return err
+}
+
+// SetTOTPFailures сохраняет число неудачных попыток подряд и время, до которого попытки не принимаются
+func SetTOTPFailures(ctx context.Context, db DB, userId string, attempts int, lockedUntil *time.Time) error {
+	sql := "UPDATE user_totp SET failed_attempts = $2, locked_until = $3 WHERE user_id = $1"
+	_, err := db.Exec(ctx, sql, userId, attempts, lockedUntil)
+	return err
+}
+
+// DeleteTOTP отключает второй фактор и удаляет коды восстановления
+func DeleteTOTP(ctx context.Context, db DB, userId string) error {
+	if _, err := db.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userId); err != nil {
+		return err
+	}
+	_, err := db.Exec(ctx, "DELETE FROM user_totp WHERE user_id = $1", userId)
+	return err
+}
+
+// ReplaceRecoveryCodes заменяет коды восстановления пользователя новыми
+func ReplaceRecoveryCodes(ctx context.Context, db DB, userId string, codeHashes []string) error {
+	if _, err := db.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userId); err != nil {
+		return err
+	}
+	sql := "INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])"
+	_, err := db.Exec(ctx, sql, userId, codeHashes)
+	return err
+}
+
+// UseRecoveryCode гасит неиспользованный код восстановления; false — такого кода нет
+func UseRecoveryCode(ctx context.Context, db DB, userId, codeHash string) (bool, error) {
+	sql := "UPDATE recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+	tag, err := db.Exec(ctx, sql, userId, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func CountRecoveryCodes(ctx context.Context, pool *pgxpool.Pool, userId string) (int, error) {
+	sql := "SELECT count(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL"
+	var n int
+	err := pool.QueryRow(ctx, sql, userId).Scan(&n)
+	return n, err
+}
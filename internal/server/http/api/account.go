@@ -0,0 +1,80 @@
+package api
+
+import (
+	"aumusic/internal/service"
+	"net/http"
+)
+
+// ForgotPassword — POST /api/v1/auth/password/forgot отправляет ссылку для сброса пароля.
+// Отвечает 202 и для неизвестного email, чтобы по ответу нельзя было узнать, зарегистрирован ли он.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	var req ForgotPasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := service.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		serviceError(w, r, "Failed to request password reset", err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword — POST /api/v1/auth/password/reset задает новый пароль по токену из письма.
+// Все сессии пользователя после этого завершаются.
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	var req ResetPasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := service.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		serviceError(w, r, "Failed to reset password", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmail — POST /api/v1/auth/email/verify подтверждает email по токену из письма
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	var req VerifyEmailRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := service.VerifyEmail(r.Context(), req.Token); err != nil {
+		serviceError(w, r, "Failed to verify email", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification — POST /api/v1/auth/email/resend повторно отправляет письмо для подтверждения email
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	user, ok := authenticate(w, r, sessionOnly)
+	if !ok {
+		return
+	}
+
+	if err := service.ResendVerification(r.Context(), user.UserId); err != nil {
+		serviceError(w, r, "Failed to resend verification email", err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
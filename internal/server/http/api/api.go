@@ -0,0 +1,199 @@
+// Package api реализует JSON API /api/v1 для мобильного клиента и скриптов.
+// Все ответы — JSON, ошибки передаются в едином конверте ErrorResponse.
+package api
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/service"
+	"aumusic/pkg/logger"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Prefix — общий префикс маршрутов API
+const Prefix = "/api/v1"
+
+// maxJSONBody ограничивает размер JSON-тела запроса
+const maxJSONBody = 1 << 20
+
+// Машиночитаемые коды ошибок
+const (
+	CodeBadRequest           = "bad_request"
+	CodeValidation           = "validation_failed"
+	CodeUnauthenticated      = "unauthenticated"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeTooManyAttempts      = "too_many_attempts"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeDuplicate            = "duplicate"
+	CodeOffsetMismatch       = "offset_mismatch"
+	CodeUploadIncomplete     = "upload_incomplete"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInternal             = "internal"
+)
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "json marshal error", zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	js, _ := json.Marshal(ErrorResponse{Error: ErrorBody{Code: code, Message: message}})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method "+r.Method+" is not allowed")
+}
+
+// NotFound отвечает на неизвестные пути под /api/v1, чтобы они не попадали в HTML-маршрут "/"
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, CodeNotFound, "no such endpoint")
+}
+
+// ErrorStatus переводит ошибку в код ответа и машиночитаемый код. Это единственное место,
+// где доменные ошибки errs сопоставляются со статусами HTTP; им пользуются и HTML-обработчики.
+func ErrorStatus(err error) (int, string) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	// Сначала частные случаи, для которых у клиента есть отдельный код
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidTwoFactorCode):
+		return http.StatusUnauthorized, CodeInvalidCredentials
+	case errors.Is(err, service.ErrTwoFactorLocked), errors.Is(err, service.ErrTooManyEmails):
+		return http.StatusTooManyRequests, CodeTooManyAttempts
+	case errors.Is(err, service.ErrDuplicate):
+		return http.StatusConflict, CodeDuplicate
+	case errors.Is(err, service.ErrOffsetMismatch):
+		return http.StatusConflict, CodeOffsetMismatch
+	case errors.Is(err, service.ErrUploadIncomplete):
+		return http.StatusConflict, CodeUploadIncomplete
+	case errors.Is(err, service.ErrUploadTooLarge), errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, CodePayloadTooLarge
+	case errors.Is(err, service.ErrNotAudio):
+		return http.StatusUnsupportedMediaType, CodeUnsupportedMediaType
+
+	case errors.Is(err, errs.ErrUnauthenticated):
+		return http.StatusUnauthorized, CodeUnauthenticated
+	case errors.Is(err, errs.ErrForbidden):
+		return http.StatusForbidden, CodeForbidden
+	case errors.Is(err, errs.ErrNotFound):
+		return http.StatusNotFound, CodeNotFound
+	case errors.Is(err, errs.ErrConflict):
+		return http.StatusConflict, CodeConflict
+	case errors.Is(err, errs.ErrValidation):
+		return http.StatusBadRequest, CodeValidation
+	}
+	return http.StatusInternalServerError, CodeInternal
+}
+
+// ErrorMessage возвращает текст ошибки для клиента; причины внутренних ошибок не раскрываются
+func ErrorMessage(err error) string {
+	if status, _ := ErrorStatus(err); status == http.StatusInternalServerError {
+		return http.StatusText(status)
+	}
+	if errors.As(err, new(*http.MaxBytesError)) {
+		return "request body is too large"
+	}
+	return errs.Message(err)
+}
+
+// serviceError логирует ошибку сервиса и отправляет ее в конверте ErrorResponse
+func serviceError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), msg, zap.Error(err))
+
+	status, code := ErrorStatus(err)
+	if status == http.StatusUnauthorized && code == CodeUnauthenticated {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="aumusic"`)
+	}
+	writeError(w, r, status, code, ErrorMessage(err))
+}
+
+// validator реализуют типы запросов, у которых есть обязательные поля
+type validator interface {
+	validate() error
+}
+
+// decodeJSON читает JSON-тело в v и проверяет его. При ошибке ответ уже отправлен.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v validator) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBody)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		writeError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "request body is too large")
+		return false
+	case errors.Is(err, io.EOF):
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "request body is empty")
+		return false
+	case err != nil:
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "invalid JSON: "+err.Error())
+		return false
+	}
+	if err = v.validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeValidation, err.Error())
+		return false
+	}
+	return true
+}
+
+// bearerToken берет токен из заголовка Authorization: Bearer, а если его нет — из cookie token
+func bearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if cookie, err := r.Cookie(AccessCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// authenticate возвращает пользователя, которого middleware Authenticate определило по токену запроса,
+// и проверяет, что ему разрешено действие scope (см. service.Caller.Authorize).
+// Если пользователя нет, отправляет 401, если не хватает прав — 403, и возвращает ok == false.
+func authenticate(w http.ResponseWriter, r *http.Request, scope string) (service.Caller, bool) {
+	user, err := CurrentCaller(r)
+	if err == nil {
+		err = user.Authorize(scope)
+	}
+	if err != nil {
+		serviceError(w, r, "Unauthorized request", err)
+		return service.Caller{}, false
+	}
+	return user, true
+}
+
+// sessionOnly — право маршрутов, недоступных API-ключам
+const sessionOnly = ""
+
+// MethodScope — право для маршрута, который читают GET и HEAD, а остальными методами меняют
+func MethodScope(r *http.Request, write string) string {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return service.ScopeRead
+	}
+	return write
+}
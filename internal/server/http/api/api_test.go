@@ -0,0 +1,237 @@
+package api
+
+import (
+	"aumusic/internal/config"
+	"aumusic/internal/errs"
+	"aumusic/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) ErrorBody {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type %q", ct)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Error
+}
+
+func TestServiceError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{errs.NotFound("track not found", fmt.Errorf("no rows in result set")), http.StatusNotFound, CodeNotFound},
+		{service.ErrNotOwner, http.StatusForbidden, CodeForbidden},
+		{errs.Unauthenticated(fmt.Errorf("token is expired")), http.StatusUnauthorized, CodeUnauthenticated},
+		{errs.Validation("name is required"), http.StatusBadRequest, CodeValidation},
+		{errs.Conflict("user already exists", nil), http.StatusConflict, CodeConflict},
+		{service.ErrInvalidCredentials, http.StatusUnauthorized, CodeInvalidCredentials},
+		{service.ErrInvalidTwoFactorCode, http.StatusUnauthorized, CodeInvalidCredentials},
+		{service.ErrTwoFactorLocked, http.StatusTooManyRequests, CodeTooManyAttempts},
+		{service.ErrTooManyEmails, http.StatusTooManyRequests, CodeTooManyAttempts},
+		{service.ErrInvalidEmailToken, http.StatusBadRequest, CodeValidation},
+		{fmt.Errorf("wrapped: %w", service.ErrDuplicate), http.StatusConflict, CodeDuplicate},
+		{service.ErrPlaylistExists, http.StatusConflict, CodeConflict},
+		{service.ErrUploadTooLarge, http.StatusRequestEntityTooLarge, CodePayloadTooLarge},
+		{&http.MaxBytesError{Limit: 1}, http.StatusRequestEntityTooLarge, CodePayloadTooLarge},
+		{service.ErrNotAudio, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType},
+		{fmt.Errorf("connection refused"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		serviceError(rec, httptest.NewRequest("GET", "/", nil), "test", c.err)
+		if code := decodeError(t, rec).Code; rec.Code != c.status || code != c.code {
+			t.Errorf("%v: получено %d %s, ожидалось %d %s", c.err, rec.Code, code, c.status, c.code)
+		}
+	}
+
+	// Текст внутренних ошибок и технические причины клиенту не показываются
+	rec := httptest.NewRecorder()
+	serviceError(rec, httptest.NewRequest("GET", "/", nil), "test", fmt.Errorf("dial tcp 10.0.0.1:5432"))
+	if strings.Contains(rec.Body.String(), "10.0.0.1") {
+		t.Fatalf("причина ошибки попала в ответ: %s", rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	serviceError(rec, httptest.NewRequest("GET", "/", nil), "test", errs.NotFound("track not found", fmt.Errorf("no rows in result set")))
+	if msg := decodeError(t, rec).Message; msg != "track not found" {
+		t.Fatalf("сообщение %q", msg)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	cases := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{``, http.StatusBadRequest, CodeBadRequest},
+		{`{"name": 1}`, http.StatusBadRequest, CodeBadRequest},
+		{`{"title": "x"}`, http.StatusBadRequest, CodeBadRequest},
+		{`{"name": "  "}`, http.StatusBadRequest, CodeValidation},
+		{`{"name": "` + strings.Repeat("a", maxJSONBody) + `"}`, http.StatusRequestEntityTooLarge, CodePayloadTooLarge},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		var req PlaylistRequest
+		if decodeJSON(rec, httptest.NewRequest("POST", "/", strings.NewReader(c.body)), &req) {
+			t.Errorf("%.20q: тело принято", c.body)
+			continue
+		}
+		if code := decodeError(t, rec).Code; rec.Code != c.status || code != c.code {
+			t.Errorf("%.20q: получено %d %s, ожидалось %d %s", c.body, rec.Code, code, c.status, c.code)
+		}
+	}
+
+	var req PlaylistRequest
+	if !decodeJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"name": " Road "}`)), &req) {
+		t.Fatal("тело не принято")
+	}
+	if req.Name != "Road" {
+		t.Fatalf("имя %q", req.Name)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer abc")
+	r.AddCookie(&http.Cookie{Name: "token", Value: "cookie"})
+	if token := bearerToken(r); token != "abc" {
+		t.Fatalf("из заголовка получен токен %q", token)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "token", Value: "cookie"})
+	if token := bearerToken(r); token != "cookie" {
+		t.Fatalf("из cookie получен токен %q", token)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	if token := bearerToken(r); token != "" {
+		t.Fatalf("из Basic получен токен %q", token)
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Tracks(rec, httptest.NewRequest("GET", Prefix+"/tracks", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("статус %d, WWW-Authenticate %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+	if code := decodeError(t, rec).Code; code != CodeUnauthenticated {
+		t.Fatalf("код %s", code)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	var got error
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, got = CurrentCaller(r)
+	})
+	ctx := context.WithValue(context.Background(), "cfg", &config.Config{JWTSecret: "test-secret"})
+
+	// Без токена middleware пропускает запрос, а CurrentCaller сообщает, что пользователя нет
+	Authenticate(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if !errors.Is(got, errs.ErrUnauthenticated) {
+		t.Fatalf("без токена получено %v", got)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	r.Header.Set("Authorization", "Bearer not-a-jwt")
+	Authenticate(next).ServeHTTP(httptest.NewRecorder(), r)
+	if !errors.Is(got, errs.ErrUnauthenticated) {
+		t.Fatalf("с неверным токеном получено %v", got)
+	}
+
+	// Обработчики берут пользователя из контекста и не проверяют токен сами
+	rec := httptest.NewRecorder()
+	r = httptest.NewRequest("GET", Prefix+"/auth/me", nil)
+	Me(rec, r.WithContext(service.WithCaller(r.Context(), service.Caller{UserId: "user-1", Username: "alice"})))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("статус %d", rec.Code)
+	}
+	var me UserResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &me); err != nil {
+		t.Fatal(err)
+	}
+	if me != (UserResponse{Id: "user-1", Username: "alice"}) {
+		t.Fatalf("получено %+v", me)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	key := service.Caller{UserId: "user-1", KeyId: "key-1", Scopes: []string{service.ScopeRead}}
+	request := func(method, target string) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		return r.WithContext(service.WithCaller(r.Context(), key))
+	}
+
+	// Ключ без права delete не может удалить трек
+	rec := httptest.NewRecorder()
+	Track(rec, request("DELETE", Prefix+"/tracks/1"))
+	if code := decodeError(t, rec).Code; rec.Code != http.StatusForbidden || code != CodeForbidden {
+		t.Fatalf("удаление: %d %s", rec.Code, code)
+	}
+
+	// Ключом нельзя управлять ключами, даже имея права на все остальное
+	rec = httptest.NewRecorder()
+	APIKeys(rec, request("GET", Prefix+"/keys"))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("список ключей: %d", rec.Code)
+	}
+
+	// и отключать двухфакторную аутентификацию
+	rec = httptest.NewRecorder()
+	TwoFactorDisable(rec, request("POST", Prefix+"/auth/2fa/disable"))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("отключение 2FA: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	Me(rec, request("GET", Prefix+"/auth/me"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("профиль: %d", rec.Code)
+	}
+}
+
+func TestTrackListOptions(t *testing.T) {
+	query, _ := url.ParseQuery("sort=artist&order=desc&limit=20&artist=Air&format=flac&from=2024-03-01&to=2024-04-01T10:00:00%2B03:00")
+	opts, msg := trackListOptions(query)
+	if msg != "" {
+		t.Fatal(msg)
+	}
+	want := service.TrackListOptions{
+		Sort:   "artist",
+		Order:  "desc",
+		Artist: "Air",
+		Format: "flac",
+		From:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2024, 4, 1, 7, 0, 0, 0, time.UTC),
+		Limit:  20,
+	}
+	opts.From, opts.To = opts.From.UTC(), opts.To.UTC()
+	if opts != want {
+		t.Fatalf("получено %+v, ожидалось %+v", opts, want)
+	}
+
+	for _, raw := range []string{"limit=0", "limit=many", "from=yesterday", "to=2024-13-01"} {
+		query, _ := url.ParseQuery(raw)
+		if _, msg := trackListOptions(query); msg == "" {
+			t.Errorf("%s: параметры приняты", raw)
+		}
+	}
+}
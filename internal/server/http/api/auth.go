@@ -0,0 +1,275 @@
+package api
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/service"
+	"aumusic/pkg/logger"
+	"context"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+type authErrorKey struct{}
+
+// Authenticate — middleware, которое один раз на запрос определяет пользователя по заголовку
+// Authorization: Bearer или cookie token и кладет его в контекст (service.WithCaller).
+// Запрос без пользователя проходит дальше: нужен ли он, решает обработчик через CurrentCaller.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = RenewSession(w, r)
+		ctx := r.Context()
+		if token := bearerToken(r); token != "" {
+			user, err := service.Authenticate(ctx, token)
+			if err != nil {
+				logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to validate token", zap.Error(err))
+				ctx = context.WithValue(ctx, authErrorKey{}, err)
+			} else {
+				ctx = service.WithCaller(ctx, user)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CurrentCaller возвращает пользователя запроса или ошибку, из-за которой его не удалось определить
+func CurrentCaller(r *http.Request) (service.Caller, error) {
+	if user, ok := service.CallerFromContext(r.Context()); ok {
+		return user, nil
+	}
+	if err, ok := r.Context().Value(authErrorKey{}).(error); ok {
+		return service.Caller{}, err
+	}
+	return service.Caller{}, errs.Unauthenticated(errors.New("token is empty"))
+}
+
+// Cookie браузерной сессии: access-токен и refresh-токен, которым RenewSession его продлевает
+const (
+	AccessCookie  = "token"
+	RefreshCookie = "refresh_token"
+)
+
+// SetSessionCookies сохраняет токены сессии в cookie. Пустой RefreshToken оставляет прежний refresh-токен.
+func SetSessionCookies(w http.ResponseWriter, tokens service.AuthTokens) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     AccessCookie,
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		Expires:  tokens.AccessExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if tokens.RefreshToken == "" {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshCookie,
+		Value:    tokens.RefreshToken,
+		Path:     "/",
+		Expires:  tokens.RefreshExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookies удаляет cookie сессии в браузере
+func ClearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{AccessCookie, RefreshCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   -1,
+		})
+	}
+}
+
+// cookieValue возвращает значение cookie name или пустую строку
+func cookieValue(r *http.Request, name string) string {
+	if cookie, err := r.Cookie(name); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// RenewSession продлевает браузерную сессию до вызова обработчика: если access-токен в cookie
+// истек, а refresh-токен действителен, выдает новые cookie и подставляет новый токен в запрос.
+// Запросы с заголовком Authorization не трогает: API-клиенты обновляют токены сами.
+func RenewSession(w http.ResponseWriter, r *http.Request) *http.Request {
+	refreshToken := cookieValue(r, RefreshCookie)
+	if r.Header.Get("Authorization") != "" || refreshToken == "" {
+		return r
+	}
+	if service.AccessTokenValid(r.Context(), cookieValue(r, AccessCookie)) {
+		return r
+	}
+
+	tokens, err := service.RefreshSession(r.Context(), refreshToken)
+	if err != nil {
+		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to refresh session", zap.Error(err))
+		if errors.Is(err, errs.ErrUnauthenticated) {
+			ClearSessionCookies(w)
+		}
+		return r
+	}
+	SetSessionCookies(w, tokens)
+	if tokens.RefreshToken != "" {
+		refreshToken = tokens.RefreshToken
+	}
+
+	renewed := r.Clone(r.Context())
+	renewed.Header.Del("Cookie")
+	for _, cookie := range r.Cookies() {
+		if cookie.Name != AccessCookie && cookie.Name != RefreshCookie {
+			renewed.AddCookie(cookie)
+		}
+	}
+	renewed.AddCookie(&http.Cookie{Name: AccessCookie, Value: tokens.AccessToken})
+	renewed.AddCookie(&http.Cookie{Name: RefreshCookie, Value: refreshToken})
+	return renewed
+}
+
+// Register — POST /api/v1/auth/register
+func Register(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	var req RegisterRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := service.RegisterUser(r.Context(), req.Username, req.Email, req.Password); err != nil {
+		serviceError(w, r, "Failed to register user", err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, UserResponse{Username: req.Username, Email: req.Email})
+}
+
+// Login — POST /api/v1/auth/login открывает сессию. Access-токен передается в заголовке
+// Authorization: Bearer, refresh-токен обменивается на новую пару в /auth/refresh.
+// Если у пользователя включена двухфакторная аутентификация, отвечает 202 с two_factor_token
+// для второго шага в /auth/login/2fa.
+func Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	var req LoginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	tokens, challenge, err := service.LoginUser(r.Context(), req.Username, req.Password)
+	if err != nil {
+		serviceError(w, r, "Failed to login user", err)
+		return
+	}
+	if challenge != "" {
+		writeJSON(w, r, http.StatusAccepted, TwoFactorChallengeResponse{TwoFactorRequired: true, TwoFactorToken: challenge})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, tokenResponse(tokens))
+}
+
+// LoginTwoFactor — POST /api/v1/auth/login/2fa, второй шаг входа: код TOTP или код восстановления
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	var req TwoFactorLoginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	tokens, err := service.LoginTwoFactor(r.Context(), req.TwoFactorToken, req.Code)
+	if err != nil {
+		serviceError(w, r, "Failed to check two-factor code", err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, tokenResponse(tokens))
+}
+
+// Refresh — POST /api/v1/auth/refresh меняет refresh-токен на новую пару токенов.
+// Прежний refresh-токен после этого недействителен.
+func Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	var req RefreshRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	tokens, err := service.RefreshSession(r.Context(), req.RefreshToken)
+	if err != nil {
+		serviceError(w, r, "Failed to refresh session", err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, tokenResponse(tokens))
+}
+
+// Logout — POST /api/v1/auth/logout отзывает сессию токена запроса и сбрасывает cookie браузерного клиента
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	if err := service.LogoutSession(r.Context(), bearerToken(r), cookieValue(r, RefreshCookie)); err != nil {
+		serviceError(w, r, "Failed to logout user", err)
+		return
+	}
+	ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll — POST /api/v1/auth/logout-all отзывает все сессии пользователя на всех устройствах
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	user, ok := authenticate(w, r, sessionOnly)
+	if !ok {
+		return
+	}
+
+	if _, err := service.LogoutAll(r.Context(), user.UserId); err != nil {
+		serviceError(w, r, "Failed to revoke sessions", err)
+		return
+	}
+	ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OIDC — GET /api/v1/auth/oidc сообщает, настроен ли единый вход. Сам вход проходит в браузере:
+// страница /auth/oidc/login перенаправляет к провайдеру.
+func OIDC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+	if service.OIDC == nil {
+		writeJSON(w, r, http.StatusOK, OIDCResponse{})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, OIDCResponse{Enabled: true, LoginURL: "/auth/oidc/login"})
+}
+
+// Me — GET /api/v1/auth/me, возвращает пользователя по токену
+func Me(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopeRead)
+	if !ok {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, UserResponse{Id: user.UserId, Username: user.Username})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"aumusic/internal/models"
+	"aumusic/internal/service"
+	"net/http"
+)
+
+// APIKeys — GET /api/v1/keys возвращает API-ключи пользователя, POST выпускает новый.
+// Управлять ключами можно только из сессии входа, не другим ключом.
+func APIKeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, sessionOnly)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		keys, err := service.GetAPIKeys(r.Context(), user.UserId)
+		if err != nil {
+			serviceError(w, r, "Failed to get api keys", err)
+			return
+		}
+		if keys == nil {
+			keys = []models.APIKey{}
+		}
+		writeJSON(w, r, http.StatusOK, APIKeyListResponse{Keys: keys})
+	case "POST":
+		var req CreateAPIKeyRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		key, plain, err := service.CreateAPIKey(r.Context(), user.UserId, req.Name, req.Scopes, req.ExpiresAt)
+		if err != nil {
+			serviceError(w, r, "Failed to create api key", err)
+			return
+		}
+		w.Header().Set("Location", Prefix+"/keys/"+key.Id)
+		writeJSON(w, r, http.StatusCreated, APIKeyResponse{APIKey: key, Key: plain})
+	default:
+		methodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+// APIKey — DELETE /api/v1/keys/{id} отзывает ключ
+func APIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		methodNotAllowed(w, r, "DELETE")
+		return
+	}
+	user, ok := authenticate(w, r, sessionOnly)
+	if !ok {
+		return
+	}
+
+	if err := service.RevokeAPIKey(r.Context(), user.UserId, r.PathValue("id")); err != nil {
+		serviceError(w, r, "Failed to revoke api key", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"aumusic/internal/models"
+	"aumusic/internal/service"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Artists — GET /api/v1/artists возвращает исполнителей пользователя с числом альбомов и треков,
+// общей длительностью и размером
+func Artists(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopeRead)
+	if !ok {
+		return
+	}
+
+	artists, err := service.GetArtists(r.Context(), user.UserId)
+	if err != nil {
+		serviceError(w, r, "Failed to get artists", err)
+		return
+	}
+	if artists == nil {
+		artists = []models.Artist{}
+	}
+	writeJSON(w, r, http.StatusOK, ArtistListResponse{Artists: artists})
+}
+
+// Artist — GET /api/v1/artists/{id} возвращает исполнителя, PATCH переименовывает его во всех треках
+func Artist(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, MethodScope(r, service.ScopeUpload))
+	if !ok {
+		return
+	}
+	artistId := r.PathValue("id")
+
+	switch r.Method {
+	case "GET":
+		artist, err := service.GetArtist(r.Context(), user.UserId, artistId)
+		if err != nil {
+			serviceError(w, r, "Failed to get artist", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, artist)
+	case "PATCH":
+		var req RenameRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		artist, err := service.RenameArtist(r.Context(), user.UserId, artistId, req.Name)
+		if err != nil {
+			serviceError(w, r, "Failed to rename artist", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, artist)
+	default:
+		methodNotAllowed(w, r, "GET, PATCH")
+	}
+}
+
+// Albums — GET /api/v1/albums?artist_id= возвращает альбомы пользователя со сводкой по трекам
+func Albums(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopeRead)
+	if !ok {
+		return
+	}
+
+	albums, err := service.GetAlbums(r.Context(), user.UserId, r.URL.Query().Get("artist_id"))
+	if err != nil {
+		serviceError(w, r, "Failed to get albums", err)
+		return
+	}
+	if albums == nil {
+		albums = []models.Album{}
+	}
+	writeJSON(w, r, http.StatusOK, AlbumListResponse{Albums: albums})
+}
+
+// Album — GET /api/v1/albums/{id} возвращает альбом, PATCH переименовывает его во всех треках
+func Album(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, MethodScope(r, service.ScopeUpload))
+	if !ok {
+		return
+	}
+	albumId := r.PathValue("id")
+
+	switch r.Method {
+	case "GET":
+		album, err := service.GetAlbum(r.Context(), user.UserId, albumId)
+		if err != nil {
+			serviceError(w, r, "Failed to get album", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, album)
+	case "PATCH":
+		var req RenameRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		album, err := service.RenameAlbum(r.Context(), user.UserId, albumId, req.Name)
+		if err != nil {
+			serviceError(w, r, "Failed to rename album", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, album)
+	default:
+		methodNotAllowed(w, r, "GET, PATCH")
+	}
+}
+
+// AlbumTracks — GET /api/v1/albums/{id}/tracks возвращает треки альбома в порядке диска и номера,
+// PATCH меняет метаданные всех треков альбома разом
+func AlbumTracks(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, MethodScope(r, service.ScopeUpload))
+	if !ok {
+		return
+	}
+	albumId := r.PathValue("id")
+
+	var tracks []models.Track
+	var err error
+	msg := "Failed to get album tracks"
+	switch r.Method {
+	case "GET":
+		tracks, err = service.GetAlbumTracks(r.Context(), user.UserId, albumId)
+	case "PATCH":
+		msg = "Failed to update album tracks"
+		var req TrackMetadataRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		tracks, err = service.UpdateAlbumTracks(r.Context(), user.UserId, albumId, req.metadata(), req.WriteTags)
+	default:
+		methodNotAllowed(w, r, "GET, PATCH")
+		return
+	}
+	if err != nil {
+		serviceError(w, r, msg, err)
+		return
+	}
+	if tracks == nil {
+		tracks = []models.Track{}
+	}
+	writeJSON(w, r, http.StatusOK, TrackListResponse{Tracks: tracks})
+}
+
+// AlbumCover — PUT /api/v1/albums/{id}/cover заменяет обложку альбома изображением из тела запроса,
+// DELETE убирает ее
+func AlbumCover(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, service.ScopeUpload)
+	if !ok {
+		return
+	}
+	albumId := r.PathValue("id")
+
+	var data []byte
+	switch r.Method {
+	case "PUT":
+		var err error
+		data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, service.MaxCoverSize))
+		if err != nil {
+			serviceError(w, r, "Failed to read cover", err)
+			return
+		}
+		if len(data) == 0 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "request body is empty")
+			return
+		}
+	case "DELETE":
+	default:
+		methodNotAllowed(w, r, "PUT, DELETE")
+		return
+	}
+
+	album, err := service.SetAlbumCover(r.Context(), user.UserId, albumId, data)
+	if err != nil {
+		serviceError(w, r, "Failed to set album cover", err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, album)
+}
+
+// Cover — GET /api/v1/covers/{id}?size= отдает обложку альбома; содержимое по id никогда
+// не меняется, поэтому ответ кэшируется надолго и сверяется по ETag
+func Cover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, r, "GET, HEAD")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopeRead)
+	if !ok {
+		return
+	}
+	coverId := r.PathValue("id")
+	size := r.URL.Query().Get("size")
+
+	file, contentType, fileSize, modTime, err := service.GetCover(r.Context(), user.UserId, coverId, size)
+	if err != nil {
+		serviceError(w, r, "Failed to get cover", err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(fileSize, 10))
+	w.Header().Set("ETag", service.CoverETag(coverId, size))
+	w.Header().Set("Cache-Control", service.CoverCacheControl)
+	http.ServeContent(w, r, coverId, modTime, file)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec описывает все маршруты сервера, включая HTML-маршруты веб-интерфейса.
+// TestRoutesDocumented и TestSchemasMatchTypes следят, чтобы он не расходился с кодом.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPISpec возвращает документ OpenAPI 3 в формате JSON
+func OpenAPISpec() []byte {
+	return openAPISpec
+}
+
+// OpenAPI — GET /api/v1/openapi.json
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, r, "GET, HEAD")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(openAPISpec)
+}
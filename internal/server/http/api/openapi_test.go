@@ -0,0 +1,274 @@
+package api
+
+import (
+	"aumusic/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// schemaTypes связывает схемы components/schemas с Go-типами, которые их сериализуют
+var schemaTypes = map[string]reflect.Type{
+	"Track":                      reflect.TypeFor[models.Track](),
+	"UploadResult":               reflect.TypeFor[models.UploadResult](),
+	"UploadSession":              reflect.TypeFor[models.UploadSession](),
+	"Playlist":                   reflect.TypeFor[models.Playlist](),
+	"PlaylistEntry":              reflect.TypeFor[models.PlaylistEntry](),
+	"PlaylistEntryPosition":      reflect.TypeFor[PlaylistEntryPosition](),
+	"ErrorResponse":              reflect.TypeFor[ErrorResponse](),
+	"ErrorBody":                  reflect.TypeFor[ErrorBody](),
+	"RegisterRequest":            reflect.TypeFor[RegisterRequest](),
+	"LoginRequest":               reflect.TypeFor[LoginRequest](),
+	"TokenResponse":              reflect.TypeFor[TokenResponse](),
+	"RefreshRequest":             reflect.TypeFor[RefreshRequest](),
+	"UserResponse":               reflect.TypeFor[UserResponse](),
+	"TrackPage":                  reflect.TypeFor[models.TrackPage](),
+	"TrackListResponse":          reflect.TypeFor[TrackListResponse](),
+	"UploadBatchResponse":        reflect.TypeFor[UploadBatchResponse](),
+	"CreateUploadRequest":        reflect.TypeFor[CreateUploadRequest](),
+	"Artist":                     reflect.TypeFor[models.Artist](),
+	"Album":                      reflect.TypeFor[models.Album](),
+	"ArtistListResponse":         reflect.TypeFor[ArtistListResponse](),
+	"AlbumListResponse":          reflect.TypeFor[AlbumListResponse](),
+	"RenameRequest":              reflect.TypeFor[RenameRequest](),
+	"TrackMetadataRequest":       reflect.TypeFor[TrackMetadataRequest](),
+	"PlaylistListResponse":       reflect.TypeFor[PlaylistListResponse](),
+	"PlaylistRequest":            reflect.TypeFor[PlaylistRequest](),
+	"AddPlaylistTrackRequest":    reflect.TypeFor[AddPlaylistTrackRequest](),
+	"MovePlaylistEntryRequest":   reflect.TypeFor[MovePlaylistEntryRequest](),
+	"OIDCResponse":               reflect.TypeFor[OIDCResponse](),
+	"APIKey":                     reflect.TypeFor[models.APIKey](),
+	"TwoFactorChallengeResponse": reflect.TypeFor[TwoFactorChallengeResponse](),
+	"TwoFactorLoginRequest":      reflect.TypeFor[TwoFactorLoginRequest](),
+	"TwoFactorCodeRequest":       reflect.TypeFor[TwoFactorCodeRequest](),
+	"TwoFactorStatusResponse":    reflect.TypeFor[TwoFactorStatusResponse](),
+	"TOTPEnrollmentResponse":     reflect.TypeFor[TOTPEnrollmentResponse](),
+	"RecoveryCodesResponse":      reflect.TypeFor[RecoveryCodesResponse](),
+	"ForgotPasswordRequest":      reflect.TypeFor[ForgotPasswordRequest](),
+	"ResetPasswordRequest":       reflect.TypeFor[ResetPasswordRequest](),
+	"VerifyEmailRequest":         reflect.TypeFor[VerifyEmailRequest](),
+	"APIKeyListResponse":         reflect.TypeFor[APIKeyListResponse](),
+	"CreateAPIKeyRequest":        reflect.TypeFor[CreateAPIKeyRequest](),
+	"APIKeyResponse":             reflect.TypeFor[APIKeyResponse](),
+}
+
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Enum       []string           `json:"enum"`
+	Items      *schema            `json:"items"`
+	Properties map[string]*schema `json:"properties"`
+	Required   []string           `json:"required"`
+}
+
+func loadSpec(t *testing.T) map[string]any {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestOpenAPIRefs(t *testing.T) {
+	doc := loadSpec(t)
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		t.Fatalf("версия OpenAPI %q", version)
+	}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				var target any = doc
+				for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+					m, _ := target.(map[string]any)
+					target = m[part]
+				}
+				if target == nil {
+					t.Errorf("unresolved $ref %s", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+}
+
+func TestSchemasMatchTypes(t *testing.T) {
+	var spec struct {
+		Components struct {
+			Schemas map[string]*schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	for name := range spec.Components.Schemas {
+		if _, ok := schemaTypes[name]; !ok {
+			t.Errorf("schema %s has no Go type in schemaTypes", name)
+		}
+	}
+	for name, typ := range schemaTypes {
+		s, ok := spec.Components.Schemas[name]
+		if !ok {
+			t.Errorf("type %s is not described in openapi.json", name)
+			continue
+		}
+		checkStruct(t, name, typ, s)
+	}
+}
+
+func checkStruct(t *testing.T, name string, typ reflect.Type, s *schema) {
+	t.Helper()
+	if s.Type != "object" {
+		t.Errorf("%s: type %q, expected object", name, s.Type)
+	}
+
+	fields := make(map[string]bool)
+	for _, field := range jsonFields(typ) {
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		key, opts, _ := strings.Cut(tag, ",")
+		if key == "" {
+			key = field.Name
+		}
+		fields[key] = true
+
+		prop, ok := s.Properties[key]
+		if !ok {
+			t.Errorf("%s.%s is missing from the schema", name, key)
+			continue
+		}
+		checkType(t, name+"."+key, field.Type, prop)
+		if opts == "omitempty" && slices.Contains(s.Required, key) {
+			t.Errorf("%s.%s is omitempty but required in the schema", name, key)
+		}
+	}
+	for key := range s.Properties {
+		if !fields[key] {
+			t.Errorf("schema %s has property %s that %s does not have", name, key, typ)
+		}
+	}
+	for _, key := range s.Required {
+		if _, ok := s.Properties[key]; !ok {
+			t.Errorf("%s requires unknown property %s", name, key)
+		}
+	}
+}
+
+// jsonFields возвращает поля структуры так, как их видит encoding/json: поля встроенных
+// структур без тега поднимаются на уровень внешней
+func jsonFields(typ reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func checkType(t *testing.T, name string, typ reflect.Type, s *schema) {
+	t.Helper()
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if s.Ref != "" {
+		ref := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		if schemaTypes[ref] != typ {
+			t.Errorf("%s is %s, but refers to %s", name, typ, ref)
+		}
+		return
+	}
+
+	want := ""
+	switch {
+	case typ == reflect.TypeFor[time.Time]():
+		if s.Format != "date-time" {
+			t.Errorf("%s: format %q, expected date-time", name, s.Format)
+		}
+		want = "string"
+	case typ.Kind() == reflect.String:
+		want = "string"
+	case typ.Kind() == reflect.Bool:
+		want = "boolean"
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		want = "integer"
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		want = "number"
+	case typ.Kind() == reflect.Slice:
+		want = "array"
+		if s.Items == nil {
+			t.Errorf("%s: array without items", name)
+		} else {
+			checkType(t, name+"[]", typ.Elem(), s.Items)
+		}
+	case typ.Kind() == reflect.Struct:
+		checkStruct(t, name, typ, s)
+	default:
+		t.Errorf("%s: unsupported Go type %s", name, typ)
+	}
+	if want != "" && s.Type != want {
+		t.Errorf("%s: type %q, expected %s", name, s.Type, want)
+	}
+}
+
+func TestErrorCodesDocumented(t *testing.T) {
+	var spec struct {
+		Components struct {
+			Schemas map[string]*schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+	enum := spec.Components.Schemas["ErrorBody"].Properties["code"].Enum
+
+	codes := []string{
+		CodeBadRequest, CodeValidation, CodeUnauthenticated, CodeInvalidCredentials, CodeTooManyAttempts, CodeForbidden,
+		CodeNotFound, CodeMethodNotAllowed, CodeConflict, CodeDuplicate, CodeOffsetMismatch,
+		CodeUploadIncomplete, CodePayloadTooLarge, CodeUnsupportedMediaType, CodeInternal,
+	}
+	for _, code := range codes {
+		if !slices.Contains(enum, code) {
+			t.Errorf("error code %s is not listed in ErrorBody.code", code)
+		}
+	}
+	if len(enum) != len(codes) {
+		t.Errorf("ErrorBody.code lists %d codes, expected %d", len(enum), len(codes))
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	OpenAPI(rec, httptest.NewRequest("GET", Prefix+"/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("статус %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type %q", ct)
+	}
+	if !json.Valid(rec.Body.Bytes()) {
+		t.Fatal("ответ не JSON")
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"aumusic/internal/models"
+	"aumusic/internal/service"
+	"net/http"
+)
+
+// Playlists — GET /api/v1/playlists возвращает плейлисты пользователя, POST создает новый
+func Playlists(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, MethodScope(r, service.ScopePlaylists))
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		playlists, err := service.GetPlaylists(r.Context(), user.UserId)
+		if err != nil {
+			serviceError(w, r, "Failed to get playlists", err)
+			return
+		}
+		if playlists == nil {
+			playlists = []models.Playlist{}
+		}
+		writeJSON(w, r, http.StatusOK, PlaylistListResponse{Playlists: playlists})
+	case "POST":
+		var req PlaylistRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		playlist, err := service.CreatePlaylist(r.Context(), user.UserId, req.Name)
+		if err != nil {
+			serviceError(w, r, "Failed to create playlist", err)
+			return
+		}
+		w.Header().Set("Location", Prefix+"/playlists/"+playlist.Id)
+		writeJSON(w, r, http.StatusCreated, playlist)
+	default:
+		methodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+// Playlist — GET /api/v1/playlists/{id} возвращает плейлист с записями, PATCH переименовывает, DELETE удаляет
+func Playlist(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, MethodScope(r, service.ScopePlaylists))
+	if !ok {
+		return
+	}
+	playlistId := r.PathValue("id")
+
+	switch r.Method {
+	case "GET":
+		playlist, err := service.GetPlaylist(r.Context(), user.UserId, playlistId)
+		if err != nil {
+			serviceError(w, r, "Failed to get playlist", err)
+			return
+		}
+		if playlist.Entries == nil {
+			playlist.Entries = []models.PlaylistEntry{}
+		}
+		writeJSON(w, r, http.StatusOK, playlist)
+	case "PATCH":
+		var req PlaylistRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if err := service.RenamePlaylist(r.Context(), user.UserId, playlistId, req.Name); err != nil {
+			serviceError(w, r, "Failed to rename playlist", err)
+			return
+		}
+		playlist, err := service.GetPlaylist(r.Context(), user.UserId, playlistId)
+		if err != nil {
+			serviceError(w, r, "Failed to get playlist", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, playlist)
+	case "DELETE":
+		if err := service.DeletePlaylist(r.Context(), user.UserId, playlistId); err != nil {
+			serviceError(w, r, "Failed to delete playlist", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, "GET, PATCH, DELETE")
+	}
+}
+
+// PlaylistTracks — POST /api/v1/playlists/{id}/tracks добавляет трек в плейлист
+func PlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopePlaylists)
+	if !ok {
+		return
+	}
+	var req AddPlaylistTrackRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	position := -1
+	if req.Position != nil {
+		position = *req.Position
+	}
+
+	entry, err := service.AddTrackToPlaylist(r.Context(), user.UserId, r.PathValue("id"), req.TrackId, position)
+	if err != nil {
+		serviceError(w, r, "Failed to add track to playlist", err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, entry)
+}
+
+// PlaylistEntry — PATCH /api/v1/playlists/{id}/tracks/{entryId} перемещает запись, DELETE удаляет ее
+func PlaylistEntry(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, service.ScopePlaylists)
+	if !ok {
+		return
+	}
+	playlistId := r.PathValue("id")
+	entryId := r.PathValue("entryId")
+
+	switch r.Method {
+	case "PATCH":
+		var req MovePlaylistEntryRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		position, err := service.MovePlaylistEntry(r.Context(), user.UserId, playlistId, entryId, *req.Position)
+		if err != nil {
+			serviceError(w, r, "Failed to move playlist entry", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, PlaylistEntryPosition{Id: entryId, Position: position})
+	case "DELETE":
+		if err := service.RemovePlaylistEntry(r.Context(), user.UserId, playlistId, entryId); err != nil {
+			serviceError(w, r, "Failed to remove playlist entry", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, "PATCH, DELETE")
+	}
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"aumusic/internal/models"
+	"aumusic/internal/service"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Tracks — GET /api/v1/tracks возвращает страницу треков пользователя (см. trackListOptions),
+// POST /api/v1/tracks загружает файлы multipart-формы (поле files, необязательные artist и album)
+func Tracks(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, MethodScope(r, service.ScopeUpload))
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		opts, msg := trackListOptions(r.URL.Query())
+		if msg != "" {
+			writeError(w, r, http.StatusBadRequest, CodeValidation, msg)
+			return
+		}
+		page, err := service.ListTracks(r.Context(), user.UserId, opts)
+		if err != nil {
+			serviceError(w, r, "Failed to list tracks", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, page)
+	case "POST":
+		r.Body = http.MaxBytesReader(w, r.Body, service.MaxUploadSize)
+		if err := r.ParseMultipartForm(service.MaxUploadSize); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				serviceError(w, r, "Failed to parse upload", err)
+				return
+			}
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "request must be multipart/form-data with files")
+			return
+		}
+		if len(r.MultipartForm.File["files"]) == 0 {
+			writeError(w, r, http.StatusBadRequest, CodeValidation, "files is required")
+			return
+		}
+
+		status, results, uploaded := service.LoadTracks(r.Context(), r, r.FormValue("artist"), r.FormValue("album"), user.UserId)
+		writeJSON(w, r, status, UploadBatchResponse{Uploaded: uploaded, Results: results})
+	default:
+		methodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+// trackListOptions разбирает параметры GET /api/v1/tracks: sort, order, cursor, limit, artist, album,
+// format и границы даты добавления from, to (RFC 3339 или YYYY-MM-DD). Вторым значением возвращает
+// описание ошибки; допустимость значений sort, order, format и cursor проверяет сервис.
+func trackListOptions(query url.Values) (service.TrackListOptions, string) {
+	opts := service.TrackListOptions{
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+		Cursor: query.Get("cursor"),
+		Artist: query.Get("artist"),
+		Album:  query.Get("album"),
+		Format: query.Get("format"),
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > service.MaxPageSize {
+			return opts, "limit must be between 1 and " + strconv.Itoa(service.MaxPageSize)
+		}
+		opts.Limit = limit
+	}
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &opts.From}, {"to", &opts.To}} {
+		v := query.Get(bound.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, v)
+		}
+		if err != nil {
+			return opts, bound.name + " must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+		}
+		*bound.t = t
+	}
+	return opts, ""
+}
+
+// TrackSearch — GET /api/v1/tracks/search?q=&fuzzy=&limit= ищет по трекам пользователя,
+// результаты отсортированы по релевантности
+func TrackSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopeRead)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	fuzzy := false
+	if v := query.Get("fuzzy"); v != "" {
+		var err error
+		if fuzzy, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeValidation, "fuzzy must be true or false")
+			return
+		}
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > service.MaxSearchLimit {
+			writeError(w, r, http.StatusBadRequest, CodeValidation, "limit must be between 1 and "+strconv.Itoa(service.MaxSearchLimit))
+			return
+		}
+	}
+
+	tracks, err := service.SearchTracks(r.Context(), user.UserId, query.Get("q"), fuzzy, limit)
+	if err != nil {
+		serviceError(w, r, "Failed to search tracks", err)
+		return
+	}
+	if tracks == nil {
+		tracks = []models.Track{}
+	}
+	writeJSON(w, r, http.StatusOK, TrackListResponse{Tracks: tracks})
+}
+
+// Track — GET /api/v1/tracks/{id} возвращает метаданные трека, PATCH меняет их, DELETE удаляет трек
+func Track(w http.ResponseWriter, r *http.Request) {
+	scope := MethodScope(r, service.ScopeUpload)
+	if r.Method == "DELETE" {
+		scope = service.ScopeDelete
+	}
+	user, ok := authenticate(w, r, scope)
+	if !ok {
+		return
+	}
+	trackId := r.PathValue("id")
+
+	switch r.Method {
+	case "GET":
+		track, err := service.GetTrackInfo(r.Context(), user.UserId, trackId)
+		if err != nil {
+			serviceError(w, r, "Failed to get track", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, track)
+	case "PATCH":
+		var req TrackMetadataRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		track, err := service.UpdateTrack(r.Context(), user.UserId, trackId, req.metadata(), req.WriteTags)
+		if err != nil {
+			serviceError(w, r, "Failed to update track", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, track)
+	case "DELETE":
+		if err := service.DeleteTrack(r.Context(), user.UserId, trackId); err != nil {
+			serviceError(w, r, "Failed to delete track", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, "GET, PATCH, DELETE")
+	}
+}
+
+// TrackStream — GET /api/v1/tracks/{id}/stream?quality=&codec= отдает аудио с поддержкой Range
+func TrackStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, r, "GET, HEAD")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopeStream)
+	if !ok {
+		return
+	}
+	trackId := r.PathValue("id")
+
+	quality := r.URL.Query().Get("quality")
+	codec := r.URL.Query().Get("codec")
+	file, contentType, fileSize, modTime, err := service.GetTrackRendition(r.Context(), user.UserId, trackId, quality, codec)
+	if err != nil {
+		serviceError(w, r, "Failed to get track", err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(fileSize, 10))
+	w.Header().Set("Accept-Ranges", "bytes")
+	http.ServeContent(w, r, trackId, modTime, file)
+}
+
+// TrackHLS — GET /api/v1/tracks/{id}/hls/{file...}, см. handler.TrackHLS
+func TrackHLS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, r, "GET, HEAD")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopeStream)
+	if !ok {
+		return
+	}
+	name := r.PathValue("file")
+
+	file, contentType, fileSize, modTime, err := service.GetTrackHLS(r.Context(), user.UserId, r.PathValue("id"), name)
+	if err != nil {
+		serviceError(w, r, "Failed to get hls file", err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(fileSize, 10))
+	w.Header().Set("Accept-Ranges", "bytes")
+	http.ServeContent(w, r, name, modTime, file)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"aumusic/internal/service"
+	"net/http"
+)
+
+// TwoFactor — GET /api/v1/auth/2fa возвращает состояние двухфакторной аутентификации.
+// Все маршруты /auth/2fa доступны только из сессии входа, не по API-ключу.
+func TwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+	user, ok := authenticate(w, r, sessionOnly)
+	if !ok {
+		return
+	}
+
+	status, err := service.GetTwoFactorStatus(r.Context(), user.UserId)
+	if err != nil {
+		serviceError(w, r, "Failed to get two-factor status", err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, TwoFactorStatusResponse{Enabled: status.Enabled, RecoveryCodesLeft: status.RecoveryCodesLeft})
+}
+
+// TwoFactorEnroll — POST /api/v1/auth/2fa/enroll выдает секрет TOTP. Двухфакторная аутентификация
+// включится после подтверждения первого кода в /auth/2fa/confirm.
+func TwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	user, ok := authenticate(w, r, sessionOnly)
+	if !ok {
+		return
+	}
+
+	enrollment, err := service.EnrollTOTP(r.Context(), user.UserId, user.Username)
+	if err != nil {
+		serviceError(w, r, "Failed to enroll totp", err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, TOTPEnrollmentResponse{Secret: enrollment.Secret, ProvisioningURI: enrollment.URI})
+}
+
+// TwoFactorConfirm — POST /api/v1/auth/2fa/confirm проверяет первый код и включает
+// двухфакторную аутентификацию. Коды восстановления показываются только в этом ответе.
+func TwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	user, ok := authenticate(w, r, sessionOnly)
+	if !ok {
+		return
+	}
+	var req TwoFactorCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	codes, err := service.ConfirmTOTP(r.Context(), user.UserId, req.Code)
+	if err != nil {
+		serviceError(w, r, "Failed to confirm totp", err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// TwoFactorDisable — POST /api/v1/auth/2fa/disable отключает двухфакторную аутентификацию
+// по коду TOTP или коду восстановления
+func TwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	user, ok := authenticate(w, r, sessionOnly)
+	if !ok {
+		return
+	}
+	var req TwoFactorCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := service.DisableTOTP(r.Context(), user.UserId, req.Code); err != nil {
+		serviceError(w, r, "Failed to disable totp", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RecoveryCodes — POST /api/v1/auth/2fa/recovery-codes выдает новые коды восстановления
+// вместо прежних
+func RecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	user, ok := authenticate(w, r, sessionOnly)
+	if !ok {
+		return
+	}
+	var req TwoFactorCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	codes, err := service.RegenerateRecoveryCodes(r.Context(), user.UserId, req.Code)
+	if err != nil {
+		serviceError(w, r, "Failed to regenerate recovery codes", err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"aumusic/internal/models"
+	"aumusic/internal/service"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrorResponse — единый конверт ошибки API
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (req *RegisterRequest) validate() error {
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	switch {
+	case req.Username == "":
+		return errors.New("username is required")
+	case !strings.Contains(req.Email, "@"):
+		return errors.New("email is invalid")
+	case req.Password == "":
+		return errors.New("password is required")
+	}
+	return nil
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (req *LoginRequest) validate() error {
+	if req.Username == "" || req.Password == "" {
+		return errors.New("username and password are required")
+	}
+	return nil
+}
+
+// TokenResponse — access-токен для заголовка Authorization и refresh-токен для POST /auth/refresh.
+// ExpiresIn — время жизни access-токена в секундах.
+type TokenResponse struct {
+	Token        string `json:"token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+func tokenResponse(tokens service.AuthTokens) TokenResponse {
+	return TokenResponse{
+		Token:        tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(tokens.AccessExpiresAt).Round(time.Second).Seconds()),
+		RefreshToken: tokens.RefreshToken,
+	}
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (req *RefreshRequest) validate() error {
+	if req.RefreshToken == "" {
+		return errors.New("refresh_token is required")
+	}
+	return nil
+}
+
+type UserResponse struct {
+	Id       string `json:"id,omitempty"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+}
+
+type TrackListResponse struct {
+	Tracks []models.Track `json:"tracks"`
+}
+
+// UploadBatchResponse — итог multipart-загрузки нескольких файлов
+type UploadBatchResponse struct {
+	Uploaded int                   `json:"uploaded"`
+	Results  []models.UploadResult `json:"results"`
+}
+
+type CreateUploadRequest struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+}
+
+func (req *CreateUploadRequest) validate() error {
+	switch {
+	case strings.TrimSpace(req.Filename) == "":
+		return errors.New("filename is required")
+	case req.Size <= 0:
+		return errors.New("size must be positive")
+	}
+	return nil
+}
+
+type PlaylistListResponse struct {
+	Playlists []models.Playlist `json:"playlists"`
+}
+
+// TrackMetadataRequest меняет метаданные трека или всех треков альбома; отсутствующие поля
+// не меняются. WriteTags записывает итоговые значения и в теги файла.
+type TrackMetadataRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Artist      *string `json:"artist,omitempty"`
+	Album       *string `json:"album,omitempty"`
+	Genre       *string `json:"genre,omitempty"`
+	TrackNumber *int    `json:"track_number,omitempty"`
+	Year        *int    `json:"year,omitempty"`
+	WriteTags   bool    `json:"write_tags,omitempty"`
+}
+
+func (req *TrackMetadataRequest) validate() error {
+	if req.Name == nil && req.Artist == nil && req.Album == nil && req.Genre == nil &&
+		req.TrackNumber == nil && req.Year == nil && !req.WriteTags {
+		return errors.New("at least one field is required")
+	}
+	return nil
+}
+
+func (req *TrackMetadataRequest) metadata() service.TrackMetadata {
+	return service.TrackMetadata{
+		Name:        req.Name,
+		Artist:      req.Artist,
+		Album:       req.Album,
+		Genre:       req.Genre,
+		TrackNumber: req.TrackNumber,
+		Year:        req.Year,
+	}
+}
+
+type ArtistListResponse struct {
+	Artists []models.Artist `json:"artists"`
+}
+
+type AlbumListResponse struct {
+	Albums []models.Album `json:"albums"`
+}
+
+// RenameRequest переименовывает исполнителя или альбом во всей библиотеке
+type RenameRequest struct {
+	Name string `json:"name"`
+}
+
+func (req *RenameRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+// PlaylistRequest используется для создания и переименования плейлиста
+type PlaylistRequest struct {
+	Name string `json:"name"`
+}
+
+func (req *PlaylistRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+// AddPlaylistTrackRequest добавляет трек; без position трек попадает в конец плейлиста
+type AddPlaylistTrackRequest struct {
+	TrackId  string `json:"track_id"`
+	Position *int   `json:"position,omitempty"`
+}
+
+func (req *AddPlaylistTrackRequest) validate() error {
+	switch {
+	case req.TrackId == "":
+		return errors.New("track_id is required")
+	case req.Position != nil && *req.Position < 0:
+		return errors.New("position must not be negative")
+	}
+	return nil
+}
+
+type MovePlaylistEntryRequest struct {
+	Position *int `json:"position"`
+}
+
+func (req *MovePlaylistEntryRequest) validate() error {
+	if req.Position == nil || *req.Position < 0 {
+		return errors.New("position must be a non-negative integer")
+	}
+	return nil
+}
+
+type PlaylistEntryPosition struct {
+	Id       string `json:"id"`
+	Position int    `json:"position"`
+}
+
+// CreateAPIKeyRequest выпускает API-ключ; без expires_at ключ бессрочный
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (req *CreateAPIKeyRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	switch {
+	case req.Name == "":
+		return errors.New("name is required")
+	case len(req.Scopes) == 0:
+		return errors.New("scopes is required")
+	}
+	return nil
+}
+
+// APIKeyResponse — созданный ключ. Key показывается только в этом ответе.
+type APIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyListResponse struct {
+	Keys []models.APIKey `json:"keys"`
+}
+
+// OIDCResponse сообщает клиенту, можно ли войти через провайдера единого входа
+type OIDCResponse struct {
+	Enabled  bool   `json:"enabled"`
+	LoginURL string `json:"login_url,omitempty"`
+}
+
+// TwoFactorChallengeResponse — ответ на вход по паролю, когда нужен второй фактор
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	TwoFactorToken    string `json:"two_factor_token"`
+}
+
+type TwoFactorLoginRequest struct {
+	TwoFactorToken string `json:"two_factor_token"`
+	Code           string `json:"code"`
+}
+
+func (req *TwoFactorLoginRequest) validate() error {
+	switch {
+	case req.TwoFactorToken == "":
+		return errors.New("two_factor_token is required")
+	case strings.TrimSpace(req.Code) == "":
+		return errors.New("code is required")
+	}
+	return nil
+}
+
+// TwoFactorCodeRequest подтверждает действие кодом TOTP или кодом восстановления
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (req *TwoFactorCodeRequest) validate() error {
+	if strings.TrimSpace(req.Code) == "" {
+		return errors.New("code is required")
+	}
+	return nil
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TOTPEnrollmentResponse — секрет для ручного ввода и otpauth:// URI для QR-кода
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+func (req *ForgotPasswordRequest) validate() error {
+	req.Email = strings.TrimSpace(req.Email)
+	if !strings.Contains(req.Email, "@") {
+		return errors.New("email is invalid")
+	}
+	return nil
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (req *ResetPasswordRequest) validate() error {
+	switch {
+	case req.Token == "":
+		return errors.New("token is required")
+	case req.Password == "":
+		return errors.New("password is required")
+	}
+	return nil
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (req *VerifyEmailRequest) validate() error {
+	if req.Token == "" {
+		return errors.New("token is required")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"aumusic/internal/service"
+	"net/http"
+	"strconv"
+)
+
+// Uploads — POST /api/v1/uploads начинает возобновляемую загрузку одного файла
+func Uploads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopeUpload)
+	if !ok {
+		return
+	}
+	var req CreateUploadRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	session, err := service.CreateUpload(r.Context(), user.UserId, req.Filename, req.Size, req.Artist, req.Album)
+	if err != nil {
+		serviceError(w, r, "Failed to create upload", err)
+		return
+	}
+	w.Header().Set("Location", Prefix+"/uploads/"+session.Id)
+	w.Header().Set("Upload-Offset", "0")
+	writeJSON(w, r, http.StatusCreated, session)
+}
+
+// Upload обслуживает одну сессию загрузки так же, как handler.Upload:
+// HEAD/GET сообщают смещение, PATCH дописывает часть с Upload-Offset, DELETE отменяет загрузку
+func Upload(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(w, r, service.ScopeUpload)
+	if !ok {
+		return
+	}
+	sessionId := r.PathValue("id")
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case "HEAD", "GET":
+		session, err := service.GetUpload(r.Context(), user.UserId, sessionId)
+		if err != nil {
+			serviceError(w, r, "Failed to get upload", err)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(session.Size, 10))
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, session)
+	case "PATCH":
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeValidation, "Upload-Offset header must be an integer")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, service.MaxChunkSize)
+		offset, err = service.WriteUploadChunk(r.Context(), user.UserId, sessionId, offset, r.Body)
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		if err != nil {
+			serviceError(w, r, "Failed to write upload chunk", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		if err := service.AbortUpload(r.Context(), user.UserId, sessionId); err != nil {
+			serviceError(w, r, "Failed to abort upload", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, "HEAD, GET, PATCH, DELETE")
+	}
+}
+
+// FinishUpload — POST /api/v1/uploads/{id}/finish превращает полученную загрузку в трек
+func FinishUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	user, ok := authenticate(w, r, service.ScopeUpload)
+	if !ok {
+		return
+	}
+
+	track, err := service.FinishUpload(r.Context(), user.UserId, r.PathValue("id"))
+	if err != nil {
+		serviceError(w, r, "Failed to finish upload", err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, track)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"aumusic/internal/service"
+	"aumusic/pkg/logger"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// ForgotPassword — страница /forgot-password и отправка с нее ссылки для сброса пароля
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	if r.Method != "GET" && r.Method != "POST" {
+		methodNotAllowed(w, "GET, POST")
+		return
+	}
+	if r.Method == "GET" {
+		http.ServeFile(w, r, "frontend/forgot-password.html")
+		return
+	}
+	if r.Method == "POST" {
+		if err := service.RequestPasswordReset(r.Context(), r.FormValue("email")); err != nil {
+			httpError(w, r, "Failed to request password reset", err)
+			return
+		}
+		http.Redirect(w, r, "/login?reset=sent", http.StatusSeeOther)
+	}
+}
+
+// ResetPassword — страница /reset-password?token=..., на которую ведет ссылка из письма,
+// и смена пароля с нее
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	if r.Method != "GET" && r.Method != "POST" {
+		methodNotAllowed(w, "GET, POST")
+		return
+	}
+	if r.Method == "GET" {
+		// Токен в адресе не должен уйти сторонним сайтам в Referer
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		http.ServeFile(w, r, "frontend/reset-password.html")
+		return
+	}
+	if r.Method == "POST" {
+		if err := service.ResetPassword(r.Context(), r.FormValue("token"), r.FormValue("password")); err != nil {
+			httpError(w, r, "Failed to reset password", err)
+			return
+		}
+		http.Redirect(w, r, "/login?reset=done", http.StatusSeeOther)
+	}
+}
+
+// VerifyEmail — GET /verify-email?token=..., ссылка из письма подтверждения. Результат
+// показывает страница входа.
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	if err := service.VerifyEmail(r.Context(), r.URL.Query().Get("token")); err != nil {
+		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to verify email", zap.Error(err))
+		http.Redirect(w, r, "/login?error=verify", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/login?verified=1", http.StatusSeeOther)
+}
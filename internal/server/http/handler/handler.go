@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"aumusic/internal/server/http/api"
 	"aumusic/internal/service"
 	"aumusic/pkg/logger"
 	"encoding/json"
@@ -15,59 +16,156 @@ func enableCORS(w *http.ResponseWriter) {
 	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type")
 }
 
-func Index(w http.ResponseWriter, r *http.Request) {
-	enableCORS(&w)
-	cookie, err := r.Cookie("token")
+// httpError логирует ошибку и отвечает текстом с кодом, который выбирает api.ErrorStatus
+func httpError(w http.ResponseWriter, r *http.Request, msg string, err error, fields ...zap.Field) {
+	logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), msg, append(fields, zap.Error(err))...)
+	status, _ := api.ErrorStatus(err)
+	http.Error(w, api.ErrorMessage(err), status)
+}
+
+// methodNotAllowed отвечает 405 и перечисляет в Allow методы, которые принимает маршрут
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// currentUser возвращает пользователя, которого определило middleware api.Authenticate, если ему
+// разрешено действие scope. Без пользователя отвечает 401: эти маршруты вызывают fetch плеера и скрипты,
+// редирект им не поможет.
+func currentUser(w http.ResponseWriter, r *http.Request, scope string) (service.Caller, bool) {
+	user, err := api.CurrentCaller(r)
+	if err == nil {
+		err = user.Authorize(scope)
+	}
 	if err != nil {
+		httpError(w, r, "Unauthenticated request", err)
+		return service.Caller{}, false
+	}
+	return user, true
+}
+
+// loggedIn для HTML-страниц: без пользователя перенаправляет на /login
+func loggedIn(w http.ResponseWriter, r *http.Request) bool {
+	if _, err := api.CurrentCaller(r); err != nil {
+		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Unauthenticated page request", zap.Error(err))
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return false
+	}
+	return true
+}
+
+func Index(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, "GET, HEAD")
 		return
 	}
-	if cookie.Value == "" {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	if !loggedIn(w, r) {
 		return
 	}
 	http.ServeFile(w, r, "frontend/player.html")
 }
 
 func RunTrack(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, "GET, HEAD")
+		return
+	}
 	trackName := r.PathValue("id")
-	token, err := r.Cookie("token")
-	if err != nil {
-		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to get token", zap.Error(err))
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	user, ok := currentUser(w, r, service.ScopeStream)
+	if !ok {
 		return
 	}
 
-	file, fileSize, modTime, err := service.GetTrack(r.Context(), token.Value, trackName)
+	quality := r.URL.Query().Get("quality")
+	codec := r.URL.Query().Get("codec")
+	file, contentType, fileSize, modTime, err := service.GetTrackRendition(r.Context(), user.UserId, trackName, quality, codec)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		logger.GetLoggerFromCtx(r.Context()).Info(
-			r.Context(),
-			"Failed to get track",
-			zap.String("trackName", trackName),
-			zap.Error(err))
+		httpError(w, r, "Failed to get track", err, zap.String("trackName", trackName))
 		return
 	}
+	defer file.Close()
 
 	enableCORS(&w)
-	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileSize))
 	w.Header().Set("Accept-Ranges", "bytes")
 
 	http.ServeContent(w, r, trackName, modTime, file)
 }
 
+// TrackHLS отдает плейлисты и сегменты HLS: /tracks/{id}/hls/master.m3u8 ссылается
+// на варианты /tracks/{id}/hls/{bitrate}/index.m3u8 относительными путями
+func TrackHLS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, "GET, HEAD")
+		return
+	}
+	trackId := r.PathValue("id")
+	name := r.PathValue("file")
+	user, ok := currentUser(w, r, service.ScopeStream)
+	if !ok {
+		return
+	}
+
+	file, contentType, fileSize, modTime, err := service.GetTrackHLS(r.Context(), user.UserId, trackId, name)
+	if err != nil {
+		httpError(w, r, "Failed to get hls file", err, zap.String("trackId", trackId), zap.String("file", name))
+		return
+	}
+	defer file.Close()
+
+	enableCORS(&w)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileSize))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	http.ServeContent(w, r, name, modTime, file)
+}
+
+// Cover отдает обложку альбома: /covers/{id}?size=256
+func Cover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, "GET, HEAD")
+		return
+	}
+	coverId := r.PathValue("id")
+	user, ok := currentUser(w, r, service.ScopeRead)
+	if !ok {
+		return
+	}
+
+	size := r.URL.Query().Get("size")
+	file, contentType, fileSize, modTime, err := service.GetCover(r.Context(), user.UserId, coverId, size)
+	if err != nil {
+		httpError(w, r, "Failed to get cover", err, zap.String("coverId", coverId))
+		return
+	}
+	defer file.Close()
+
+	enableCORS(&w)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileSize))
+	w.Header().Set("ETag", service.CoverETag(coverId, size))
+	w.Header().Set("Cache-Control", service.CoverCacheControl)
+
+	http.ServeContent(w, r, coverId, modTime, file)
+}
+
 func RegisterUser(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
+	if r.Method != "GET" && r.Method != "POST" {
+		methodNotAllowed(w, "GET, POST")
+		return
+	}
 	if r.Method == "GET" {
 		http.ServeFile(w, r, "frontend/register.html")
 		return
 	}
 	if r.Method == "POST" {
-		err := service.RegisterUser(r.Context(), r)
+		err := service.RegisterUser(r.Context(), r.FormValue("username"), r.FormValue("email"), r.FormValue("password"))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to register user", zap.Error(err))
+			httpError(w, r, "Failed to register user", err)
 			return
 		}
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -76,59 +174,103 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 func LoginUser(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
+	if r.Method != "GET" && r.Method != "POST" {
+		methodNotAllowed(w, "GET, POST")
+		return
+	}
 	if r.Method == "GET" {
 		http.ServeFile(w, r, "frontend/login.html")
 		return
 	}
 	if r.Method == "POST" {
-		tokenString, err := service.LoginUser(r.Context(), r)
+		tokens, challenge, err := service.LoginUser(r.Context(), r.FormValue("username"), r.FormValue("password"))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to login user", zap.Error(err))
+			httpError(w, r, "Failed to login user", err)
 			return
 		}
-
-		cookie := &http.Cookie{
-			Name:     "token",
-			Value:    tokenString,
-			Path:     "/",
-			HttpOnly: true,
+		if challenge != "" {
+			// Пароль верен, но нужен второй фактор: страница входа запросит код
+			askTwoFactor(w, r, challenge)
+			return
 		}
-		http.SetCookie(w, cookie)
+
+		api.SetSessionCookies(w, tokens)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
 
+// twoFactorCookie хранит вход по паролю или через провайдера, пока пользователь вводит код второго фактора
+const twoFactorCookie = "two_factor"
+
+// askTwoFactor сохраняет challenge в cookie и отправляет на шаг ввода кода страницы входа
+func askTwoFactor(w http.ResponseWriter, r *http.Request, challenge string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     twoFactorCookie,
+		Value:    challenge,
+		Path:     "/login",
+		MaxAge:   300,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/login?step=2fa", http.StatusSeeOther)
+}
+
+// LoginTwoFactor — POST /login/2fa, второй шаг входа в браузере: код TOTP или код восстановления
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	if r.Method != "POST" {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	var challenge string
+	if cookie, err := r.Cookie(twoFactorCookie); err == nil {
+		challenge = cookie.Value
+	}
+	tokens, err := service.LoginTwoFactor(r.Context(), challenge, r.FormValue("code"))
+	if err != nil {
+		httpError(w, r, "Failed to check two-factor code", err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: twoFactorCookie, Value: "", Path: "/login", MaxAge: -1, HttpOnly: true})
+	api.SetSessionCookies(w, tokens)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// LogoutUser отзывает сессию браузера и удаляет ее cookie. Ссылка выхода — GET, плеер отправляет POST.
 func LogoutUser(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
-	cookie := &http.Cookie{
-		Name:     "token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
+	if r.Method != "GET" && r.Method != "POST" {
+		methodNotAllowed(w, "GET, POST")
+		return
+	}
+	var accessToken, refreshToken string
+	if cookie, err := r.Cookie(api.AccessCookie); err == nil {
+		accessToken = cookie.Value
 	}
-	http.SetCookie(w, cookie)
+	if cookie, err := r.Cookie(api.RefreshCookie); err == nil {
+		refreshToken = cookie.Value
+	}
+	if err := service.LogoutSession(r.Context(), accessToken, refreshToken); err != nil {
+		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to revoke session", zap.Error(err))
+	}
+	api.ClearSessionCookies(w)
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
 func GetTracksByUser(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
-	token, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to get token", zap.Error(err))
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET")
 		return
 	}
-	_, userid, err := service.ValidToken(r.Context(), token.Value)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to validate token", zap.Error(err))
+	user, ok := currentUser(w, r, service.ScopeRead)
+	if !ok {
 		return
 	}
-	tracks, err := service.GetTracksByUser(r.Context(), userid)
+	tracks, err := service.GetTracksByUser(r.Context(), user.UserId)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to get tracks", zap.Error(err))
+		httpError(w, r, "Failed to get tracks", err)
 		return
 	}
 	js, err := json.Marshal(tracks)
@@ -142,17 +284,13 @@ func GetTracksByUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func LoadTracks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		methodNotAllowed(w, "GET, POST")
+		return
+	}
 	if r.Method == "POST" {
-		token, err := r.Cookie("token")
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to get token", zap.Error(err))
-			return
-		}
-		name, userid, err := service.ValidToken(r.Context(), token.Value)
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to validate token", zap.Error(err))
+		user, ok := currentUser(w, r, service.ScopeUpload)
+		if !ok {
 			return
 		}
 		// Проверка размера запроса
@@ -166,37 +304,25 @@ func LoadTracks(w http.ResponseWriter, r *http.Request) {
 		artist := r.FormValue("artist")
 		album := r.FormValue("album")
 
-		status, uploadResults, lenFiles, err := service.LoadTracks(r.Context(), r, artist, album, name, userid)
-		if err != nil {
-			http.Error(w, err.Error(), status)
-			logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to load tracks", zap.Error(err))
-			return
+		status, results, uploaded := service.LoadTracks(r.Context(), r, artist, album, user.UserId)
+		message := "Upload complete"
+		if status != http.StatusCreated {
+			message = "No files were uploaded"
 		}
-		// Возвращаем JSON-ответ
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		fmt.Fprintf(w, `{
-			"status": "success",
-			"message": "Upload complete",
-			"details": {
-				"artist": "%s",
-				"album": "%s",
-				"files_uploaded": %d,
-				"results": %v
-			}
-		}`, artist, album, lenFiles, uploadResults)
+		// Возвращаем JSON-ответ с итогом по каждому файлу
+		writeJSON(w, r, status, map[string]any{
+			"status":  http.StatusText(status),
+			"message": message,
+			"details": map[string]any{
+				"artist":         artist,
+				"album":          album,
+				"files_uploaded": uploaded,
+				"results":        results,
+			},
+		})
 	}
 	if r.Method == "GET" {
-		token, err := r.Cookie("token")
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to get token", zap.Error(err))
-			return
-		}
-		_, _, err = service.ValidToken(r.Context(), token.Value)
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to validate token", zap.Error(err))
+		if !loggedIn(w, r) {
 			return
 		}
 		http.ServeFile(w, r, "frontend/upload.html")
@@ -206,19 +332,18 @@ func LoadTracks(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteTrack(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "DELETE" {
-		token, err := r.Cookie("token")
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to get token", zap.Error(err))
-			return
-		}
-		trackId := r.PathValue("id")
-		err = service.DeleteTrack(r.Context(), token.Value, trackId)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to delete track", zap.Error(err))
-			return
-		}
+	if r.Method != "DELETE" {
+		methodNotAllowed(w, "DELETE")
+		return
+	}
+	user, ok := currentUser(w, r, service.ScopeDelete)
+	if !ok {
+		return
+	}
+	trackId := r.PathValue("id")
+	err := service.DeleteTrack(r.Context(), user.UserId, trackId)
+	if err != nil {
+		httpError(w, r, "Failed to delete track", err)
+		return
 	}
 }
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"aumusic/internal/server/http/api"
+	"aumusic/internal/service"
+	"aumusic/pkg/logger"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// oidcLoginCookie хранит состояние входа, пока пользователь на странице провайдера
+const oidcLoginCookie = "oidc_login"
+
+// OIDCLogin — GET /auth/oidc/login перенаправляет на страницу входа провайдера
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	authURL, stateToken, err := service.BeginOIDCLogin(r.Context())
+	if err != nil {
+		httpError(w, r, "Failed to start oidc login", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    stateToken,
+		Path:     "/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		// Lax: cookie нужна в переходе с сайта провайдера обратно на callback
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback — GET /auth/oidc/callback, сюда провайдер возвращает пользователя с кодом.
+// Ошибки показывает страница входа: /login?error=sso.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcLoginCookie, Value: "", Path: "/auth/oidc", MaxAge: -1, HttpOnly: true})
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Identity provider refused login",
+			zap.String("error", providerErr), zap.String("description", query.Get("error_description")))
+		http.Redirect(w, r, "/login?error=sso", http.StatusSeeOther)
+		return
+	}
+	var stateToken string
+	if cookie, err := r.Cookie(oidcLoginCookie); err == nil {
+		stateToken = cookie.Value
+	}
+	tokens, challenge, err := service.FinishOIDCLogin(r.Context(), stateToken, query.Get("state"), query.Get("code"))
+	if err != nil {
+		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to finish oidc login", zap.Error(err))
+		http.Redirect(w, r, "/login?error=sso", http.StatusSeeOther)
+		return
+	}
+	if challenge != "" {
+		askTwoFactor(w, r, challenge)
+		return
+	}
+
+	api.SetSessionCookies(w, tokens)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"aumusic/internal/server/http/api"
+	"aumusic/internal/service"
+	"aumusic/pkg/logger"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "json marshal error", zap.Error(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+func Playlists(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	user, ok := currentUser(w, r, api.MethodScope(r, service.ScopePlaylists))
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		playlists, err := service.GetPlaylists(r.Context(), user.UserId)
+		if err != nil {
+			httpError(w, r, "Failed to get playlists", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, playlists)
+	case "POST":
+		playlist, err := service.CreatePlaylist(r.Context(), user.UserId, r.FormValue("name"))
+		if err != nil {
+			httpError(w, r, "Failed to create playlist", err)
+			return
+		}
+		writeJSON(w, r, http.StatusCreated, playlist)
+	default:
+		methodNotAllowed(w, "GET, POST")
+	}
+}
+
+func Playlist(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	user, ok := currentUser(w, r, api.MethodScope(r, service.ScopePlaylists))
+	if !ok {
+		return
+	}
+	playlistId := r.PathValue("id")
+
+	switch r.Method {
+	case "GET":
+		playlist, err := service.GetPlaylist(r.Context(), user.UserId, playlistId)
+		if err != nil {
+			httpError(w, r, "Failed to get playlist", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, playlist)
+	case "PUT", "PATCH":
+		err := service.RenamePlaylist(r.Context(), user.UserId, playlistId, r.FormValue("name"))
+		if err != nil {
+			httpError(w, r, "Failed to rename playlist", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		err := service.DeletePlaylist(r.Context(), user.UserId, playlistId)
+		if err != nil {
+			httpError(w, r, "Failed to delete playlist", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, "GET, PUT, PATCH, DELETE")
+	}
+}
+
+// formPosition читает необязательное поле position; пустое значение означает конец плейлиста
+func formPosition(r *http.Request) (int, error) {
+	value := r.FormValue("position")
+	if value == "" {
+		return -1, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func PlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	if r.Method != "POST" {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	user, ok := currentUser(w, r, service.ScopePlaylists)
+	if !ok {
+		return
+	}
+	position, err := formPosition(r)
+	if err != nil {
+		http.Error(w, "position must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := service.AddTrackToPlaylist(r.Context(), user.UserId, r.PathValue("id"), r.FormValue("track_id"), position)
+	if err != nil {
+		httpError(w, r, "Failed to add track to playlist", err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, entry)
+}
+
+func PlaylistEntry(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	user, ok := currentUser(w, r, service.ScopePlaylists)
+	if !ok {
+		return
+	}
+	playlistId := r.PathValue("id")
+	entryId := r.PathValue("entryId")
+
+	switch r.Method {
+	case "PUT", "PATCH":
+		position, err := strconv.Atoi(r.FormValue("position"))
+		if err != nil {
+			http.Error(w, "position must be an integer", http.StatusBadRequest)
+			return
+		}
+		position, err = service.MovePlaylistEntry(r.Context(), user.UserId, playlistId, entryId, position)
+		if err != nil {
+			httpError(w, r, "Failed to move playlist entry", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, map[string]any{"id": entryId, "position": position})
+	case "DELETE":
+		err := service.RemovePlaylistEntry(r.Context(), user.UserId, playlistId, entryId)
+		if err != nil {
+			httpError(w, r, "Failed to remove playlist entry", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, "PUT, PATCH, DELETE")
+	}
+}
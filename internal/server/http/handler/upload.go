@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"aumusic/internal/service"
+	"net/http"
+	"strconv"
+)
+
+// Uploads начинает возобновляемую загрузку: POST /uploads с полями filename, size и
+// необязательными artist, album. Части отправляются в PATCH /uploads/{id}.
+func Uploads(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	if r.Method != "POST" {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	user, ok := currentUser(w, r, service.ScopeUpload)
+	if !ok {
+		return
+	}
+	size, err := strconv.ParseInt(r.FormValue("size"), 10, 64)
+	if err != nil {
+		http.Error(w, "size must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	session, err := service.CreateUpload(r.Context(), user.UserId, r.FormValue("filename"), size, r.FormValue("artist"), r.FormValue("album"))
+	if err != nil {
+		httpError(w, r, "Failed to create upload", err)
+		return
+	}
+	w.Header().Set("Location", "/uploads/"+session.Id)
+	w.Header().Set("Upload-Offset", "0")
+	writeJSON(w, r, http.StatusCreated, session)
+}
+
+// Upload обслуживает одну сессию загрузки:
+// HEAD/GET сообщают, сколько байт получено (заголовок Upload-Offset),
+// PATCH дописывает тело запроса со смещения из заголовка Upload-Offset,
+// DELETE отменяет загрузку
+func Upload(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	user, ok := currentUser(w, r, service.ScopeUpload)
+	if !ok {
+		return
+	}
+	sessionId := r.PathValue("id")
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case "HEAD", "GET":
+		session, err := service.GetUpload(r.Context(), user.UserId, sessionId)
+		if err != nil {
+			httpError(w, r, "Failed to get upload", err)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(session.Size, 10))
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, session)
+	case "PATCH":
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil {
+			http.Error(w, "Upload-Offset header must be an integer", http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, service.MaxChunkSize)
+		offset, err = service.WriteUploadChunk(r.Context(), user.UserId, sessionId, offset, r.Body)
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		if err != nil {
+			httpError(w, r, "Failed to write upload chunk", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		if err := service.AbortUpload(r.Context(), user.UserId, sessionId); err != nil {
+			httpError(w, r, "Failed to abort upload", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, "HEAD, GET, PATCH, DELETE")
+	}
+}
+
+// FinishUpload превращает полностью полученную загрузку в трек
+func FinishUpload(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	if r.Method != "POST" {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	user, ok := currentUser(w, r, service.ScopeUpload)
+	if !ok {
+		return
+	}
+
+	track, err := service.FinishUpload(r.Context(), user.UserId, r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Failed to finish upload", err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, track)
+}
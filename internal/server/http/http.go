@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"time"
 
+	"aumusic/internal/server/http/api"
 	"aumusic/internal/server/http/handler"
 )
 
@@ -32,16 +33,83 @@ func Run(ctx context.Context, cfg *config.Config) error {
 		})
 	}
 
+	registerRoutes(r)
+
+	mux := middleware(api.Authenticate(r))
+
+	return http.ListenAndServe(":"+cfg.Port, mux)
+}
+
+// router — часть *http.ServeMux, через которую регистрируются маршруты; тесты подставляют свою реализацию
+type router interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// registerRoutes регистрирует все маршруты сервера. Каждый маршрут, кроме запасного
+// api.Prefix+"/", должен быть описан в api/openapi.json.
+func registerRoutes(r router) {
 	r.HandleFunc("/", handler.Index)
 	r.HandleFunc("/tracks/{id}", handler.RunTrack)
+	r.HandleFunc("/tracks/{id}/hls/{file...}", handler.TrackHLS)
 	r.HandleFunc("/tracks", handler.GetTracksByUser)
+	r.HandleFunc("/covers/{id}", handler.Cover)
 	r.HandleFunc("/register", handler.RegisterUser)
 	r.HandleFunc("/login", handler.LoginUser)
+	r.HandleFunc("/login/2fa", handler.LoginTwoFactor)
+	r.HandleFunc("/forgot-password", handler.ForgotPassword)
+	r.HandleFunc("/reset-password", handler.ResetPassword)
+	r.HandleFunc("/verify-email", handler.VerifyEmail)
 	r.HandleFunc("/logout", handler.LogoutUser)
+	r.HandleFunc("/auth/oidc/login", handler.OIDCLogin)
+	r.HandleFunc("/auth/oidc/callback", handler.OIDCCallback)
 	r.HandleFunc("/upload", handler.LoadTracks)
+	r.HandleFunc("/uploads", handler.Uploads)
+	r.HandleFunc("/uploads/{id}", handler.Upload)
+	r.HandleFunc("/uploads/{id}/finish", handler.FinishUpload)
 	r.HandleFunc("/delete/{id}", handler.DeleteTrack)
+	r.HandleFunc("/playlists", handler.Playlists)
+	r.HandleFunc("/playlists/{id}", handler.Playlist)
+	r.HandleFunc("/playlists/{id}/tracks", handler.PlaylistTracks)
+	r.HandleFunc("/playlists/{id}/tracks/{entryId}", handler.PlaylistEntry)
 
-	mux := middleware(r)
-
-	return http.ListenAndServe(":"+cfg.Port, mux)
+	r.HandleFunc(api.Prefix+"/auth/register", api.Register)
+	r.HandleFunc(api.Prefix+"/auth/login", api.Login)
+	r.HandleFunc(api.Prefix+"/auth/login/2fa", api.LoginTwoFactor)
+	r.HandleFunc(api.Prefix+"/auth/password/forgot", api.ForgotPassword)
+	r.HandleFunc(api.Prefix+"/auth/password/reset", api.ResetPassword)
+	r.HandleFunc(api.Prefix+"/auth/email/verify", api.VerifyEmail)
+	r.HandleFunc(api.Prefix+"/auth/email/resend", api.ResendVerification)
+	r.HandleFunc(api.Prefix+"/auth/refresh", api.Refresh)
+	r.HandleFunc(api.Prefix+"/auth/logout", api.Logout)
+	r.HandleFunc(api.Prefix+"/auth/logout-all", api.LogoutAll)
+	r.HandleFunc(api.Prefix+"/auth/me", api.Me)
+	r.HandleFunc(api.Prefix+"/auth/oidc", api.OIDC)
+	r.HandleFunc(api.Prefix+"/auth/2fa", api.TwoFactor)
+	r.HandleFunc(api.Prefix+"/auth/2fa/enroll", api.TwoFactorEnroll)
+	r.HandleFunc(api.Prefix+"/auth/2fa/confirm", api.TwoFactorConfirm)
+	r.HandleFunc(api.Prefix+"/auth/2fa/disable", api.TwoFactorDisable)
+	r.HandleFunc(api.Prefix+"/auth/2fa/recovery-codes", api.RecoveryCodes)
+	r.HandleFunc(api.Prefix+"/keys", api.APIKeys)
+	r.HandleFunc(api.Prefix+"/keys/{id}", api.APIKey)
+	r.HandleFunc(api.Prefix+"/tracks", api.Tracks)
+	r.HandleFunc(api.Prefix+"/tracks/search", api.TrackSearch)
+	r.HandleFunc(api.Prefix+"/tracks/{id}", api.Track)
+	r.HandleFunc(api.Prefix+"/tracks/{id}/stream", api.TrackStream)
+	r.HandleFunc(api.Prefix+"/tracks/{id}/hls/{file...}", api.TrackHLS)
+	r.HandleFunc(api.Prefix+"/artists", api.Artists)
+	r.HandleFunc(api.Prefix+"/artists/{id}", api.Artist)
+	r.HandleFunc(api.Prefix+"/albums", api.Albums)
+	r.HandleFunc(api.Prefix+"/albums/{id}", api.Album)
+	r.HandleFunc(api.Prefix+"/albums/{id}/tracks", api.AlbumTracks)
+	r.HandleFunc(api.Prefix+"/albums/{id}/cover", api.AlbumCover)
+	r.HandleFunc(api.Prefix+"/covers/{id}", api.Cover)
+	r.HandleFunc(api.Prefix+"/uploads", api.Uploads)
+	r.HandleFunc(api.Prefix+"/uploads/{id}", api.Upload)
+	r.HandleFunc(api.Prefix+"/uploads/{id}/finish", api.FinishUpload)
+	r.HandleFunc(api.Prefix+"/playlists", api.Playlists)
+	r.HandleFunc(api.Prefix+"/playlists/{id}", api.Playlist)
+	r.HandleFunc(api.Prefix+"/playlists/{id}/tracks", api.PlaylistTracks)
+	r.HandleFunc(api.Prefix+"/playlists/{id}/tracks/{entryId}", api.PlaylistEntry)
+	r.HandleFunc(api.Prefix+"/openapi.json", api.OpenAPI)
+	r.HandleFunc(api.Prefix+"/", api.NotFound)
 }
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/hash"
+	"aumusic/pkg/logger"
+
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Права API-ключа. Запрос с токеном сессии разрешен всегда, запрос с ключом — только в пределах его прав.
+const (
+	// ScopeRead — просмотр библиотеки, метаданных, обложек и плейлистов
+	ScopeRead = "read"
+	// ScopeStream — получение аудио и HLS
+	ScopeStream = "stream"
+	// ScopeUpload — загрузка треков и правка метаданных и обложек
+	ScopeUpload = "upload"
+	// ScopeDelete — удаление треков
+	ScopeDelete = "delete"
+	// ScopePlaylists — создание, изменение и удаление плейлистов
+	ScopePlaylists = "playlists"
+)
+
+// Scopes — все права, которые можно выдать ключу
+var Scopes = []string{ScopeRead, ScopeStream, ScopeUpload, ScopeDelete, ScopePlaylists}
+
+const (
+	// APIKeyPrefix отличает API-ключ от access-токена в заголовке Authorization
+	APIKeyPrefix = "amk_"
+
+	apiKeyBytes = 32
+	// apiKeyShownPrefix — сколько первых символов ключа сохраняется, чтобы его можно было узнать в списке
+	apiKeyShownPrefix = 12
+	maxAPIKeyName     = 100
+)
+
+// ErrInvalidAPIKey возвращается для неизвестного, удаленного или истекшего ключа
+var ErrInvalidAPIKey = errs.New(errs.ErrUnauthenticated, "api key is invalid or expired")
+
+// CreateAPIKey выпускает ключ пользователя userId. Сам ключ возвращается только здесь:
+// в БД остается его хэш. expiresAt == nil — бессрочный ключ.
+func CreateAPIKey(ctx context.Context, userId, name string, scopes []string, expiresAt *time.Time) (models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return models.APIKey{}, "", errs.Validation("name is required")
+	case utf8.RuneCountInString(name) > maxAPIKeyName:
+		return models.APIKey{}, "", errs.Validation("name is too long")
+	case expiresAt != nil && !expiresAt.After(time.Now()):
+		return models.APIKey{}, "", errs.Validation("expires_at must be in the future")
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	secret, err := hash.NewToken(apiKeyBytes)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	plain := APIKeyPrefix + secret
+	key, err := repo.CreateAPIKey(ctx, Pool, models.APIKey{
+		UserId:    userId,
+		Name:      name,
+		Prefix:    plain[:apiKeyShownPrefix],
+		KeyHash:   hash.HashToken(plain),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to create api key", zap.Error(err))
+		return models.APIKey{}, "", err
+	}
+	return key, plain, nil
+}
+
+// normalizeScopes проверяет права и убирает повторы, сохраняя порядок Scopes
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errs.Validation("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, errs.Validation("unknown scope " + scope + ", expected one of " + strings.Join(Scopes, ", "))
+		}
+	}
+	var normalized []string
+	for _, scope := range Scopes {
+		if slices.Contains(scopes, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+// GetAPIKeys возвращает ключи пользователя userId, включая истекшие
+func GetAPIKeys(ctx context.Context, userId string) ([]models.APIKey, error) {
+	keys, err := repo.GetAPIKeys(ctx, Pool, userId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get api keys", zap.Error(err))
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey удаляет ключ пользователя userId; запросы с ним сразу перестают проходить
+func RevokeAPIKey(ctx context.Context, userId, keyId string) error {
+	if err := repo.DeleteAPIKey(ctx, Pool, userId, keyId); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to revoke api key", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// authenticateAPIKey определяет пользователя и его права по API-ключу
+func authenticateAPIKey(ctx context.Context, plain string) (Caller, error) {
+	key, username, err := repo.UseAPIKey(ctx, Pool, hash.HashToken(plain))
+	if errors.Is(err, errs.ErrNotFound) {
+		return Caller{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to check api key", zap.Error(err))
+		return Caller{}, err
+	}
+	return Caller{UserId: key.UserId, Username: username, KeyId: key.Id, Scopes: key.Scopes}, nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := normalizeScopes([]string{ScopeUpload, ScopeRead, ScopeUpload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{ScopeRead, ScopeUpload}; !slices.Equal(scopes, want) {
+		t.Fatalf("получено %v, ожидалось %v", scopes, want)
+	}
+
+	for _, scopes := range [][]string{nil, {ScopeRead, "admin"}} {
+		if _, err = normalizeScopes(scopes); !errors.Is(err, errs.ErrValidation) {
+			t.Errorf("%v: ожидалась ошибка валидации, получено %v", scopes, err)
+		}
+	}
+}
+
+func TestCallerAuthorize(t *testing.T) {
+	// Сессии доступно все, включая маршруты только для сессий
+	session := Caller{UserId: "user-1"}
+	for _, scope := range []string{ScopeDelete, ""} {
+		if err := session.Authorize(scope); err != nil {
+			t.Errorf("сессия, право %q: %v", scope, err)
+		}
+	}
+
+	key := Caller{UserId: "user-1", KeyId: "key-1", Scopes: []string{ScopeRead, ScopeUpload}}
+	for _, scope := range []string{ScopeRead, ScopeUpload} {
+		if err := key.Authorize(scope); err != nil {
+			t.Errorf("ключ, право %q: %v", scope, err)
+		}
+	}
+	for _, scope := range []string{ScopeDelete, ""} {
+		if err := key.Authorize(scope); !errors.Is(err, errs.ErrForbidden) {
+			t.Errorf("ключ, право %q: ожидалась ErrForbidden, получено %v", scope, err)
+		}
+	}
+}
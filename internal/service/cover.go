@@ -0,0 +1,273 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/logger"
+	"aumusic/pkg/storage"
+	"aumusic/pkg/thumbnail"
+
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime/multipart"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	MaxCoverSize = 20 << 20
+	// CoverOriginal — размер обложки для исходного изображения без уменьшения
+	CoverOriginal = "original"
+
+	coverJanitorInterval = 24 * time.Hour
+	// coverGracePeriod защищает только что записанные файлы, которые еще не успели назначить альбому
+	coverGracePeriod = time.Hour
+)
+
+// CoverCacheControl — заголовок ответа с обложкой: по одному id всегда одно и то же содержимое
+const CoverCacheControl = "private, max-age=31536000, immutable"
+
+// CoverSizes — стороны квадрата в пикселях, в который вписываются миниатюры обложки
+var CoverSizes = []int{64, 256, 512}
+
+// notImageMsg — ответ на обложку, которую не удалось разобрать как JPEG, PNG или GIF
+const notImageMsg = "cover must be a JPEG, PNG or GIF image"
+
+// coverHash — идентификатор обложки в /covers/{id}: SHA-256 исходного изображения
+var coverHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// coverKey — ключ файла обложки; name — CoverOriginal или размер миниатюры
+func coverKey(hash, name string) string {
+	if name != CoverOriginal {
+		name += ".jpg"
+	}
+	return path.Join("covers", hash[:2], hash, name)
+}
+
+// coverFileNames — имена, под которыми обложку кладут рядом с треками альбома
+var coverFileNames = []string{"cover", "folder", "front", "albumart"}
+
+// IsCoverFile сообщает, похоже ли имя файла пакета загрузки на обложку альбома: cover.jpg, folder.png и т. п.
+func IsCoverFile(filename string) bool {
+	base := strings.ToLower(sanitizeName(filename))
+	ext := path.Ext(base)
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		return false
+	}
+	return slices.Contains(coverFileNames, strings.TrimSuffix(base, ext))
+}
+
+// readCover читает обложку из пакета загрузки, не дольше MaxCoverSize байт
+func readCover(fileHeader *multipart.FileHeader) ([]byte, error) {
+	if fileHeader.Size > MaxCoverSize {
+		return nil, errs.Validation("cover exceeds " + strconv.Itoa(MaxCoverSize>>20) + " MiB")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, MaxCoverSize))
+}
+
+// CoverETag — ETag обложки id размера size
+func CoverETag(id, size string) string {
+	if size == "" {
+		size = CoverOriginal
+	}
+	return `"` + id + "-" + size + `"`
+}
+
+// saveCover сохраняет изображение и его миниатюры и возвращает хэш обложки.
+// Одинаковые изображения хранятся один раз, сколько бы альбомов на них ни ссылалось.
+func saveCover(ctx context.Context, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if object, err := Storage.Stat(ctx, coverKey(hash, CoverOriginal)); err == nil {
+		// Перезапись обновляет время изменения, и cleanCovers не удалит обложку, пока ее назначают альбому
+		err = Storage.Put(ctx, object.Key, bytes.NewReader(data), int64(len(data)), object.ContentType)
+		if err != nil {
+			return "", err
+		}
+		return hash, nil
+	}
+
+	img, format, err := thumbnail.Decode(data)
+	if err != nil {
+		return "", errs.Wrap(errs.ErrValidation, notImageMsg, err)
+	}
+	for _, size := range CoverSizes {
+		var buf bytes.Buffer
+		if err = thumbnail.Encode(&buf, thumbnail.Fit(img, size)); err != nil {
+			return "", err
+		}
+		if err = Storage.Put(ctx, coverKey(hash, strconv.Itoa(size)), &buf, int64(buf.Len()), "image/jpeg"); err != nil {
+			return "", err
+		}
+	}
+	// Исходное изображение пишется последним: по нему видно, что миниатюры уже готовы
+	err = Storage.Put(ctx, coverKey(hash, CoverOriginal), bytes.NewReader(data), int64(len(data)), "image/"+format)
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// addAlbumCover назначает обложку альбому, у которого ее еще нет. Ошибки только записываются в лог:
+// из-за обложки не стоит отказывать в загрузке трека.
+func addAlbumCover(ctx context.Context, albumId string, data []byte) {
+	current, err := repo.GetAlbumCover(ctx, Pool, albumId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get album cover", zap.Error(err))
+		return
+	}
+	if current != "" {
+		return
+	}
+	hash, err := saveCover(ctx, data)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to save album cover", zap.Error(err))
+		return
+	}
+	if err = repo.SetAlbumCover(ctx, Pool, albumId, hash); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to set album cover", zap.Error(err))
+	}
+}
+
+// SetAlbumCover заменяет обложку альбома; пустой data убирает ее
+func SetAlbumCover(ctx context.Context, userId, albumId string, data []byte) (models.Album, error) {
+	album, err := ownAlbum(ctx, userId, albumId)
+	if err != nil {
+		return models.Album{}, err
+	}
+
+	var hash string
+	if len(data) > 0 {
+		hash, err = saveCover(ctx, data)
+		if err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to save album cover", zap.Error(err))
+			return models.Album{}, err
+		}
+	}
+	if err = repo.SetAlbumCover(ctx, Pool, albumId, hash); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to set album cover", zap.Error(err))
+		return models.Album{}, err
+	}
+	album.CoverId = hash
+	return album, nil
+}
+
+// GetCover открывает обложку одного из альбомов пользователя. size — CoverOriginal
+// или один из CoverSizes; пустой size означает CoverOriginal.
+func GetCover(ctx context.Context, userId, id, size string) (io.ReadSeekCloser, string, int64, time.Time, error) {
+	if size == "" {
+		size = CoverOriginal
+	}
+	if n, err := strconv.Atoi(size); size != CoverOriginal && (err != nil || !slices.Contains(CoverSizes, n)) {
+		return nil, "", 0, time.Time{}, errs.Validation("size must be one of original, 64, 256, 512")
+	}
+	if !coverHash.MatchString(id) {
+		return nil, "", 0, time.Time{}, errs.NotFound("cover not found", nil)
+	}
+
+	// Чужие обложки неотличимы от несуществующих
+	ok, err := repo.HasCover(ctx, Pool, userId, id)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to check cover", zap.Error(err))
+		return nil, "", 0, time.Time{}, err
+	}
+	if !ok {
+		return nil, "", 0, time.Time{}, errs.NotFound("cover not found", nil)
+	}
+
+	reader, object, err := storage.NewReader(ctx, Storage, coverKey(id, size))
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to open cover", zap.Error(err))
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, "", 0, time.Time{}, errs.NotFound("cover file not found", err)
+		}
+		return nil, "", 0, time.Time{}, err
+	}
+	return reader, object.ContentType, object.Size, object.ModTime, nil
+}
+
+// RunCoverJanitor раз в сутки удаляет файлы обложек, на которые не ссылается ни один альбом.
+// Работает до отмены ctx.
+func RunCoverJanitor(ctx context.Context) {
+	ticker := time.NewTicker(coverJanitorInterval)
+	defer ticker.Stop()
+	for {
+		cleanCovers(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func cleanCovers(ctx context.Context) {
+	objects, err := Storage.List(ctx, "covers/")
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to list covers", zap.Error(err))
+		return
+	}
+	covers := make(map[string][]storage.Object)
+	for _, object := range objects {
+		hash := path.Base(path.Dir(object.Key))
+		covers[hash] = append(covers[hash], object)
+	}
+	for hash, files := range covers {
+		if err := removeUnusedCover(ctx, hash, files); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove unused cover", zap.String("hash", hash), zap.Error(err))
+		}
+	}
+}
+
+// removeUnusedCover удаляет файлы обложки hash, если на нее не ссылается ни один альбом и ни один
+// файл не изменялся в течение coverGracePeriod. Исходное изображение и ссылки проверяются
+// непосредственно перед удалением: saveCover мог только что отдать эту обложку, обновив исходник.
+func removeUnusedCover(ctx context.Context, hash string, files []storage.Object) error {
+	for _, object := range files {
+		if time.Since(object.ModTime) < coverGracePeriod {
+			return nil
+		}
+	}
+	inUse, err := repo.HasCover(ctx, Pool, "", hash)
+	if err != nil || inUse {
+		return err
+	}
+	original := coverKey(hash, CoverOriginal)
+	object, err := Storage.Stat(ctx, original)
+	if err == nil && time.Since(object.ModTime) < coverGracePeriod {
+		return nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	// Исходное изображение удаляется первым, чтобы saveCover не принял обложку за готовую
+	if err = Storage.Delete(ctx, original); err != nil {
+		return err
+	}
+	for _, object := range files {
+		if object.Key == original {
+			continue
+		}
+		if err = Storage.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
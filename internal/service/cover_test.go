@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestIsCoverFile(t *testing.T) {
+	for _, name := range []string{"cover.jpg", "Folder.PNG", "front.jpeg", "disc1/AlbumArt.jpg", `C:\music\cover.png`} {
+		if !IsCoverFile(name) {
+			t.Errorf("%s: ожидалась обложка", name)
+		}
+	}
+	for _, name := range []string{"cover.gif", "back.jpg", "covers.jpg", "01 - cover.mp3", "cover"} {
+		if IsCoverFile(name) {
+			t.Errorf("%s: не обложка", name)
+		}
+	}
+}
+
+func TestCoverKey(t *testing.T) {
+	hash := "ab0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcd"
+	cases := map[string]string{
+		coverKey(hash, CoverOriginal): "covers/ab/" + hash + "/original",
+		coverKey(hash, "256"):         "covers/ab/" + hash + "/256.jpg",
+		CoverETag(hash, ""):           `"` + hash + `-original"`,
+		CoverETag(hash, "64"):         `"` + hash + `-64"`,
+	}
+	for got, want := range cases {
+		if got != want {
+			t.Errorf("получено %s, ожидалось %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/hash"
+	"aumusic/pkg/logger"
+	"aumusic/pkg/mail"
+
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Mail отправляет письма со ссылками подтверждения email и сброса пароля
+var Mail mail.Sender
+
+// Назначения одноразовых ссылок из писем
+const (
+	emailPurposeVerify = "verify"
+	emailPurposeReset  = "reset"
+)
+
+const (
+	emailTokenBytes      = 32
+	emailVerificationTTL = 48 * time.Hour
+	// passwordResetTTL короче: ссылка сброса дает войти в учетную запись без пароля
+	passwordResetTTL = time.Hour
+	// Не больше maxEmailsPerWindow писем одного назначения пользователю за emailWindow,
+	// чтобы формой сброса нельзя было завалить чужой ящик
+	maxEmailsPerWindow = 3
+	emailWindow        = 15 * time.Minute
+	// passwordResetTimeout ограничивает фоновую отправку письма сброса
+	passwordResetTimeout = time.Minute
+)
+
+var (
+	ErrInvalidEmailToken = errs.Validation("link is invalid or expired")
+	ErrEmailVerified     = errs.Conflict("email is already verified", nil)
+	ErrTooManyEmails     = errs.New(errs.ErrConflict, "too many emails sent, try again later")
+)
+
+// VerifyEmail подтверждает email по токену из письма
+func VerifyEmail(ctx context.Context, token string) error {
+	emailToken, err := repo.UseEmailToken(ctx, Pool, emailPurposeVerify, hash.HashToken(token))
+	if errors.Is(err, errs.ErrNotFound) {
+		return ErrInvalidEmailToken
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to use email token", zap.Error(err))
+		return err
+	}
+	ok, err := repo.SetEmailVerified(ctx, Pool, emailToken.UserId, emailToken.Email)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to mark email verified", zap.Error(err))
+		return err
+	}
+	if !ok {
+		// Письмо ушло на адрес, который пользователь с тех пор сменил
+		return ErrInvalidEmailToken
+	}
+	return nil
+}
+
+// ResendVerification повторно отправляет пользователю письмо для подтверждения email
+func ResendVerification(ctx context.Context, userId string) error {
+	verified, err := repo.EmailVerified(ctx, Pool, userId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get email status", zap.Error(err))
+		return err
+	}
+	if verified {
+		return ErrEmailVerified
+	}
+	user, err := repo.GetUserById(ctx, Pool, userId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get user", zap.Error(err))
+		return err
+	}
+	return sendVerification(ctx, user)
+}
+
+// RequestPasswordReset отправляет ссылку для сброса пароля, если email принадлежит пользователю.
+// Ответ не зависит от того, есть ли такой пользователь: иначе по нему можно перебирать адреса.
+// Поэтому письмо готовится и отправляется в фоне, а ошибки только записываются в лог, и ни код
+// ответа, ни время его ожидания ничего не говорят об адресе.
+func RequestPasswordReset(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordResetTimeout)
+	go func() {
+		defer cancel()
+		if err := sendPasswordReset(ctx, email); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to send password reset", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func sendPasswordReset(ctx context.Context, email string) error {
+	user, err := repo.GetUserByEmail(ctx, Pool, strings.TrimSpace(email))
+	if errors.Is(err, errs.ErrNotFound) {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Password reset for unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link, err := newEmailLink(ctx, user, emailPurposeReset, passwordResetTTL, "/reset-password")
+	if errors.Is(err, ErrTooManyEmails) {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Password reset rate limited", zap.String("user_id", user.Id))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return sendMail(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your aumusic password",
+		Text: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your aumusic account. "+
+			"To choose a new password, open this link within %s:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email: your password stays the same.\n",
+			user.Username, passwordResetTTL, link),
+	})
+}
+
+// ResetPassword меняет пароль по ссылке из письма. Ссылка одноразовая; остальные ссылки сброса,
+// все сессии и API-ключи пользователя после этого недействительны.
+func ResetPassword(ctx context.Context, token, password string) error {
+	if password == "" {
+		return errs.Validation("password is required")
+	}
+	passHash, err := hash.GenerateHash(password, hash.DefaultArgon2Params)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to hash password", zap.Error(err))
+		return err
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	emailToken, err := repo.UseEmailToken(ctx, tx, emailPurposeReset, hash.HashToken(token))
+	if errors.Is(err, errs.ErrNotFound) {
+		return ErrInvalidEmailToken
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to use email token", zap.Error(err))
+		return err
+	}
+	if err = repo.UpdatePassword(ctx, tx, emailToken.UserId, passHash); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to update password", zap.Error(err))
+		return err
+	}
+	if err = repo.DeleteEmailTokens(ctx, tx, emailToken.UserId, emailPurposeReset); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to delete reset tokens", zap.Error(err))
+		return err
+	}
+	// Пользователь получил письмо, значит, адрес его
+	if _, err = repo.SetEmailVerified(ctx, tx, emailToken.UserId, emailToken.Email); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to mark email verified", zap.Error(err))
+		return err
+	}
+	if _, err = repo.RevokeUserSessions(ctx, tx, emailToken.UserId); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to revoke sessions", zap.Error(err))
+		return err
+	}
+	// Ключи мог выпустить тот, из-за кого пароль пришлось сбросить
+	if _, err = repo.DeleteUserAPIKeys(ctx, tx, emailToken.UserId); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to delete api keys", zap.Error(err))
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit password reset", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// sendVerification отправляет пользователю ссылку для подтверждения email
+func sendVerification(ctx context.Context, user models.User) error {
+	link, err := newEmailLink(ctx, user, emailPurposeVerify, emailVerificationTTL, "/verify-email")
+	if err != nil {
+		return err
+	}
+	return sendMail(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email for aumusic",
+		Text: fmt.Sprintf("Hi %s,\n\nTo confirm that this is your email address, open this link within %s:\n\n%s\n\n"+
+			"If you didn't create an aumusic account, ignore this email.\n",
+			user.Username, emailVerificationTTL, link),
+	})
+}
+
+// newEmailLink выпускает одноразовый токен и возвращает ссылку path?token=... на адрес приложения
+func newEmailLink(ctx context.Context, user models.User, purpose string, ttl time.Duration, path string) (string, error) {
+	now := time.Now()
+	sent, err := repo.CountEmailTokens(ctx, Pool, user.Id, purpose, now.Add(-emailWindow))
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to count email tokens", zap.Error(err))
+		return "", err
+	}
+	if sent >= maxEmailsPerWindow {
+		return "", ErrTooManyEmails
+	}
+
+	token, err := hash.NewToken(emailTokenBytes)
+	if err != nil {
+		return "", err
+	}
+	err = repo.CreateEmailToken(ctx, Pool, models.EmailToken{
+		UserId:    user.Id,
+		Purpose:   purpose,
+		TokenHash: hash.HashToken(token),
+		Email:     user.Email,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to save email token", zap.Error(err))
+		return "", err
+	}
+	return emailLink(ctx, path, token), nil
+}
+
+func emailLink(ctx context.Context, path, token string) string {
+	return strings.TrimRight(getConfig(ctx).BaseURL, "/") + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+func sendMail(ctx context.Context, msg mail.Message) error {
+	if Mail == nil {
+		return errors.New("mail sender is not configured")
+	}
+	if err := Mail.Send(ctx, msg); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to send mail", zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"aumusic/internal/config"
+	"aumusic/internal/errs"
+	"aumusic/internal/repo"
+	"aumusic/pkg/mail"
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type recordingSender struct {
+	sent []mail.Message
+}
+
+func (s *recordingSender) Send(ctx context.Context, msg mail.Message) error {
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func TestEmailLink(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "cfg", &config.Config{BaseURL: "https://music.example.com/"})
+	link := emailLink(ctx, "/reset-password", "a+b/c")
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "music.example.com" || u.Path != "/reset-password" {
+		t.Fatalf("ссылка %s", link)
+	}
+	// Токен экранирован и возвращается из ссылки без изменений
+	if token := u.Query().Get("token"); token != "a+b/c" {
+		t.Fatalf("токен %q", token)
+	}
+}
+
+func TestSendMail(t *testing.T) {
+	ctx := testContext()
+	// Почта не настроена
+	if err := sendMail(ctx, mail.Message{To: "alice@example.com"}); err == nil {
+		t.Fatal("ожидалась ошибка без настроенной почты")
+	}
+
+	sender := &recordingSender{}
+	Mail = sender
+	t.Cleanup(func() { Mail = nil })
+	if err := sendMail(ctx, mail.Message{To: "alice@example.com", Subject: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []mail.Message{{To: "alice@example.com", Subject: "Hi"}}; !slices.Equal(sender.sent, want) {
+		t.Fatalf("отправлено %+v, ожидалось %+v", sender.sent, want)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := testDB(t)
+	sender := &recordingSender{}
+	user := testUser(t, ctx, sender)
+
+	tokens, _, err := LoginUser(ctx, user.Username, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, err := CreateAPIKey(ctx, user.Id, "ingest", []string{ScopeRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender.sent = nil
+	if err = sendPasswordReset(ctx, strings.ToUpper(user.Email)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("отправлено писем: %d", len(sender.sent))
+	}
+	link := regexp.MustCompile(`/reset-password\?\S+`).FindString(sender.sent[0].Text)
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := u.Query().Get("token")
+
+	if err = ResetPassword(ctx, token, ""); !errors.Is(err, errs.ErrValidation) {
+		t.Fatalf("ожидалась ошибка валидации, получено %v", err)
+	}
+	if err = ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	// Ссылка одноразовая
+	if err = ResetPassword(ctx, token, "other-password"); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Fatalf("ожидалась ErrInvalidEmailToken, получено %v", err)
+	}
+
+	if _, _, err = LoginUser(ctx, user.Username, "password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("старый пароль все еще подходит: %v", err)
+	}
+	if _, _, err = LoginUser(ctx, user.Username, "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	// Сессии и API-ключи, выданные до сброса, больше не действуют
+	if _, err = Authenticate(ctx, tokens.AccessToken); err == nil {
+		t.Fatal("access-токен прежней сессии действует")
+	}
+	if _, err = RefreshSession(ctx, tokens.RefreshToken); err == nil {
+		t.Fatal("refresh-токен прежней сессии действует")
+	}
+	if _, err = Authenticate(ctx, key); err == nil {
+		t.Fatal("API-ключ действует после сброса пароля")
+	}
+	verified, err := repo.EmailVerified(ctx, Pool, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Fatal("сброс по ссылке из письма должен подтверждать email")
+	}
+}
+
+func TestRequestPasswordResetUnknownEmail(t *testing.T) {
+	ctx := testDB(t)
+	sender := &recordingSender{}
+	Mail = sender
+	t.Cleanup(func() { Mail = nil })
+
+	if err := sendPasswordReset(ctx, "nobody-"+uuid.NewString()+"@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.sent) != 0 {
+		t.Fatal("письмо ушло на неизвестный адрес")
+	}
+}
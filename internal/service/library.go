@@ -0,0 +1,171 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/logger"
+
+	"context"
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrArtistExists возвращается при переименовании исполнителя в имя, которое уже есть в библиотеке
+	ErrArtistExists = errs.New(errs.ErrConflict, "artist with this name already exists")
+	// ErrAlbumExists возвращается, если у исполнителя уже есть альбом с таким названием
+	ErrAlbumExists = errs.New(errs.ErrConflict, "album with this name already exists")
+)
+
+// ownArtist загружает исполнителя и проверяет, что он из библиотеки пользователя userId
+func ownArtist(ctx context.Context, userId, id string) (models.Artist, error) {
+	artist, err := repo.GetArtist(ctx, Pool, id)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get artist", zap.Error(err))
+		return models.Artist{}, err
+	}
+	if userId != artist.UserId {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "User is not owner of artist")
+		return models.Artist{}, ErrNotOwner
+	}
+	return artist, nil
+}
+
+// ownAlbum загружает альбом и проверяет, что он из библиотеки пользователя userId
+func ownAlbum(ctx context.Context, userId, id string) (models.Album, error) {
+	album, err := repo.GetAlbum(ctx, Pool, id)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get album", zap.Error(err))
+		return models.Album{}, err
+	}
+	if userId != album.UserId {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "User is not owner of album")
+		return models.Album{}, ErrNotOwner
+	}
+	return album, nil
+}
+
+func GetArtists(ctx context.Context, userId string) ([]models.Artist, error) {
+	artists, err := repo.GetArtists(ctx, Pool, userId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get artists", zap.Error(err))
+		return nil, err
+	}
+	return artists, nil
+}
+
+func GetArtist(ctx context.Context, userId, id string) (models.Artist, error) {
+	return ownArtist(ctx, userId, id)
+}
+
+// GetAlbums возвращает альбомы пользователя; непустой artistId оставляет только альбомы этого исполнителя
+func GetAlbums(ctx context.Context, userId, artistId string) ([]models.Album, error) {
+	if artistId != "" {
+		if _, err := ownArtist(ctx, userId, artistId); err != nil {
+			return nil, err
+		}
+	}
+	albums, err := repo.GetAlbums(ctx, Pool, userId, artistId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get albums", zap.Error(err))
+		return nil, err
+	}
+	return albums, nil
+}
+
+func GetAlbum(ctx context.Context, userId, id string) (models.Album, error) {
+	return ownAlbum(ctx, userId, id)
+}
+
+// GetAlbumTracks возвращает треки альбома в порядке диска и номера трека
+func GetAlbumTracks(ctx context.Context, userId, id string) ([]models.Track, error) {
+	if _, err := ownAlbum(ctx, userId, id); err != nil {
+		return nil, err
+	}
+
+	tracks, err := repo.GetAlbumTracks(ctx, Pool, id)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get album tracks", zap.Error(err))
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// RenameArtist переименовывает исполнителя во всей библиотеке одной транзакцией
+func RenameArtist(ctx context.Context, userId, id, name string) (models.Artist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return models.Artist{}, errs.Validation("artist name is required")
+	}
+	artist, err := ownArtist(ctx, userId, id)
+	if err != nil {
+		return models.Artist{}, err
+	}
+	if artist.Name == name {
+		return artist, nil
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
+		return models.Artist{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = repo.RenameArtist(ctx, tx, id, name)
+	if errors.Is(err, errs.ErrConflict) {
+		return models.Artist{}, ErrArtistExists
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to rename artist", zap.Error(err))
+		return models.Artist{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit artist rename", zap.Error(err))
+		return models.Artist{}, err
+	}
+
+	artist.Name = name
+	return artist, nil
+}
+
+// RenameAlbum переименовывает альбом во всех его треках одной транзакцией
+func RenameAlbum(ctx context.Context, userId, id, name string) (models.Album, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return models.Album{}, errs.Validation("album name is required")
+	}
+	album, err := ownAlbum(ctx, userId, id)
+	if err != nil {
+		return models.Album{}, err
+	}
+	if album.Name == name {
+		return album, nil
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
+		return models.Album{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = repo.RenameAlbum(ctx, tx, id, name)
+	if errors.Is(err, errs.ErrConflict) {
+		return models.Album{}, ErrAlbumExists
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to rename album", zap.Error(err))
+		return models.Album{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit album rename", zap.Error(err))
+		return models.Album{}, err
+	}
+
+	album.Name = name
+	return album, nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/logger"
+
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 500
+)
+
+// TrackSorts — допустимые значения sort для ListTracks
+var TrackSorts = []string{models.TrackSortAdded, models.TrackSortTitle, models.TrackSortArtist, models.TrackSortAlbum, models.TrackSortSize}
+
+// trackFormats сопоставляет короткие названия форматов MIME-типам, которые определяет tag.ContentType
+var trackFormats = map[string]string{
+	"mp3":  "audio/mpeg",
+	"flac": "audio/flac",
+	"ogg":  "audio/ogg",
+	"opus": "audio/ogg; codecs=opus",
+	"wav":  "audio/wav",
+	"aiff": "audio/aiff",
+	"m4a":  "audio/mp4",
+}
+
+// TrackListOptions — параметры списка треков. Пустой Sort означает сортировку по дате добавления,
+// пустой Order — от новых к старым для даты и по возрастанию для остальных полей.
+type TrackListOptions struct {
+	Sort   string
+	Order  string
+	Cursor string
+	Artist string
+	Album  string
+	Format string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// trackCursor — содержимое курсора: сортировка, для которой он выдан, и ключ последнего трека страницы
+type trackCursor struct {
+	Sort        string    `json:"s"`
+	Desc        bool      `json:"d,omitempty"`
+	Id          string    `json:"id"`
+	Name        string    `json:"n,omitempty"`
+	Artist      string    `json:"ar,omitempty"`
+	Album       string    `json:"al,omitempty"`
+	DiscNumber  int       `json:"dn,omitempty"`
+	TrackNumber int       `json:"tn,omitempty"`
+	Size        int64     `json:"sz,omitempty"`
+	ModTime     time.Time `json:"t,omitzero"`
+}
+
+func encodeCursor(sort string, desc bool, t models.Track) string {
+	c := trackCursor{Sort: sort, Desc: desc, Id: t.Id}
+	switch sort {
+	case models.TrackSortAdded:
+		c.ModTime = t.ModTime
+	case models.TrackSortTitle:
+		c.Name = t.Name
+	case models.TrackSortArtist:
+		c.Artist, c.Album, c.DiscNumber, c.TrackNumber = t.Artist, t.Album, t.DiscNumber, t.TrackNumber
+	case models.TrackSortAlbum:
+		c.Album, c.DiscNumber, c.TrackNumber = t.Album, t.DiscNumber, t.TrackNumber
+	case models.TrackSortSize:
+		c.Size = t.Size
+	}
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// decodeCursor восстанавливает ключ последнего трека. Курсор, выданный для другой сортировки, отклоняется:
+// продолжать по нему выборку значило бы пропустить или повторить треки.
+func decodeCursor(s, sort string, desc bool) (*models.Track, error) {
+	var c trackCursor
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(js, &c)
+	}
+	if err != nil || c.Id == "" {
+		return nil, errs.Validation("cursor is malformed")
+	}
+	if c.Sort != sort || c.Desc != desc {
+		return nil, errs.Validation("cursor was issued for a different sort order")
+	}
+	return &models.Track{
+		Id:          c.Id,
+		Name:        c.Name,
+		Artist:      c.Artist,
+		Album:       c.Album,
+		DiscNumber:  c.DiscNumber,
+		TrackNumber: c.TrackNumber,
+		Size:        c.Size,
+		ModTime:     c.ModTime,
+	}, nil
+}
+
+// trackQuery проверяет параметры списка и переводит их в запрос к репозиторию
+func trackQuery(userId string, opts TrackListOptions) (models.TrackQuery, error) {
+	q := models.TrackQuery{
+		UserId: userId,
+		Sort:   opts.Sort,
+		Artist: opts.Artist,
+		Album:  opts.Album,
+		Limit:  opts.Limit,
+	}
+	if q.Sort == "" {
+		q.Sort = models.TrackSortAdded
+	}
+	if !slices.Contains(TrackSorts, q.Sort) {
+		return q, errs.Validation("sort must be one of added, title, artist, album, size")
+	}
+	switch opts.Order {
+	case "":
+		q.Desc = q.Sort == models.TrackSortAdded
+	case "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errs.Validation("order must be asc or desc")
+	}
+
+	if opts.Format != "" {
+		mimeType, ok := trackFormats[opts.Format]
+		if !ok {
+			return q, errs.Validation("format must be one of mp3, flac, ogg, opus, wav, aiff, m4a")
+		}
+		q.MimeType = mimeType
+	}
+	// mod_time хранится без часового пояса в местном времени сервера
+	if !opts.From.IsZero() {
+		q.From = opts.From.In(time.Local)
+	}
+	if !opts.To.IsZero() {
+		q.To = opts.To.In(time.Local)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return q, errs.Validation("from must be earlier than to")
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = DefaultPageSize
+	case q.Limit > MaxPageSize:
+		q.Limit = MaxPageSize
+	}
+
+	if opts.Cursor != "" {
+		after, err := decodeCursor(opts.Cursor, q.Sort, q.Desc)
+		if err != nil {
+			return q, err
+		}
+		q.After = after
+	}
+	return q, nil
+}
+
+// ListTracks возвращает страницу треков пользователя. Следующая страница запрашивается
+// с теми же параметрами и Cursor из NextCursor.
+func ListTracks(ctx context.Context, userId string, opts TrackListOptions) (models.TrackPage, error) {
+	q, err := trackQuery(userId, opts)
+	if err != nil {
+		return models.TrackPage{}, err
+	}
+
+	// Лишняя строка показывает, есть ли следующая страница
+	limit := q.Limit
+	q.Limit++
+	tracks, err := repo.ListTracks(ctx, Pool, q)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to list tracks", zap.Error(err))
+		return models.TrackPage{}, err
+	}
+	total, err := repo.CountTracks(ctx, Pool, q)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to count tracks", zap.Error(err))
+		return models.TrackPage{}, err
+	}
+
+	page := models.TrackPage{Tracks: tracks, Total: total}
+	if len(tracks) > limit {
+		page.Tracks = tracks[:limit]
+		page.NextCursor = encodeCursor(q.Sort, q.Desc, page.Tracks[limit-1])
+	}
+	if page.Tracks == nil {
+		page.Tracks = []models.Track{}
+	}
+	return page, nil
+}
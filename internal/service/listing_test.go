@@ -0,0 +1,81 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	track := models.Track{
+		Id:          "5f0c1e4a-0000-4000-8000-000000000001",
+		Name:        "Speak to Me",
+		Artist:      "Pink Floyd",
+		Album:       "The Dark Side of the Moon",
+		DiscNumber:  1,
+		TrackNumber: 1,
+		Size:        4 << 20,
+		ModTime:     time.Date(2024, 3, 1, 12, 30, 0, 123456000, time.UTC),
+	}
+
+	after, err := decodeCursor(encodeCursor(models.TrackSortArtist, false, track), models.TrackSortArtist, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &models.Track{Id: track.Id, Artist: track.Artist, Album: track.Album, DiscNumber: 1, TrackNumber: 1}
+	if !reflect.DeepEqual(after, want) {
+		t.Fatalf("курсор %+v, ожидалось %+v", after, want)
+	}
+
+	after, err = decodeCursor(encodeCursor(models.TrackSortAdded, true, track), models.TrackSortAdded, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !track.ModTime.Equal(after.ModTime) {
+		t.Fatalf("время курсора %v, ожидалось %v", after.ModTime, track.ModTime)
+	}
+
+	// Курсор другой сортировки или направления, как и мусор, не принимается
+	_, err = decodeCursor(encodeCursor(models.TrackSortAdded, true, track), models.TrackSortAdded, false)
+	if !errors.Is(err, errs.ErrValidation) {
+		t.Fatalf("ожидалась ошибка валидации, получено %v", err)
+	}
+	_, err = decodeCursor("not a cursor", models.TrackSortAdded, true)
+	if !errors.Is(err, errs.ErrValidation) {
+		t.Fatalf("ожидалась ошибка валидации, получено %v", err)
+	}
+}
+
+func TestTrackQuery(t *testing.T) {
+	q, err := trackQuery("user", TrackListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Sort != models.TrackSortAdded || !q.Desc || q.Limit != DefaultPageSize {
+		t.Fatalf("по умолчанию получено %+v", q)
+	}
+
+	q, err = trackQuery("user", TrackListOptions{Sort: "title", Format: "opus", Limit: 10_000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Desc || q.MimeType != "audio/ogg; codecs=opus" || q.Limit != MaxPageSize {
+		t.Fatalf("получено %+v", q)
+	}
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, opts := range []TrackListOptions{
+		{Sort: "rating"},
+		{Order: "up"},
+		{Format: "exe"},
+		{From: day, To: day},
+		{Cursor: "%%%"},
+	} {
+		if _, err := trackQuery("user", opts); !errors.Is(err, errs.ErrValidation) {
+			t.Errorf("%+v: ожидалась ошибка валидации, получено %v", opts, err)
+		}
+	}
+}
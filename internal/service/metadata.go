@@ -0,0 +1,357 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/logger"
+	"aumusic/pkg/transcode"
+
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ErrTrackChanged возвращается, если файл трека заменили, пока готовились изменения
+var ErrTrackChanged = errs.New(errs.ErrConflict, "track was changed by another request, try again")
+
+// TrackMetadata — изменяемые поля трека; nil оставляет поле как есть
+type TrackMetadata struct {
+	Name        *string
+	Artist      *string
+	Album       *string
+	Genre       *string
+	TrackNumber *int
+	Year        *int
+}
+
+func (m *TrackMetadata) validate() error {
+	for _, s := range []*string{m.Name, m.Artist, m.Album, m.Genre} {
+		if s != nil {
+			*s = strings.TrimSpace(*s)
+		}
+	}
+	if m.Name != nil && *m.Name == "" {
+		return errs.Validation("name must not be empty")
+	}
+	if m.TrackNumber != nil && (*m.TrackNumber < 0 || *m.TrackNumber > 9999) {
+		return errs.Validation("track_number must be between 0 and 9999")
+	}
+	if m.Year != nil && (*m.Year < 0 || *m.Year > 9999) {
+		return errs.Validation("year must be between 0 and 9999")
+	}
+	return nil
+}
+
+func (m TrackMetadata) apply(track *models.TrackDB) {
+	if m.Name != nil {
+		track.Name = *m.Name
+	}
+	if m.Artist != nil {
+		track.Artist = *m.Artist
+	}
+	if m.Album != nil {
+		track.Album = *m.Album
+	}
+	if m.Genre != nil {
+		track.Genre = *m.Genre
+	}
+	if m.TrackNumber != nil {
+		track.TrackNumber = *m.TrackNumber
+	}
+	if m.Year != nil {
+		track.Year = *m.Year
+	}
+}
+
+// fileTags — теги для transcode.Retag; нулевые номер трека и год не записываются
+func fileTags(track models.TrackDB) map[string]string {
+	tags := map[string]string{
+		"title":        track.Name,
+		"artist":       track.Artist,
+		"album":        track.Album,
+		"album_artist": track.AlbumArtist,
+		"genre":        track.Genre,
+	}
+	if track.TrackNumber > 0 {
+		tags["track"] = strconv.Itoa(track.TrackNumber)
+	}
+	if track.Year > 0 {
+		tags["date"] = strconv.Itoa(track.Year)
+	}
+	return tags
+}
+
+// retaggedFile — копия файла трека с новыми тегами, подготовленная до транзакции
+type retaggedFile struct {
+	path   string
+	digest string
+	size   int64
+}
+
+// retagFile скачивает файл трека во временный каталог и записывает в копию теги из track.
+// Вызывающий удаляет каталог filepath.Dir(path).
+func retagFile(ctx context.Context, track models.TrackDB) (retaggedFile, error) {
+	dir, err := os.MkdirTemp("", "aumusic-retag-*")
+	if err != nil {
+		return retaggedFile{}, err
+	}
+	result := retaggedFile{path: filepath.Join(dir, "out")}
+	err = func() error {
+		src, err := Storage.OpenRange(ctx, track.Path, 0, -1)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		in, err := os.Create(filepath.Join(dir, "in"))
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		if _, err = io.Copy(in, src); err != nil {
+			return err
+		}
+		if err = Transcoder.Retag(ctx, in.Name(), result.path, track.MimeType, fileTags(track)); err != nil {
+			return err
+		}
+
+		out, err := os.Open(result.path)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		h := sha256.New()
+		if result.size, err = io.Copy(h, out); err != nil {
+			return err
+		}
+		result.digest = hex.EncodeToString(h.Sum(nil))
+		return nil
+	}()
+	if err != nil {
+		os.RemoveAll(dir)
+		return retaggedFile{}, err
+	}
+	return result, nil
+}
+
+// trackEdit — изменение одного трека внутри транзакции editTracks
+type trackEdit struct {
+	old   models.TrackDB
+	track models.TrackDB
+	file  *retaggedFile
+}
+
+// editTracks сохраняет изменения треков одной транзакцией. Для треков с перезаписанными тегами
+// новый файл становится отдельным blob, а прежний освобождается, как при удалении трека.
+func editTracks(ctx context.Context, edits []trackEdit) ([]models.Track, error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Новые объекты удаляются, если транзакция не дойдет до коммита
+	var created, released []string
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		for _, key := range created {
+			if err := Storage.Delete(ctx, key); err != nil {
+				logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove object", zap.Error(err))
+			}
+		}
+	}()
+
+	tracks := make([]models.Track, 0, len(edits))
+	for _, edit := range edits {
+		track := edit.track
+		// Если теги в файле уже совпадали, содержимое не изменилось и blob остается прежним
+		replace := edit.file != nil && edit.file.digest != edit.old.Hash
+		if replace {
+			track.Hash, track.Size = edit.file.digest, edit.file.size
+			isNew, err := acquireFile(ctx, tx, &track, edit.file.path)
+			if err != nil {
+				return nil, err
+			}
+			if isNew {
+				created = append(created, track.Path)
+			}
+		}
+
+		var previous models.TrackDB
+		track, previous, err = repo.UpdateTrack(ctx, tx, track)
+		if err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to update track", zap.Error(err))
+			return nil, err
+		}
+		// Файл трека успел заменить параллельный запрос, а изменения посчитаны от прежнего
+		if previous.Hash != edit.old.Hash || previous.Path != edit.old.Path {
+			return nil, ErrTrackChanged
+		}
+		tracks = append(tracks, trackFromDB(track))
+
+		if !replace {
+			continue
+		}
+		// Прежний файл трека, загруженного до появления blobs, больше никому не нужен
+		unused := previous.Hash == ""
+		if !unused {
+			if unused, err = repo.ReleaseBlob(ctx, tx, previous.Hash); err != nil {
+				logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to release blob", zap.Error(err))
+				return nil, err
+			}
+		}
+		if unused {
+			released = append(released, previous.Path)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit track update", zap.Error(err))
+		return nil, err
+	}
+	committed = true
+
+	// Как и в DeleteTrack, освободившиеся объекты удаляются только после коммита
+	for _, key := range released {
+		if err = Storage.Delete(ctx, key); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove object", zap.Error(err))
+		}
+	}
+	for _, edit := range edits {
+		if edit.file == nil {
+			continue
+		}
+		// Рендиции перекодируются заново, чтобы в них попали новые теги
+		if err = deleteRenditions(ctx, edit.track.Id); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove renditions", zap.Error(err))
+		}
+	}
+	return tracks, nil
+}
+
+// acquireFile регистрирует файл как blob с хэшем track.Hash, записывает его в track.Path
+// и, если такого содержимого еще не было, загружает его в хранилище
+func acquireFile(ctx context.Context, tx repo.DB, track *models.TrackDB, name string) (bool, error) {
+	var isNew bool
+	var err error
+	blob := models.Blob{Hash: track.Hash, Path: blobKey(track.Hash), Size: track.Size, MimeType: track.MimeType}
+	track.Path, isNew, err = repo.AcquireBlob(ctx, tx, blob)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Error acquiring blob", zap.Error(err))
+		return false, err
+	}
+	if !isNew {
+		return false, nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if err = Storage.Put(ctx, track.Path, file, track.Size, track.MimeType); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Error saving file", zap.Error(err))
+		return false, err
+	}
+	return true, nil
+}
+
+// prepareEdits применяет изменения к трекам и при writeTags готовит файлы с новыми тегами.
+// Временные каталоги удаляет возвращаемая функция cleanup.
+func prepareEdits(ctx context.Context, tracks []models.TrackDB, meta TrackMetadata, writeTags bool) ([]trackEdit, func(), error) {
+	edits := make([]trackEdit, len(tracks))
+	cleanup := func() {
+		for _, edit := range edits {
+			if edit.file != nil {
+				os.RemoveAll(filepath.Dir(edit.file.path))
+			}
+		}
+	}
+
+	if writeTags {
+		for _, track := range tracks {
+			if !transcode.CanRetag(track.MimeType) {
+				return nil, cleanup, errs.Validation("tags cannot be written to " + track.MimeType + " files")
+			}
+		}
+	}
+	for i, track := range tracks {
+		edits[i] = trackEdit{old: track, track: track}
+		meta.apply(&edits[i].track)
+		if !writeTags {
+			continue
+		}
+		file, err := retagFile(ctx, edits[i].track)
+		if err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to write tags", zap.String("track", track.Id), zap.Error(err))
+			return nil, cleanup, err
+		}
+		edits[i].file = &file
+	}
+	return edits, cleanup, nil
+}
+
+// UpdateTrack меняет метаданные трека пользователя. При writeTags новые значения
+// записываются и в теги самого файла.
+func UpdateTrack(ctx context.Context, userId, id string, meta TrackMetadata, writeTags bool) (models.Track, error) {
+	if err := meta.validate(); err != nil {
+		return models.Track{}, err
+	}
+	track, err := ownTrack(ctx, userId, id)
+	if err != nil {
+		return models.Track{}, err
+	}
+
+	edits, cleanup, err := prepareEdits(ctx, []models.TrackDB{track}, meta, writeTags)
+	defer cleanup()
+	if err != nil {
+		return models.Track{}, err
+	}
+	tracks, err := editTracks(ctx, edits)
+	if err != nil {
+		return models.Track{}, err
+	}
+	return tracks[0], nil
+}
+
+// UpdateAlbumTracks применяет одни и те же изменения ко всем трекам альбома одной транзакцией.
+// Название и номер трека у каждого свои, поэтому менять их для всего альбома нельзя.
+func UpdateAlbumTracks(ctx context.Context, userId, albumId string, meta TrackMetadata, writeTags bool) ([]models.Track, error) {
+	if meta.Name != nil || meta.TrackNumber != nil {
+		return nil, errs.Validation("name and track_number cannot be set for a whole album")
+	}
+	if err := meta.validate(); err != nil {
+		return nil, err
+	}
+	albumTracks, err := GetAlbumTracks(ctx, userId, albumId)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make([]models.TrackDB, len(albumTracks))
+	for i, albumTrack := range albumTracks {
+		tracks[i], err = repo.GetTrack(ctx, Pool, albumTrack.Id)
+		if err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get track", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	edits, cleanup, err := prepareEdits(ctx, tracks, meta, writeTags)
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+	return editTracks(ctx, edits)
+}
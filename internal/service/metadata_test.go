@@ -0,0 +1,38 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestTrackMetadata(t *testing.T) {
+	name, artist, year := "  Time ", "Pink Floyd", 1973
+	meta := TrackMetadata{Name: &name, Artist: &artist, Year: &year}
+	if err := meta.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	track := models.TrackDB{Name: "Tiem", Artist: "Pink Flyod", Album: "The Dark Side of the Moon", TrackNumber: 4}
+	meta.apply(&track)
+	want := models.TrackDB{Name: "Time", Artist: "Pink Floyd", Album: "The Dark Side of the Moon", TrackNumber: 4, Year: 1973}
+	if track != want {
+		t.Fatalf("получено %+v, ожидалось %+v", track, want)
+	}
+	wantTags := map[string]string{
+		"title": "Time", "artist": "Pink Floyd", "album": "The Dark Side of the Moon", "album_artist": "", "genre": "",
+		"track": "4", "date": "1973",
+	}
+	if tags := fileTags(track); !maps.Equal(tags, wantTags) {
+		t.Fatalf("теги %v, ожидалось %v", tags, wantTags)
+	}
+
+	blank, negative := " ", -1
+	for _, meta := range []TrackMetadata{{Name: &blank}, {TrackNumber: &negative}, {Year: &negative}} {
+		if err := meta.validate(); !errors.Is(err, errs.ErrValidation) {
+			t.Errorf("%+v: ожидалась ошибка валидации, получено %v", meta, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/hash"
+	"aumusic/pkg/logger"
+	"aumusic/pkg/oidc"
+
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// OIDC — провайдер единого входа; nil, если вход через провайдера не настроен
+var OIDC *oidc.Provider
+
+const (
+	// oidcLoginTTL — сколько пользователь может провести на странице входа провайдера
+	oidcLoginTTL      = 10 * time.Minute
+	oidcLoginAudience = "oidc-login"
+	maxUsernameLength = 32
+)
+
+var (
+	ErrOIDCDisabled = errs.NotFound("single sign-on is not configured", nil)
+	// ErrOIDCEmailTaken — в aumusic уже есть пользователь с этим email, но адрес не подтвердил
+	// провайдер или сам пользователь aumusic, поэтому привязать к нему вход нельзя
+	ErrOIDCEmailTaken = errs.Conflict("an account with this email already exists, sign in with its password", nil)
+	ErrOIDCNoEmail    = errs.Validation("identity provider did not share an email address")
+)
+
+// oidcLoginClaims — состояние входа между переходом к провайдеру и возвратом от него.
+// Хранится в cookie браузера, подписанное JWTSecret.
+type oidcLoginClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// BeginOIDCLogin начинает вход через провайдера. Возвращает адрес его страницы входа и состояние,
+// которое нужно вернуть в FinishOIDCLogin.
+func BeginOIDCLogin(ctx context.Context) (string, string, error) {
+	if OIDC == nil {
+		return "", "", ErrOIDCDisabled
+	}
+	var login oidcLoginClaims
+	var err error
+	if login.State, err = oidc.NewState(); err != nil {
+		return "", "", err
+	}
+	if login.Nonce, err = oidc.NewState(); err != nil {
+		return "", "", err
+	}
+	if login.Verifier, err = oidc.NewCodeVerifier(); err != nil {
+		return "", "", err
+	}
+
+	authURL, err := OIDC.AuthCodeURL(ctx, login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to build oidc login url", zap.Error(err))
+		return "", "", err
+	}
+	stateToken, err := signOIDCLogin(ctx, login, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, stateToken, nil
+}
+
+func signOIDCLogin(ctx context.Context, login oidcLoginClaims, now time.Time) (string, error) {
+	login.RegisteredClaims = jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{oidcLoginAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(oidcLoginTTL)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, login).SignedString([]byte(getConfig(ctx).JWTSecret))
+}
+
+// parseOIDCLogin проверяет состояние входа; audience не дает выдать за него access-токен
+func parseOIDCLogin(ctx context.Context, stateToken string) (oidcLoginClaims, error) {
+	var login oidcLoginClaims
+	_, err := jwt.ParseWithClaims(stateToken, &login, func(t *jwt.Token) (interface{}, error) {
+		return []byte(getConfig(ctx).JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(oidcLoginAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return oidcLoginClaims{}, err
+	}
+	return login, nil
+}
+
+// FinishOIDCLogin завершает вход: сверяет state, меняет code на ID-токен и открывает сессию
+// пользователя, при первом входе создавая его или привязывая к учетной записи с тем же email.
+// Провайдер заменяет только пароль: если у пользователя включен второй фактор, вместо токенов
+// возвращается challenge для LoginTwoFactor, как в LoginUser.
+func FinishOIDCLogin(ctx context.Context, stateToken, state, code string) (AuthTokens, string, error) {
+	if OIDC == nil {
+		return AuthTokens{}, "", ErrOIDCDisabled
+	}
+	login, err := parseOIDCLogin(ctx, stateToken)
+	if err != nil {
+		return AuthTokens{}, "", errs.Wrap(errs.ErrUnauthenticated, "single sign-on login expired, try again", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(login.State)) != 1 {
+		return AuthTokens{}, "", errs.Wrap(errs.ErrUnauthenticated, "single sign-on login expired, try again", errors.New("state mismatch"))
+	}
+
+	claims, err := OIDC.Exchange(ctx, code, login.Verifier, login.Nonce)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to exchange oidc code", zap.Error(err))
+		return AuthTokens{}, "", errs.Wrap(errs.ErrUnauthenticated, "single sign-on login failed", err)
+	}
+	user, err := oidcUser(ctx, OIDC.Issuer(), claims)
+	if err != nil {
+		return AuthTokens{}, "", err
+	}
+	return completeLogin(ctx, user)
+}
+
+// oidcUser находит пользователя по учетной записи у провайдера. При первом входе привязывает ее
+// к пользователю с тем же email, если адрес подтвержден и провайдером, и в aumusic, а иначе создает нового.
+func oidcUser(ctx context.Context, issuer string, claims oidc.Claims) (models.User, error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
+		return models.User{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	user, err := repo.GetUserByIdentity(ctx, tx, issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, errs.ErrNotFound) {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get user by identity", zap.Error(err))
+		return models.User{}, err
+	}
+	if claims.Email == "" {
+		return models.User{}, ErrOIDCNoEmail
+	}
+
+	user, err = repo.GetUserByEmail(ctx, tx, claims.Email)
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		user, err = createOIDCUser(ctx, tx, claims)
+		if err != nil {
+			return models.User{}, err
+		}
+	case err != nil:
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get user by email", zap.Error(err))
+		return models.User{}, err
+	default:
+		// Адрес должны подтвердить обе стороны: иначе можно заранее зарегистрироваться с чужим
+		// email и получить доступ к учетной записи, когда владелец адреса войдет через провайдера
+		if !claims.EmailVerified {
+			return models.User{}, ErrOIDCEmailTaken
+		}
+		verified, err := repo.EmailVerified(ctx, tx, user.Id)
+		if err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get email status", zap.Error(err))
+			return models.User{}, err
+		}
+		if !verified {
+			return models.User{}, ErrOIDCEmailTaken
+		}
+	}
+
+	// Провайдер уже подтвердил адрес, письмо со ссылкой не нужно
+	if claims.EmailVerified {
+		if _, err = repo.SetEmailVerified(ctx, tx, user.Id, claims.Email); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to mark email verified", zap.Error(err))
+			return models.User{}, err
+		}
+	}
+	if err = repo.LinkIdentity(ctx, tx, user.Id, issuer, claims.Subject, claims.Email); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to link identity", zap.Error(err))
+		return models.User{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit identity", zap.Error(err))
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// createOIDCUser создает пользователя без пароля: войти он может только через провайдера.
+// Если имя занято, пробует его с числом, а затем со случайным суффиксом.
+func createOIDCUser(ctx context.Context, db repo.DB, claims oidc.Claims) (models.User, error) {
+	base := oidcUsername(claims)
+	candidates := []string{base}
+	for i := 2; i < 10; i++ {
+		candidates = append(candidates, base+strconv.Itoa(i))
+	}
+	suffix, err := hash.NewToken(4)
+	if err != nil {
+		return models.User{}, err
+	}
+	candidates = append(candidates, base+"-"+strings.ToLower(suffix))
+
+	for _, username := range candidates {
+		user, ok, err := repo.CreateUserIfFree(ctx, db, models.User{Username: username, Email: claims.Email})
+		if err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to create user", zap.Error(err))
+			return models.User{}, err
+		}
+		if ok {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrUserExists
+}
+
+// oidcUsername выбирает имя нового пользователя: preferred_username, начало email или name,
+// оставляя только буквы, цифры и знаки . _ -
+func oidcUsername(claims oidc.Claims) string {
+	local, _, _ := strings.Cut(claims.Email, "@")
+	for _, name := range []string{claims.PreferredUsername, local, claims.Name} {
+		username := strings.Map(func(r rune) rune {
+			switch {
+			case unicode.IsLetter(r), unicode.IsDigit(r), r == '.', r == '_', r == '-':
+				return r
+			case unicode.IsSpace(r):
+				return '.'
+			}
+			return -1
+		}, strings.TrimSpace(name))
+		username = strings.Trim(username, ".-_")
+		if runes := []rune(username); len(runes) > maxUsernameLength {
+			username = string(runes[:maxUsernameLength])
+		}
+		if username != "" {
+			return username
+		}
+	}
+	return "user"
+}
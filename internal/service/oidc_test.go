@@ -0,0 +1,107 @@
+package service
+
+import (
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/oidc"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOIDCUsername(t *testing.T) {
+	tests := []struct {
+		claims oidc.Claims
+		want   string
+	}{
+		{oidc.Claims{PreferredUsername: "alice", Email: "a@example.com"}, "alice"},
+		{oidc.Claims{Email: "a.smith@example.com"}, "a.smith"},
+		{oidc.Claims{PreferredUsername: "<>", Name: " Анна Иванова "}, "Анна.Иванова"},
+		{oidc.Claims{Email: "@example.com"}, "user"},
+		{oidc.Claims{PreferredUsername: "abcdefghijklmnopqrstuvwxyz0123456789"}, "abcdefghijklmnopqrstuvwxyz012345"},
+	}
+	for _, tt := range tests {
+		if got := oidcUsername(tt.claims); got != tt.want {
+			t.Errorf("%+v: получено %q, ожидалось %q", tt.claims, got, tt.want)
+		}
+	}
+}
+
+func TestOIDCLoginState(t *testing.T) {
+	ctx := testContext()
+	login := oidcLoginClaims{State: "state-1", Nonce: "nonce-1", Verifier: "verifier-1"}
+
+	token, err := signOIDCLogin(ctx, login, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseOIDCLogin(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Verifier != "verifier-1" {
+		t.Fatalf("verifier %q", parsed.Verifier)
+	}
+
+	expired, err := signOIDCLogin(ctx, login, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parseOIDCLogin(ctx, expired); err == nil {
+		t.Fatal("просроченное состояние входа принято")
+	}
+
+	// Access-токен подписан тем же секретом, но состоянием входа не считается
+	access, _, err := signAccessToken(ctx, models.Session{Id: "session-1", UserId: "user-1"}, "alice", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parseOIDCLogin(ctx, access); err == nil {
+		t.Fatal("access-токен принят как состояние входа")
+	}
+}
+
+func TestOIDCUserLinking(t *testing.T) {
+	ctx := testDB(t)
+	user := testUser(t, ctx, &recordingSender{})
+	issuer := "https://idp.example.com"
+	claims := oidc.Claims{Subject: "sub-" + user.Username, Email: user.Email, EmailVerified: true}
+
+	// Email зарегистрирован, но не подтвержден: вход через провайдера не должен получить доступ к учетной записи
+	if _, err := oidcUser(ctx, issuer, claims); !errors.Is(err, ErrOIDCEmailTaken) {
+		t.Fatalf("ожидалась ErrOIDCEmailTaken, получено %v", err)
+	}
+	if _, err := repo.SetEmailVerified(ctx, Pool, user.Id, user.Email); err != nil {
+		t.Fatal(err)
+	}
+	unverified := claims
+	unverified.EmailVerified = false
+	if _, err := oidcUser(ctx, issuer, unverified); !errors.Is(err, ErrOIDCEmailTaken) {
+		t.Fatalf("ожидалась ErrOIDCEmailTaken без подтверждения провайдера, получено %v", err)
+	}
+
+	linked, err := oidcUser(ctx, issuer, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.Id != user.Id {
+		t.Fatalf("вход привязан к %s, ожидался %s", linked.Id, user.Id)
+	}
+	// Повторный вход находит пользователя по учетной записи провайдера, даже если email у нее сменился
+	claims.Email = "other-" + user.Email
+	again, err := oidcUser(ctx, issuer, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Id != user.Id {
+		t.Fatalf("повторный вход дал пользователя %s, ожидался %s", again.Id, user.Id)
+	}
+
+	created, err := oidcUser(ctx, issuer, oidc.Claims{Subject: "sub-new-" + user.Username, Email: "new-" + user.Email, PreferredUsername: user.Username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id == user.Id || created.Username == user.Username {
+		t.Fatalf("для нового email ожидался новый пользователь, получен %+v", created)
+	}
+}
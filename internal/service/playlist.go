@@ -0,0 +1,162 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/logger"
+
+	"context"
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ErrPlaylistExists возвращается, если у пользователя уже есть плейлист с таким названием
+var ErrPlaylistExists = errs.New(errs.ErrConflict, "playlist with this name already exists")
+
+// ownPlaylist загружает плейлист и проверяет, что он принадлежит пользователю userId
+func ownPlaylist(ctx context.Context, userId, id string) (models.Playlist, error) {
+	playlist, err := repo.GetPlaylist(ctx, Pool, id)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get playlist", zap.Error(err))
+		return models.Playlist{}, err
+	}
+	if userId != playlist.UserId {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "User is not owner of playlist")
+		return models.Playlist{}, ErrNotOwner
+	}
+
+	return playlist, nil
+}
+
+func CreatePlaylist(ctx context.Context, userId, name string) (models.Playlist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return models.Playlist{}, errs.Validation("playlist name is required")
+	}
+
+	playlist := models.Playlist{UserId: userId, Name: name}
+	var err error
+	playlist.Id, err = repo.CreatePlaylist(ctx, Pool, playlist)
+	if errors.Is(err, errs.ErrConflict) {
+		return models.Playlist{}, ErrPlaylistExists
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to create playlist", zap.Error(err))
+		return models.Playlist{}, err
+	}
+	return playlist, nil
+}
+
+func GetPlaylists(ctx context.Context, userId string) ([]models.Playlist, error) {
+	playlists, err := repo.GetPlaylists(ctx, Pool, userId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get playlists", zap.Error(err))
+		return nil, err
+	}
+	return playlists, nil
+}
+
+func GetPlaylist(ctx context.Context, userId, id string) (models.Playlist, error) {
+	playlist, err := ownPlaylist(ctx, userId, id)
+	if err != nil {
+		return models.Playlist{}, err
+	}
+
+	playlist.Entries, err = repo.GetPlaylistEntries(ctx, Pool, id)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get playlist tracks", zap.Error(err))
+		return models.Playlist{}, err
+	}
+	return playlist, nil
+}
+
+func RenamePlaylist(ctx context.Context, userId, id, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errs.Validation("playlist name is required")
+	}
+
+	if _, err := ownPlaylist(ctx, userId, id); err != nil {
+		return err
+	}
+
+	err := repo.RenamePlaylist(ctx, Pool, id, name)
+	if errors.Is(err, errs.ErrConflict) {
+		return ErrPlaylistExists
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to rename playlist", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func DeletePlaylist(ctx context.Context, userId, id string) error {
+	if _, err := ownPlaylist(ctx, userId, id); err != nil {
+		return err
+	}
+
+	err := repo.DeletePlaylist(ctx, Pool, id)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to delete playlist", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// AddTrackToPlaylist вставляет трек на позицию position, отрицательная позиция означает конец плейлиста.
+// Один и тот же трек может встречаться в плейлисте несколько раз.
+func AddTrackToPlaylist(ctx context.Context, userId, id, trackId string, position int) (models.PlaylistEntry, error) {
+	playlist, err := ownPlaylist(ctx, userId, id)
+	if err != nil {
+		return models.PlaylistEntry{}, err
+	}
+
+	track, err := repo.GetTrack(ctx, Pool, trackId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get track", zap.Error(err))
+		return models.PlaylistEntry{}, err
+	}
+	if track.UserId != playlist.UserId {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "User is not owner of track")
+		return models.PlaylistEntry{}, ErrNotOwner
+	}
+
+	entry, err := repo.AddTrackToPlaylist(ctx, Pool, id, trackId, position)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to add track to playlist", zap.Error(err))
+		return models.PlaylistEntry{}, err
+	}
+	entry.Track = trackFromDB(track)
+	return entry, nil
+}
+
+func RemovePlaylistEntry(ctx context.Context, userId, id, entryId string) error {
+	if _, err := ownPlaylist(ctx, userId, id); err != nil {
+		return err
+	}
+
+	err := repo.RemovePlaylistEntry(ctx, Pool, id, entryId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove playlist entry", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// MovePlaylistEntry переносит запись на новую позицию и возвращает фактическую позицию после перемещения
+func MovePlaylistEntry(ctx context.Context, userId, id, entryId string, position int) (int, error) {
+	if _, err := ownPlaylist(ctx, userId, id); err != nil {
+		return 0, err
+	}
+
+	position, err := repo.MovePlaylistEntry(ctx, Pool, id, entryId, position)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to move playlist entry", zap.Error(err))
+		return 0, err
+	}
+	return position, nil
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// playlistTracks возвращает id треков плейлиста по порядку и проверяет, что позиции идут подряд с нуля
+func playlistTracks(t *testing.T, ctx context.Context, userId, id string) ([]string, []models.PlaylistEntry) {
+	t.Helper()
+	playlist, err := GetPlaylist(ctx, userId, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tracks []string
+	for i, entry := range playlist.Entries {
+		if entry.Position != i {
+			t.Fatalf("запись %d стоит на позиции %d", i, entry.Position)
+		}
+		tracks = append(tracks, entry.Track.Id)
+	}
+	return tracks, playlist.Entries
+}
+
+func TestPlaylists(t *testing.T) {
+	ctx := testDB(t)
+	user := testUser(t, ctx, &recordingSender{})
+	other := testUser(t, ctx, &recordingSender{})
+
+	if _, err := CreatePlaylist(ctx, user.Id, "  "); !errors.Is(err, errs.ErrValidation) {
+		t.Fatalf("плейлист без названия: %v", err)
+	}
+	playlist, err := CreatePlaylist(ctx, user.Id, " Morning ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Name != "Morning" {
+		t.Fatalf("название не обрезано: %q", playlist.Name)
+	}
+	if _, err = CreatePlaylist(ctx, user.Id, "Morning"); !errors.Is(err, ErrPlaylistExists) {
+		t.Fatalf("повторное название: %v", err)
+	}
+	// Названия уникальны только в пределах пользователя
+	if _, err = CreatePlaylist(ctx, other.Id, "Morning"); err != nil {
+		t.Fatal(err)
+	}
+	evening, err := CreatePlaylist(ctx, user.Id, "Evening")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = RenamePlaylist(ctx, user.Id, evening.Id, "Morning"); !errors.Is(err, ErrPlaylistExists) {
+		t.Fatalf("переименование в занятое название: %v", err)
+	}
+	if err = RenamePlaylist(ctx, user.Id, evening.Id, "Night"); err != nil {
+		t.Fatal(err)
+	}
+
+	playlists, err := GetPlaylists(ctx, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range playlists {
+		names = append(names, p.Name)
+	}
+	if want := []string{"Morning", "Night"}; !slices.Equal(names, want) {
+		t.Fatalf("плейлисты пользователя %v, ожидались %v", names, want)
+	}
+
+	// Чужой плейлист нельзя ни прочитать, ни изменить, и в свой нельзя добавить чужой трек
+	track := testTrack(t, ctx, user.Id)
+	foreign := testTrack(t, ctx, other.Id)
+	if _, err = GetPlaylist(ctx, other.Id, playlist.Id); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("чтение чужого плейлиста: %v", err)
+	}
+	if err = RenamePlaylist(ctx, other.Id, playlist.Id, "Stolen"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("переименование чужого плейлиста: %v", err)
+	}
+	if _, err = AddTrackToPlaylist(ctx, other.Id, playlist.Id, foreign.Id, -1); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("добавление в чужой плейлист: %v", err)
+	}
+	if _, err = AddTrackToPlaylist(ctx, user.Id, playlist.Id, foreign.Id, -1); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("добавление чужого трека: %v", err)
+	}
+	entry, err := AddTrackToPlaylist(ctx, user.Id, playlist.Id, track.Id, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = RemovePlaylistEntry(ctx, other.Id, playlist.Id, entry.Id); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("удаление записи чужого плейлиста: %v", err)
+	}
+	if _, err = MovePlaylistEntry(ctx, other.Id, playlist.Id, entry.Id, 0); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("перенос записи чужого плейлиста: %v", err)
+	}
+	if err = DeletePlaylist(ctx, other.Id, playlist.Id); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("удаление чужого плейлиста: %v", err)
+	}
+
+	if err = DeletePlaylist(ctx, user.Id, playlist.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetPlaylist(ctx, user.Id, playlist.Id); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("удаленный плейлист: %v", err)
+	}
+}
+
+func TestPlaylistEntries(t *testing.T) {
+	ctx := testDB(t)
+	user := testUser(t, ctx, &recordingSender{})
+	a, b, c := testTrack(t, ctx, user.Id), testTrack(t, ctx, user.Id), testTrack(t, ctx, user.Id)
+	playlist, err := CreatePlaylist(ctx, user.Id, "mix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, add := range []struct {
+		track    string
+		position int
+		want     int
+	}{
+		{a.Id, -1, 0},
+		{b.Id, -1, 1},
+		{c.Id, 0, 0},
+		// Позиция за концом плейлиста означает конец, один трек может встречаться дважды
+		{a.Id, 100, 3},
+	} {
+		entry, err := AddTrackToPlaylist(ctx, user.Id, playlist.Id, add.track, add.position)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Position != add.want || entry.Track.Id != add.track {
+			t.Fatalf("трек добавлен на позицию %d вместо %d", entry.Position, add.want)
+		}
+	}
+	tracks, entries := playlistTracks(t, ctx, user.Id, playlist.Id)
+	if want := []string{c.Id, a.Id, b.Id, a.Id}; !slices.Equal(tracks, want) {
+		t.Fatalf("после добавления порядок %v, ожидался %v", tracks, want)
+	}
+
+	position, err := MovePlaylistEntry(ctx, user.Id, playlist.Id, entries[0].Id, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position != 3 {
+		t.Fatalf("запись перенесена на позицию %d вместо последней", position)
+	}
+	tracks, entries = playlistTracks(t, ctx, user.Id, playlist.Id)
+	if want := []string{a.Id, b.Id, a.Id, c.Id}; !slices.Equal(tracks, want) {
+		t.Fatalf("после переноса в конец порядок %v, ожидался %v", tracks, want)
+	}
+
+	if position, err = MovePlaylistEntry(ctx, user.Id, playlist.Id, entries[1].Id, 0); err != nil {
+		t.Fatal(err)
+	}
+	if position != 0 {
+		t.Fatalf("запись перенесена на позицию %d вместо 0", position)
+	}
+	tracks, entries = playlistTracks(t, ctx, user.Id, playlist.Id)
+	if want := []string{b.Id, a.Id, a.Id, c.Id}; !slices.Equal(tracks, want) {
+		t.Fatalf("после переноса в начало порядок %v, ожидался %v", tracks, want)
+	}
+
+	if err = RemovePlaylistEntry(ctx, user.Id, playlist.Id, entries[1].Id); err != nil {
+		t.Fatal(err)
+	}
+	tracks, _ = playlistTracks(t, ctx, user.Id, playlist.Id)
+	if want := []string{b.Id, a.Id, c.Id}; !slices.Equal(tracks, want) {
+		t.Fatalf("после удаления записи порядок %v, ожидался %v", tracks, want)
+	}
+}
+
+func TestPlaylistTrackDeleted(t *testing.T) {
+	ctx := testDB(t)
+	user := testUser(t, ctx, &recordingSender{})
+	a, b, c := testTrack(t, ctx, user.Id), testTrack(t, ctx, user.Id), testTrack(t, ctx, user.Id)
+	playlist, err := CreatePlaylist(ctx, user.Id, "mix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, track := range []string{a.Id, b.Id, a.Id, c.Id} {
+		if _, err = AddTrackToPlaylist(ctx, user.Id, playlist.Id, track, -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Записи удаленного трека пропадают из плейлиста, а позиции остальных сдвигаются без пропусков
+	if err = DeleteTrack(ctx, user.Id, a.Id); err != nil {
+		t.Fatal(err)
+	}
+	tracks, entries := playlistTracks(t, ctx, user.Id, playlist.Id)
+	if want := []string{b.Id, c.Id}; !slices.Equal(tracks, want) {
+		t.Fatalf("после удаления трека порядок %v, ожидался %v", tracks, want)
+	}
+
+	position, err := MovePlaylistEntry(ctx, user.Id, playlist.Id, entries[0].Id, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position != 1 {
+		t.Fatalf("запись перенесена на позицию %d вместо последней", position)
+	}
+	tracks, _ = playlistTracks(t, ctx, user.Id, playlist.Id)
+	if want := []string{c.Id, b.Id}; !slices.Equal(tracks, want) {
+		t.Fatalf("после переноса порядок %v, ожидался %v", tracks, want)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/logger"
+
+	"context"
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 200
+)
+
+// searchQuery превращает строку поиска в запрос to_tsquery, где каждое слово ищется по префиксу:
+// "Pink Flo" -> "pink:* & flo:*". Знаки препинания и операторы tsquery отбрасываются.
+func searchQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// SearchTracks ищет по названию, артисту и альбому среди треков пользователя.
+// fuzzy добавляет к полнотекстовому поиску триграммное сравнение, устойчивое к опечаткам.
+// limit <= 0 означает DefaultSearchLimit.
+func SearchTracks(ctx context.Context, userId, text string, fuzzy bool, limit int) ([]models.Track, error) {
+	query := searchQuery(text)
+	if query == "" {
+		return nil, errs.Validation("search query must contain at least one letter or digit")
+	}
+	switch {
+	case limit <= 0:
+		limit = DefaultSearchLimit
+	case limit > MaxSearchLimit:
+		limit = MaxSearchLimit
+	}
+
+	tracks, err := repo.SearchTracks(ctx, Pool, userId, query, strings.TrimSpace(text), fuzzy, limit)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to search tracks", zap.Error(err))
+		return nil, err
+	}
+	return tracks, nil
+}
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestSearchQuery(t *testing.T) {
+	cases := map[string]string{
+		"Pink Flo":             "pink:* & flo:*",
+		"  AC/DC  ":            "ac:* & dc:*",
+		"Кино — Группа крови":  "кино:* & группа:* & крови:*",
+		"road & !rock | (x):*": "road:* & rock:* & x:*",
+		"2001":                 "2001:*",
+		" -- ":                 "",
+	}
+	for text, want := range cases {
+		if got := searchQuery(text); got != want {
+			t.Errorf("searchQuery(%q) = %q, ожидалось %q", text, got, want)
+		}
+	}
+}
@@ -1,135 +1,180 @@
 package service
 
 import (
-	"aumusic/internal/config"
+	"aumusic/internal/errs"
 	"aumusic/internal/models"
 	"aumusic/internal/repo"
 	"aumusic/pkg/hash"
 	"aumusic/pkg/logger"
+	"aumusic/pkg/storage"
+	"aumusic/pkg/tag"
 
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
+	"path"
+	"regexp"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/minio/minio-go/v7"
 	"go.uber.org/zap"
 )
 
 const (
-	MEDIA         = "/app/media/"
-	MUSIC         = "/app/media/music/"
 	MaxUploadSize = 500 << 20
 )
 
 var (
-	Pool  *pgxpool.Pool
-	MinIO *minio.Client
+	Pool    *pgxpool.Pool
+	Storage storage.Storage
 )
 
+// ValidToken проверяет подпись и срок access-токена и то, что его сессия не отозвана,
+// и возвращает имя и id пользователя. Ошибки проверки токена имеют вид errs.ErrUnauthenticated.
 func ValidToken(ctx context.Context, token string) (string, string, error) {
 	if token == "" {
-		return "", "", http.ErrServerClosed
+		return "", "", errs.Unauthenticated(errors.New("token is empty"))
 	}
-	t, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, http.ErrServerClosed
-		}
-		return []byte(ctx.Value("cfg").(*config.Config).JWTSecret), nil
-	})
+	claims, err := parseAccessToken(ctx, token)
+	if err != nil {
+		return "", "", errs.Unauthenticated(err)
+	}
+	active, err := repo.SessionActive(ctx, Pool, claims.SessionId)
 	if err != nil {
 		return "", "", err
 	}
-	if claims, ok := t.Claims.(jwt.MapClaims); ok && t.Valid {
-		return claims["username"].(string), claims["userid"].(string), nil
+	if !active {
+		return "", "", errs.Unauthenticated(ErrSessionRevoked)
 	}
-	return "", "", http.ErrServerClosed
+	return claims.Username, claims.UserId, nil
 }
 
-func GetTrack(ctx context.Context, token, id string) (io.ReadSeeker, int64, time.Time, error) {
+// ownTrack загружает трек и проверяет, что он принадлежит пользователю userId
+func ownTrack(ctx context.Context, userId, id string) (models.TrackDB, error) {
 	track, err := repo.GetTrack(ctx, Pool, id)
 	if err != nil {
 		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get track", zap.Error(err))
-		return nil, 0, time.Time{}, http.ErrServerClosed
-	}
-
-	_, ownerId, err := ValidToken(ctx, token)
-	if err != nil {
-		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to validate token", zap.Error(err))
-		return nil, 0, time.Time{}, err
+		return models.TrackDB{}, err
 	}
-	if ownerId != track.UserId {
-		return nil, 0, time.Time{}, http.ErrServerClosed
+	if userId != track.UserId {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "User is not owner of track")
+		return models.TrackDB{}, ErrNotOwner
 	}
 
-	file, err := os.Open(track.Path)
+	return track, nil
+}
+
+// GetTrack открывает трек пользователя и возвращает его вместе с MIME-типом, размером и временем изменения
+func GetTrack(ctx context.Context, userId, id string) (io.ReadSeekCloser, string, int64, time.Time, error) {
+	track, err := ownTrack(ctx, userId, id)
 	if err != nil {
-		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to open file", zap.Error(err))
-		return nil, 0, time.Time{}, err
+		return nil, "", 0, time.Time{}, err
 	}
 
-	fileInfo, err := file.Stat()
+	// Reader читает объект диапазонами по мере Seek/Read, что подходит для http.ServeContent
+	reader, object, err := storage.NewReader(ctx, Storage, track.Path)
 	if err != nil {
-		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to stat file", zap.Error(err))
-		return nil, 0, time.Time{}, err
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to open object", zap.Error(err))
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, "", 0, time.Time{}, errs.NotFound("track file not found", err)
+		}
+		return nil, "", 0, time.Time{}, err
 	}
-	fileSize := fileInfo.Size()
 
-	return file, fileSize, fileInfo.ModTime(), nil
+	return reader, track.MimeType, object.Size, object.ModTime, nil
 }
 
-func RegisterUser(ctx context.Context, r *http.Request) error {
-	username := r.FormValue("username")
-	email := r.FormValue("email")
-	password := r.FormValue("password")
+var (
+	// ErrInvalidCredentials возвращается при неизвестном пользователе или неверном пароле
+	ErrInvalidCredentials = errs.New(errs.ErrUnauthenticated, "invalid username or password")
+	// ErrUserExists возвращается, если имя пользователя или email уже заняты
+	ErrUserExists = errs.New(errs.ErrConflict, "username or email already taken")
+	// ErrNotOwner возвращается, если объект принадлежит другому пользователю
+	ErrNotOwner = errs.Forbidden("resource belongs to another user")
+)
+
+func RegisterUser(ctx context.Context, username, email, password string) error {
 	passHash, err := hash.GenerateHash(password, hash.DefaultArgon2Params)
 	if err != nil {
 		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to hash password", zap.Error(err))
 		return err
 	}
-	err = repo.NewUser(ctx, Pool, models.User{
+	user := models.User{
 		Username: username,
 		Email:    email,
 		Pass:     passHash,
-	})
+	}
+	user.Id, err = repo.NewUser(ctx, Pool, user)
+	if errors.Is(err, errs.ErrConflict) {
+		return ErrUserExists
+	}
 	if err != nil {
 		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to create user", zap.Error(err))
 		return err
 	}
+
+	// Пользователь уже создан: если письмо не ушло, его можно запросить повторно
+	if err = sendVerification(ctx, user); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to send verification email", zap.Error(err))
+	}
 	return nil
 }
 
-func LoginUser(ctx context.Context, r *http.Request) (string, error) {
-	username := r.FormValue("username")
-	pass := r.FormValue("password")
+// LoginUser проверяет пароль и открывает новую сессию пользователя. Если у пользователя включен
+// второй фактор, сессия не открывается: вместо токенов возвращается challenge для LoginTwoFactor.
+func LoginUser(ctx context.Context, username, pass string) (AuthTokens, string, error) {
 	user, err := repo.GetUser(ctx, Pool, username)
 	if err != nil {
 		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get user", zap.Error(err))
-		return "", err
+		if errors.Is(err, errs.ErrNotFound) {
+			return AuthTokens{}, "", ErrInvalidCredentials
+		}
+		return AuthTokens{}, "", err
 	}
 
 	if isValid, _ := hash.VerifyPassword(pass, user.Pass); !isValid {
-		return "", errors.New("invalid password")
+		return AuthTokens{}, "", ErrInvalidCredentials
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": user.Username,
-		"userid":   user.Id,
-	})
+	return completeLogin(ctx, user)
+}
 
-	tokenString, err := token.SignedString([]byte(r.Context().Value("cfg").(*config.Config).JWTSecret))
+// completeLogin открывает сессию пользователя, чей первый фактор уже проверен. Если у него включен
+// второй фактор, вместо токенов возвращает challenge для LoginTwoFactor.
+func completeLogin(ctx context.Context, user models.User) (AuthTokens, string, error) {
+	twoFactor, err := repo.TOTPEnabled(ctx, Pool, user.Id)
 	if err != nil {
-		logger.GetLoggerFromCtx(r.Context()).Info(r.Context(), "Failed to sign token", zap.Error(err))
-		return "", err
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get two-factor status", zap.Error(err))
+		return AuthTokens{}, "", err
+	}
+	if twoFactor {
+		challenge, err := signTwoFactorLogin(ctx, user.Id, time.Now())
+		if err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to sign two-factor challenge", zap.Error(err))
+			return AuthTokens{}, "", err
+		}
+		return AuthTokens{}, challenge, nil
 	}
 
-	return tokenString, nil
+	tokens, err := startSession(ctx, user)
+	return tokens, "", err
+}
+
+// GetTrackInfo возвращает метаданные трека пользователя
+func GetTrackInfo(ctx context.Context, userId, id string) (models.Track, error) {
+	track, err := ownTrack(ctx, userId, id)
+	if err != nil {
+		return models.Track{}, err
+	}
+	return trackFromDB(track), nil
 }
 
 func GetTracksByUser(ctx context.Context, userId string) ([]models.Track, error) {
@@ -141,112 +186,384 @@ func GetTracksByUser(ctx context.Context, userId string) ([]models.Track, error)
 	return tracks, nil
 }
 
-func DeleteTrack(ctx context.Context, token, id string) error {
-	track, err := repo.GetTrack(ctx, Pool, id)
+func DeleteTrack(ctx context.Context, userId, id string) error {
+	track, err := ownTrack(ctx, userId, id)
 	if err != nil {
-		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get track", zap.Error(err))
-		return http.ErrServerClosed
+		return err
 	}
 
-	_, ownerId, err := ValidToken(ctx, token)
-	if err != nil {
-		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to validate token", zap.Error(err))
+	if err = deleteRenditions(ctx, track.Id); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove renditions", zap.Error(err))
 		return err
 	}
-	if ownerId != track.UserId {
-		logger.GetLoggerFromCtx(ctx).Info(ctx, "User is not owner of track")
-		return http.ErrServerClosed
-	}
 
-	err = os.Remove(track.Path)
+	tx, err := Pool.Begin(ctx)
 	if err != nil {
-		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to open file", zap.Error(err))
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	err = repo.DeleteTrack(ctx, Pool, id)
+	// Хэш и путь берутся из удаленной строки: если трек удалили параллельно, ссылку
+	// на blob уже освободил другой запрос
+	deleted, err := repo.DeleteTrack(ctx, tx, track.Id)
 	if err != nil {
 		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to delete track", zap.Error(err))
 		return err
 	}
 
+	// Треки, загруженные до появления blobs, владеют своим объектом единолично, а объект
+	// blob больше не нужен, когда освобождена последняя ссылка на него
+	unused := deleted.Hash == ""
+	if !unused {
+		if unused, err = repo.ReleaseBlob(ctx, tx, deleted.Hash); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to release blob", zap.Error(err))
+			return err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit track deletion", zap.Error(err))
+		return err
+	}
+
+	// Объект удаляется только после коммита: при откате строка трека не должна остаться без файла.
+	// Повторная загрузка того же содержимого создаст новую строку blob с новым ключом.
+	if unused {
+		if err = Storage.Delete(ctx, deleted.Path); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove object", zap.Error(err))
+		}
+	}
 	return nil
 }
 
-func LoadTracks(ctx context.Context, r *http.Request, artist, album, name, userid string) (int, []string, int, error) {
-	if artist == "" || album == "" {
-		logger.GetLoggerFromCtx(ctx).Info(ctx, "Artist or album is empty")
-		return http.StatusBadRequest, []string{}, 0, errors.New("artist and album are required")
+const (
+	UploadOk        = "ok"
+	UploadRejected  = "rejected"
+	UploadDuplicate = "duplicate"
+	UploadError     = "error"
+	// UploadCover — файл пакета принят как обложка альбома, а не как трек
+	UploadCover = "cover"
+)
+
+var (
+	// ErrNotAudio возвращается для файлов, сигнатура которых не распознана как аудио
+	ErrNotAudio = errs.Validation("not a supported audio file (mp3, flac, ogg, opus, wav, m4a, aiff)")
+	// ErrDuplicate возвращается, если файл с таким же содержимым уже есть в библиотеке пользователя
+	ErrDuplicate = errs.New(errs.ErrConflict, "track already exists")
+)
+
+// storeTrack проверяет тип файла, читает теги и сохраняет файл в хранилище вместе со строкой трека.
+// digest — SHA-256 содержимого, посчитанный при приеме файла. Файл записывается до вставки строки,
+// поэтому в БД не бывает треков без файла.
+// Непустые artist и album перекрывают значения из тегов. cover — обложка из того же пакета;
+// если ее нет, альбому достается картинка из тегов файла.
+func storeTrack(ctx context.Context, file io.ReadSeeker, filename, digest string, size int64, artist, album, userid string, cover []byte) (models.TrackDB, error) {
+	// Проверяем тип файла по сигнатуре, не доверяя расширению и заголовку Content-Type
+	buff := make([]byte, tag.SniffLen)
+	n, err := io.ReadFull(file, buff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Error reading file", zap.Error(err))
+		return models.TrackDB{}, err
+	}
+	contentType, ok := tag.ContentType(buff[:n])
+	if !ok {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Rejected non-audio file", zap.String("file", filename))
+		return models.TrackDB{}, ErrNotAudio
 	}
 
-	// Создаем директорию для артиста и альбома
-	artistPath := filepath.Join(MUSIC, name, sanitizeName(artist))
-	albumPath := filepath.Join(artistPath, sanitizeName(album))
-	if err := os.MkdirAll(albumPath, os.ModePerm); err != nil {
-		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to create album directory", zap.Error(err))
-		return http.StatusInternalServerError, []string{}, 0, err
+	tags, err := tag.Read(file)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to read tags", zap.String("file", filename), zap.Error(err))
+	}
+	track := trackFromTags(tags, filename)
+	if artist != "" {
+		track.Artist = artist
+	}
+	if album != "" {
+		track.Album = album
 	}
 
-	// Обрабатываем загруженные файлы
-	files := r.MultipartForm.File["files"]
-	uploadResults := make([]string, 0, len(files))
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Error seeking file", zap.Error(err))
+		return models.TrackDB{}, err
+	}
 
-	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
-		if err != nil {
-			logger.GetLoggerFromCtx(ctx).Info(ctx, "Error retrieving the file", zap.Error(err))
-			return http.StatusBadRequest, []string{}, 0, err
-		}
-		defer file.Close()
+	track.UserId = userid
+	track.MimeType = contentType
+	track.Hash = digest
+	track.Size = size
+	track.ModTime = time.Now()
 
-		// Проверяем тип файла (можно добавить больше проверок)
-		buff := make([]byte, 512)
-		if _, err = file.Read(buff); err != nil {
-			logger.GetLoggerFromCtx(ctx).Info(ctx, "Error reading file", zap.Error(err))
-			return http.StatusInternalServerError, []string{}, 0, err
-		}
+	// Быстрая проверка без транзакции; гонку двух одинаковых загрузок ловит уникальный индекс
+	exists, err := repo.HasTrackWithHash(ctx, Pool, userid, digest)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Error checking duplicate", zap.Error(err))
+		return models.TrackDB{}, err
+	}
+	if exists {
+		return models.TrackDB{}, ErrDuplicate
+	}
+	stored, err := repo.HasBlob(ctx, Pool, digest)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Error checking blob", zap.Error(err))
+		return models.TrackDB{}, err
+	}
 
-		if _, err = file.Seek(0, io.SeekStart); err != nil {
-			logger.GetLoggerFromCtx(ctx).Info(ctx, "Error seeking file", zap.Error(err))
-			return http.StatusInternalServerError, []string{}, 0, err
+	// Файл записывается до транзакции под новым ключом, чтобы не держать ее открытой
+	// все время записи. Если такое содержимое уже хранится, запись пропускается.
+	var staged string
+	for {
+		if !stored && staged == "" {
+			staged = blobKey(digest)
+			if err = Storage.Put(ctx, staged, file, size, contentType); err != nil {
+				logger.GetLoggerFromCtx(ctx).Info(ctx, "Error saving file", zap.Error(err))
+				removeStaged(ctx, staged)
+				return models.TrackDB{}, err
+			}
 		}
-
-		// Создаем файл на сервере
-		dstPath := filepath.Join(albumPath, sanitizeName(fileHeader.Filename))
-		dst, err := os.Create(dstPath)
+		added, ok, err := insertTrack(ctx, track, staged)
 		if err != nil {
-			logger.GetLoggerFromCtx(ctx).Info(ctx, "Error creating file on server", zap.Error(err))
-			return http.StatusInternalServerError, []string{}, 0, err
+			removeStaged(ctx, staged)
+			return models.TrackDB{}, err
 		}
-		defer dst.Close()
-
-		err = repo.AddTrack(ctx, Pool, models.TrackDB{
-			UserId:  userid,
-			Artist:  artist,
-			Album:   album,
-			Name:    fileHeader.Filename,
-			Path:    dstPath,
-			Size:    fileHeader.Size,
-			ModTime: time.Now(),
-		})
-		if err != nil {
-			logger.GetLoggerFromCtx(ctx).Info(ctx, "Error creating file on server", zap.Error(err))
-			return http.StatusInternalServerError, []string{}, 0, err
+		if ok {
+			track = added
+			break
 		}
+		// blob удалили между проверкой и транзакцией: файл все-таки нужно записать
+		stored = false
+	}
+	// Такое же содержимое успели сохранить параллельно, и записанный объект не понадобился
+	if staged != "" && track.Path != staged {
+		removeStaged(ctx, staged)
+	}
+
+	if cover == nil && tags.Picture != nil {
+		cover = tags.Picture.Data
+	}
+	if len(cover) > 0 {
+		addAlbumCover(ctx, track.AlbumId, cover)
+	}
+	return track, nil
+}
+
+// insertTrack в одной короткой транзакции добавляет ссылку на blob и строку трека. staged — ключ
+// уже записанного объекта или "", если файл не записывался, потому что blob существовал. Возвращает
+// false, если blob к моменту транзакции исчез и без записанного объекта трек добавить нельзя.
+func insertTrack(ctx context.Context, track models.TrackDB, staged string) (models.TrackDB, bool, error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
+		return models.TrackDB{}, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Строка blob заблокирована до коммита, поэтому параллельное удаление последней ссылки
+	// не удалит объект, на который ссылается новый трек
+	var isNew bool
+	track.Path, isNew, err = repo.AcquireBlob(ctx, tx, models.Blob{Hash: track.Hash, Path: staged, Size: track.Size, MimeType: track.MimeType})
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Error acquiring blob", zap.Error(err))
+		return models.TrackDB{}, false, err
+	}
+	if isNew && staged == "" {
+		return models.TrackDB{}, false, nil
+	}
+
+	track, err = repo.AddTrack(ctx, tx, track)
+	if errors.Is(err, errs.ErrConflict) {
+		return models.TrackDB{}, false, ErrDuplicate
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Error creating track", zap.Error(err))
+		return models.TrackDB{}, false, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit track", zap.Error(err))
+		return models.TrackDB{}, false, err
+	}
+	return track, true, nil
+}
+
+// removeStaged удаляет объект, записанный storeTrack, на который так и не сослалась строка blobs
+func removeStaged(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+	if err := Storage.Delete(ctx, key); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove object", zap.Error(err))
+	}
+}
+
+// blobKey возвращает новый ключ для содержимого digest. Объекты раскладываются по первым двум
+// символам хэша, чтобы каталоги не разрастались; суффикс не дает записи нового объекта
+// пересечься с удалением прежнего объекта с тем же содержимым.
+func blobKey(digest string) string {
+	return path.Join("blobs", digest[:2], digest+"-"+uuid.NewString())
+}
+
+// spoolUpload копирует файл из multipart-формы во временный файл, по пути считая SHA-256,
+// и проверяет, что получен весь заявленный размер. Временный файл нужно закрыть и удалить вызывающему.
+func spoolUpload(fileHeader *multipart.FileHeader) (*os.File, string, error) {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "aumusic-upload-*")
+	if err != nil {
+		return nil, "", err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if err == nil && n != fileHeader.Size {
+		err = fmt.Errorf("received %d of %d bytes", n, fileHeader.Size)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, "", err
+	}
+	return tmp, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadTrack сохраняет один файл пакета и описывает итог в UploadResult
+func loadTrack(ctx context.Context, fileHeader *multipart.FileHeader, artist, album, userid string, cover []byte) models.UploadResult {
+	result := models.UploadResult{File: fileHeader.Filename}
+
+	file, digest, err := spoolUpload(fileHeader)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Error receiving the file", zap.String("file", fileHeader.Filename), zap.Error(err))
+		result.Status, result.Error = UploadError, err.Error()
+		return result
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	track, err := storeTrack(ctx, file, fileHeader.Filename, digest, fileHeader.Size, artist, album, userid, cover)
+	switch {
+	case errors.Is(err, ErrNotAudio):
+		result.Status, result.Error = UploadRejected, err.Error()
+	case errors.Is(err, ErrDuplicate):
+		result.Status, result.Error = UploadDuplicate, err.Error()
+	case err != nil:
+		result.Status, result.Error = UploadError, err.Error()
+	default:
+		t := trackFromDB(track)
+		result.Status, result.Track = UploadOk, &t
+	}
+	return result
+}
+
+// LoadTracks сохраняет загруженные файлы по одному, так что ошибка в одном файле не влияет
+// на остальные. Название, артист и альбом берутся из тегов файла, а непустые artist и album
+// из формы перекрывают их для всех файлов пакета. Код ответа: 201, если сохранен хотя бы
+// один файл; иначе 415, 409 или 500 в зависимости от причин отказа.
+// Файлы вроде cover.jpg не считаются треками: они становятся обложкой альбомов пакета.
+func LoadTracks(ctx context.Context, r *http.Request, artist, album, userid string) (int, []models.UploadResult, int) {
+	files := r.MultipartForm.File["files"]
+	results := make([]models.UploadResult, 0, len(files))
+	counts := make(map[string]int)
 
-		// Копируем содержимое файла
-		if _, err = io.Copy(dst, file); err != nil {
-			logger.GetLoggerFromCtx(ctx).Info(ctx, "Error saving file", zap.Error(err))
-			return http.StatusInternalServerError, []string{}, 0, err
+	var cover []byte
+	tracks := make([]*multipart.FileHeader, 0, len(files))
+	for _, fileHeader := range files {
+		if !IsCoverFile(fileHeader.Filename) {
+			tracks = append(tracks, fileHeader)
+			continue
+		}
+		result := models.UploadResult{File: fileHeader.Filename, Status: UploadCover}
+		data, err := readCover(fileHeader)
+		switch {
+		case err != nil:
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Error reading cover", zap.String("file", fileHeader.Filename), zap.Error(err))
+			result.Status, result.Error = UploadRejected, errs.Message(err)
+		case cover == nil:
+			cover = data
 		}
+		results = append(results, result)
+	}
+
+	for _, fileHeader := range tracks {
+		result := loadTrack(ctx, fileHeader, artist, album, userid, cover)
+		counts[result.Status]++
+		results = append(results, result)
+	}
 
-		uploadResults = append(uploadResults, fmt.Sprintf("Successfully uploaded %s (%d bytes)", fileHeader.Filename, fileHeader.Size))
+	switch {
+	case len(tracks) == 0:
+		return http.StatusBadRequest, results, 0
+	case counts[UploadOk] > 0:
+		return http.StatusCreated, results, counts[UploadOk]
+	case counts[UploadError] > 0:
+		return http.StatusInternalServerError, results, 0
+	case counts[UploadDuplicate] > 0:
+		return http.StatusConflict, results, 0
 	}
+	return http.StatusUnsupportedMediaType, results, 0
+}
 
-	return http.StatusOK, uploadResults, len(files), nil
+// trackNumberPrefix совпадает с номером трека в начале имени файла: "03 - ", "03. ", "3_"
+var trackNumberPrefix = regexp.MustCompile(`^\d{1,3}\s*[-._]\s*`)
+
+// trackFromTags заполняет метаданные трека из тегов; чего нет в тегах, берется из имени файла
+func trackFromTags(tags tag.Tags, filename string) models.TrackDB {
+	track := models.TrackDB{
+		Name:        tags.Title,
+		Artist:      tags.Artist,
+		Album:       tags.Album,
+		AlbumArtist: tags.AlbumArtist,
+		TrackNumber: tags.Track,
+		DiscNumber:  tags.Disc,
+		Year:        tags.Year,
+		Genre:       tags.Genre,
+		Duration:    tags.Duration.Seconds(),
+	}
+	if track.Name == "" {
+		base := sanitizeName(filename)
+		base = strings.TrimSuffix(base, path.Ext(base))
+		track.Name = base
+		if name := trackNumberPrefix.ReplaceAllString(base, ""); name != "" {
+			track.Name = name
+		}
+	}
+	if track.Artist == "" {
+		track.Artist = track.AlbumArtist
+	}
+	if track.Artist == "" {
+		track.Artist = "Unknown Artist"
+	}
+	if track.Album == "" {
+		track.Album = "Unknown Album"
+	}
+	return track
+}
+
+func trackFromDB(track models.TrackDB) models.Track {
+	return models.Track{
+		Id:          track.Id,
+		Name:        track.Name,
+		Artist:      track.Artist,
+		Album:       track.Album,
+		ArtistId:    track.ArtistId,
+		AlbumId:     track.AlbumId,
+		AlbumArtist: track.AlbumArtist,
+		TrackNumber: track.TrackNumber,
+		DiscNumber:  track.DiscNumber,
+		Year:        track.Year,
+		Genre:       track.Genre,
+		Duration:    track.Duration,
+		MimeType:    track.MimeType,
+		Size:        track.Size,
+		ModTime:     track.ModTime,
+	}
 }
 
 func sanitizeName(name string) string {
 	// Удаляем небезопасные символы из имени файла/папки
-	return filepath.Base(name)
+	return path.Base(strings.ReplaceAll(name, "\\", "/"))
 }
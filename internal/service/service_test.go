@@ -0,0 +1,357 @@
+package service
+
+import (
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/storage"
+
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// wavFile собирает минимальный WAV (8 кГц, 8 бит, моно) с сэмплами data
+func wavFile(data []byte) []byte {
+	le := binary.LittleEndian
+	b := []byte("RIFF")
+	b = le.AppendUint32(b, uint32(36+len(data)))
+	b = append(b, "WAVEfmt "...)
+	b = le.AppendUint32(b, 16)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint32(b, 8000)
+	b = le.AppendUint32(b, 8000)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, 8)
+	b = append(b, "data"...)
+	b = le.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// storeFile сохраняет data как трек пользователя userId так же, как загрузка
+func storeFile(ctx context.Context, userId, filename string, data []byte) (models.TrackDB, error) {
+	sum := sha256.Sum256(data)
+	return storeTrack(ctx, bytes.NewReader(data), filename, hex.EncodeToString(sum[:]), int64(len(data)), "", "", userId, nil)
+}
+
+// testTrack загружает пользователю userId трек с уникальным содержимым
+func testTrack(t *testing.T, ctx context.Context, userId string) models.TrackDB {
+	t.Helper()
+	track, err := storeFile(ctx, userId, "track.wav", wavFile([]byte(uuid.NewString())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return track
+}
+
+// uploadFile — файл пакета загрузки
+type uploadFile struct {
+	name string
+	data []byte
+}
+
+// uploadRequest собирает разобранный запрос загрузки с файлами в поле "files"
+func uploadRequest(t *testing.T, files ...uploadFile) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, f := range files {
+		part, err := w.CreateFormFile("files", f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(f.data)
+	}
+	w.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/tracks", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.MultipartForm.RemoveAll() })
+	return r
+}
+
+// uploadStatuses возвращает итоги загрузки по файлам в порядке results
+func uploadStatuses(results []models.UploadResult) []string {
+	statuses := make([]string, 0, len(results))
+	for _, result := range results {
+		statuses = append(statuses, result.File+": "+result.Status)
+	}
+	return statuses
+}
+
+func pngFile(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// failingStorage — хранилище в памяти, которое не принимает новые объекты
+type failingStorage struct {
+	*storage.Memory
+}
+
+func (failingStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	return errors.New("storage is unavailable")
+}
+
+func TestLoadTracksRejected(t *testing.T) {
+	// Не-аудио отсекается по сигнатуре до обращения к базе
+	ctx := testContext()
+	Storage = storage.NewMemory()
+	t.Cleanup(func() { Storage = nil })
+
+	r := uploadRequest(t, uploadFile{"notes.txt", []byte("hello, world")}, uploadFile{"cover.png", pngFile(t)})
+	status, results, count := LoadTracks(ctx, r, "", "", "user-1")
+	if status != http.StatusUnsupportedMediaType || count != 0 {
+		t.Fatalf("получен код %d и %d треков", status, count)
+	}
+	want := []string{"cover.png: " + UploadCover, "notes.txt: " + UploadRejected}
+	if got := uploadStatuses(results); !slices.Equal(got, want) {
+		t.Fatalf("итоги %v, ожидались %v", got, want)
+	}
+	if results[1].Error == "" {
+		t.Fatal("у отклоненного файла нет причины")
+	}
+
+	// Пакет из одной обложки — не загрузка треков
+	r = uploadRequest(t, uploadFile{"cover.png", pngFile(t)})
+	if status, _, _ = LoadTracks(ctx, r, "", "", "user-1"); status != http.StatusBadRequest {
+		t.Fatalf("пакет без треков: код %d", status)
+	}
+}
+
+func TestLoadTracks(t *testing.T) {
+	ctx := testDB(t)
+	user := testUser(t, ctx, &recordingSender{})
+	song := wavFile([]byte(uuid.NewString()))
+	cover := pngFile(t)
+
+	r := uploadRequest(t,
+		uploadFile{"01 - Song.wav", song},
+		uploadFile{"copy.wav", song},
+		uploadFile{"notes.txt", []byte("hello, world")},
+		uploadFile{"cover.png", cover},
+	)
+	status, results, count := LoadTracks(ctx, r, "Artist", "Album", user.Id)
+	if status != http.StatusCreated || count != 1 {
+		t.Fatalf("получен код %d и %d треков", status, count)
+	}
+	want := []string{
+		"cover.png: " + UploadCover,
+		"01 - Song.wav: " + UploadOk,
+		"copy.wav: " + UploadDuplicate,
+		"notes.txt: " + UploadRejected,
+	}
+	if got := uploadStatuses(results); !slices.Equal(got, want) {
+		t.Fatalf("итоги %v, ожидались %v", got, want)
+	}
+	track := results[1].Track
+	if track == nil || track.Name != "Song" || track.Artist != "Artist" || track.Album != "Album" {
+		t.Fatalf("сохранен трек %+v", track)
+	}
+	sum := sha256.Sum256(cover)
+	if hash, err := repo.GetAlbumCover(ctx, Pool, track.AlbumId); err != nil || hash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("обложка альбома %q: %v", hash, err)
+	}
+
+	r = uploadRequest(t, uploadFile{"again.wav", song})
+	if status, results, _ = LoadTracks(ctx, r, "", "", user.Id); status != http.StatusConflict {
+		t.Fatalf("повторная загрузка: код %d, итоги %v", status, uploadStatuses(results))
+	}
+
+	// Ошибка хранилища важнее дубликата: повторять стоит весь пакет
+	Storage = failingStorage{storage.NewMemory()}
+	r = uploadRequest(t, uploadFile{"new.wav", wavFile([]byte(uuid.NewString()))}, uploadFile{"again.wav", song})
+	status, results, _ = LoadTracks(ctx, r, "", "", user.Id)
+	if status != http.StatusInternalServerError {
+		t.Fatalf("ошибка хранилища: код %d", status)
+	}
+	want = []string{"new.wav: " + UploadError, "again.wav: " + UploadDuplicate}
+	if got := uploadStatuses(results); !slices.Equal(got, want) {
+		t.Fatalf("итоги %v, ожидались %v", got, want)
+	}
+}
+
+// vanishTracer вызывает vanish один раз, сразу после того как storeTrack убедился, что blob существует
+type vanishTracer struct {
+	vanish func()
+}
+
+type hasBlobKey struct{}
+
+func (v *vanishTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, hasBlobKey{}, data.SQL == "SELECT EXISTS (SELECT 1 FROM blobs WHERE hash = $1)")
+}
+
+func (v *vanishTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if hasBlob, _ := ctx.Value(hasBlobKey{}).(bool); hasBlob && v.vanish != nil {
+		vanish := v.vanish
+		v.vanish = nil
+		vanish()
+	}
+}
+
+func TestStoreTrackBlobVanished(t *testing.T) {
+	ctx := testDB(t)
+	owner := testUser(t, ctx, &recordingSender{})
+	user := testUser(t, ctx, &recordingSender{})
+	song := wavFile([]byte(uuid.NewString()))
+	first, err := storeFile(ctx, owner.Id, "song.wav", song)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Между проверкой HasBlob и транзакцией владелец удаляет последний трек с этим содержимым
+	tracer := &vanishTracer{vanish: func() {
+		if err := DeleteTrack(ctx, owner.Id, first.Id); err != nil {
+			t.Error(err)
+		}
+	}}
+	cfg, err := pgxpool.ParseConfig(os.Getenv("POSTGRES_TEST_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConnConfig.Tracer = tracer
+	traced, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer traced.Close()
+	pool := Pool
+	Pool = traced
+	defer func() { Pool = pool }()
+
+	track, err := storeFile(ctx, user.Id, "song.wav", song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracer.vanish != nil {
+		t.Fatal("blob не исчез перед транзакцией")
+	}
+	if track.Path == first.Path {
+		t.Fatal("трек ссылается на удаленный объект")
+	}
+	if _, err = Storage.Stat(ctx, track.Path); err != nil {
+		t.Fatalf("файл не записан заново: %v", err)
+	}
+	if _, err = Storage.Stat(ctx, first.Path); err == nil {
+		t.Fatal("объект удаленного трека остался в хранилище")
+	}
+}
+
+func TestAcquireReleaseBlob(t *testing.T) {
+	ctx := testDB(t)
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+
+	hash := uuid.NewString()
+	path, isNew, err := repo.AcquireBlob(ctx, tx, models.Blob{Hash: hash, Path: "first", Size: 1, MimeType: "audio/wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "first" || !isNew {
+		t.Fatalf("первая ссылка: путь %q, новый %v", path, isNew)
+	}
+	// Вторая ссылка получает уже записанный объект, а не свой
+	path, isNew, err = repo.AcquireBlob(ctx, tx, models.Blob{Hash: hash, Path: "second", Size: 1, MimeType: "audio/wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "first" || isNew {
+		t.Fatalf("вторая ссылка: путь %q, новый %v", path, isNew)
+	}
+
+	if unused, err := repo.ReleaseBlob(ctx, tx, hash); err != nil || unused {
+		t.Fatalf("освобождение первой ссылки: %v, %v", unused, err)
+	}
+	if unused, err := repo.ReleaseBlob(ctx, tx, hash); err != nil || !unused {
+		t.Fatalf("освобождение последней ссылки: %v, %v", unused, err)
+	}
+	if exists, err := repo.HasBlob(ctx, tx, hash); err != nil || exists {
+		t.Fatalf("blob без ссылок остался: %v, %v", exists, err)
+	}
+}
+
+func TestSharedBlob(t *testing.T) {
+	ctx := testDB(t)
+	alice := testUser(t, ctx, &recordingSender{})
+	bob := testUser(t, ctx, &recordingSender{})
+	song := wavFile([]byte(uuid.NewString()))
+
+	first, err := storeFile(ctx, alice.Id, "song.wav", song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := storeFile(ctx, bob.Id, "song.wav", song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Path != second.Path {
+		t.Fatalf("одинаковое содержимое хранится дважды: %s и %s", first.Path, second.Path)
+	}
+	objects, err := Storage.List(ctx, "blobs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 {
+		t.Fatalf("в хранилище %d объектов вместо одного", len(objects))
+	}
+	refcount := func() int {
+		t.Helper()
+		var n int
+		err := Pool.QueryRow(ctx, "SELECT COALESCE((SELECT refcount FROM blobs WHERE hash = $1), 0)", first.Hash).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := refcount(); n != 2 {
+		t.Fatalf("счетчик ссылок %d вместо 2", n)
+	}
+
+	// Пока на объект ссылается другой трек, он остается в хранилище
+	if err = DeleteTrack(ctx, alice.Id, first.Id); err != nil {
+		t.Fatal(err)
+	}
+	if n := refcount(); n != 1 {
+		t.Fatalf("после удаления трека счетчик ссылок %d вместо 1", n)
+	}
+	if _, err = Storage.Stat(ctx, second.Path); err != nil {
+		t.Fatalf("общий объект удален: %v", err)
+	}
+
+	if err = DeleteTrack(ctx, bob.Id, second.Id); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := repo.HasBlob(ctx, Pool, first.Hash); err != nil || exists {
+		t.Fatalf("blob без ссылок остался: %v, %v", exists, err)
+	}
+	if _, err = Storage.Stat(ctx, second.Path); err == nil {
+		t.Fatal("объект последнего трека остался в хранилище")
+	}
+}
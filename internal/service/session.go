@@ -0,0 +1,342 @@
+package service
+
+import (
+	"aumusic/internal/config"
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/hash"
+	"aumusic/pkg/logger"
+
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	refreshTokenBytes      = 32
+	sessionJanitorInterval = time.Hour
+	// refreshReuseGrace — сколько после ротации прежний refresh-токен еще принимается без отзыва сессии.
+	// Браузер, у которого истек access-токен, часто отправляет несколько запросов с одним refresh-токеном сразу.
+	refreshReuseGrace = 30 * time.Second
+)
+
+var (
+	// ErrInvalidRefreshToken возвращается для неизвестного, отозванного или истекшего refresh-токена
+	ErrInvalidRefreshToken = errs.New(errs.ErrUnauthenticated, "refresh token is invalid or expired")
+	// ErrSessionRevoked — причина отказа для access-токена отозванной или истекшей сессии
+	ErrSessionRevoked = errors.New("session is revoked or expired")
+)
+
+// AuthTokens — токены, которые выдаются при входе и при обновлении сессии
+type AuthTokens struct {
+	AccessToken     string
+	AccessExpiresAt time.Time
+	// RefreshToken пустой, если обновление не меняло refresh-токен (см. refreshReuseGrace)
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// Caller — пользователь, от имени которого выполняется запрос. HTTP-слой определяет его
+// по токену один раз на запрос и кладет в контекст.
+type Caller struct {
+	UserId   string
+	Username string
+	// KeyId и Scopes заданы, если запрос пришел с API-ключом
+	KeyId  string
+	Scopes []string
+}
+
+// Authorize проверяет, что вызывающему разрешено действие scope. Пустой scope означает действие,
+// доступное только из сессии входа: например, управление самими ключами.
+func (c Caller) Authorize(scope string) error {
+	if c.KeyId == "" {
+		return nil
+	}
+	if scope == "" {
+		return errs.Forbidden("api keys cannot be used for this endpoint")
+	}
+	if !slices.Contains(c.Scopes, scope) {
+		return errs.Forbidden("api key does not have the " + scope + " scope")
+	}
+	return nil
+}
+
+type callerKey struct{}
+
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext возвращает пользователя запроса; ok == false, если запрос не аутентифицирован
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(Caller)
+	return caller, ok
+}
+
+// Authenticate определяет пользователя по access-токену или API-ключу
+func Authenticate(ctx context.Context, token string) (Caller, error) {
+	if strings.HasPrefix(token, APIKeyPrefix) {
+		return authenticateAPIKey(ctx, token)
+	}
+	username, userId, err := ValidToken(ctx, token)
+	if err != nil {
+		return Caller{}, err
+	}
+	return Caller{UserId: userId, Username: username}, nil
+}
+
+// accessClaims — содержимое access-токена; sid связывает токен с сессией в БД
+type accessClaims struct {
+	Username  string `json:"username"`
+	UserId    string `json:"userid"`
+	SessionId string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+func getConfig(ctx context.Context) *config.Config {
+	return ctx.Value("cfg").(*config.Config)
+}
+
+// signAccessToken выпускает access-токен сессии, действительный AccessTokenTTL с момента now
+func signAccessToken(ctx context.Context, session models.Session, username string, now time.Time) (string, time.Time, error) {
+	cfg := getConfig(ctx)
+	expiresAt := now.Add(cfg.AccessTokenTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims{
+		Username:  username,
+		UserId:    session.UserId,
+		SessionId: session.Id,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   session.UserId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	signed, err := token.SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// parseAccessToken проверяет подпись и сроки токена, но не состояние сессии
+func parseAccessToken(ctx context.Context, token string, opts ...jwt.ParserOption) (accessClaims, error) {
+	var claims accessClaims
+	opts = append(opts, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(getConfig(ctx).JWTSecret), nil
+	}, opts...)
+	if err != nil {
+		return accessClaims{}, err
+	}
+	if claims.UserId == "" || claims.SessionId == "" {
+		return accessClaims{}, errors.New("token has no user or session")
+	}
+	return claims, nil
+}
+
+// AccessTokenValid проверяет только подпись и срок access-токена, без обращения к БД.
+// По нему HTTP-слой решает, пора ли обновить сессию браузера.
+func AccessTokenValid(ctx context.Context, token string) bool {
+	if token == "" {
+		return false
+	}
+	_, err := parseAccessToken(ctx, token)
+	return err == nil
+}
+
+// Refresh-токен имеет вид "<id сессии>.<секрет>"; в БД хранится только хэш секрета
+func splitRefreshToken(token string) (string, string, bool) {
+	sessionId, secret, ok := strings.Cut(token, ".")
+	if !ok || uuid.Validate(sessionId) != nil || secret == "" {
+		return "", "", false
+	}
+	return sessionId, secret, true
+}
+
+// startSession создает сессию пользователя и выдает первую пару токенов
+func startSession(ctx context.Context, user models.User) (AuthTokens, error) {
+	secret, err := hash.NewToken(refreshTokenBytes)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	now := time.Now()
+	session, err := repo.CreateSession(ctx, Pool, models.Session{
+		UserId:      user.Id,
+		RefreshHash: hash.HashToken(secret),
+		ExpiresAt:   now.Add(getConfig(ctx).RefreshTokenTTL),
+	})
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to create session", zap.Error(err))
+		return AuthTokens{}, err
+	}
+
+	tokens := AuthTokens{RefreshToken: session.Id + "." + secret, RefreshExpiresAt: session.ExpiresAt}
+	tokens.AccessToken, tokens.AccessExpiresAt, err = signAccessToken(ctx, session, user.Username, now)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to sign token", zap.Error(err))
+		return AuthTokens{}, err
+	}
+	return tokens, nil
+}
+
+// RefreshSession выдает по refresh-токену новый access-токен и заменяет сам refresh-токен.
+// Повторное предъявление уже замененного токена означает, что его украли, и отзывает сессию.
+func RefreshSession(ctx context.Context, refreshToken string) (AuthTokens, error) {
+	sessionId, secret, ok := splitRefreshToken(refreshToken)
+	if !ok {
+		return AuthTokens{}, ErrInvalidRefreshToken
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
+		return AuthTokens{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	session, err := repo.LockSession(ctx, tx, sessionId)
+	if errors.Is(err, errs.ErrNotFound) {
+		return AuthTokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get session", zap.Error(err))
+		return AuthTokens{}, err
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return AuthTokens{}, ErrInvalidRefreshToken
+	}
+
+	tokens := AuthTokens{RefreshExpiresAt: session.ExpiresAt}
+	reused := session.PreviousHash != "" && hash.EqualTokenHash(secret, session.PreviousHash)
+	switch {
+	case hash.EqualTokenHash(secret, session.RefreshHash):
+		next, err := hash.NewToken(refreshTokenBytes)
+		if err != nil {
+			return AuthTokens{}, err
+		}
+		tokens.RefreshToken = session.Id + "." + next
+		tokens.RefreshExpiresAt = now.Add(getConfig(ctx).RefreshTokenTTL)
+		if err = repo.RotateSession(ctx, tx, session.Id, hash.HashToken(next), tokens.RefreshExpiresAt); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to rotate session", zap.Error(err))
+			return AuthTokens{}, err
+		}
+	case reused && now.Sub(session.RotatedAt) < refreshReuseGrace:
+		// Параллельный запрос уже заменил токен; новый refresh-токен достался ему
+	case reused:
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Refresh token reused, revoking session", zap.String("session", session.Id))
+		if err = repo.RevokeSession(ctx, tx, session.Id); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to revoke session", zap.Error(err))
+			return AuthTokens{}, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit session revocation", zap.Error(err))
+			return AuthTokens{}, err
+		}
+		return AuthTokens{}, ErrInvalidRefreshToken
+	default:
+		return AuthTokens{}, ErrInvalidRefreshToken
+	}
+
+	user, err := repo.GetUserById(ctx, Pool, session.UserId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get user", zap.Error(err))
+		return AuthTokens{}, err
+	}
+	tokens.AccessToken, tokens.AccessExpiresAt, err = signAccessToken(ctx, session, user.Username, now)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to sign token", zap.Error(err))
+		return AuthTokens{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit session rotation", zap.Error(err))
+		return AuthTokens{}, err
+	}
+	return tokens, nil
+}
+
+// LogoutSession отзывает сессию, к которой относится access- или refresh-токен. Истекший
+// access-токен тоже подходит: его подпись по-прежнему доказывает, чья это сессия. Refresh-токен
+// отзывает сессию, только если его секрет совпадает с сохраненным.
+// Если ни один токен не указывает на сессию, отзывать нечего и ошибки нет.
+func LogoutSession(ctx context.Context, accessToken, refreshToken string) error {
+	if claims, err := parseAccessToken(ctx, accessToken, jwt.WithoutClaimsValidation()); err == nil {
+		if err = repo.RevokeSession(ctx, Pool, claims.SessionId); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to revoke session", zap.Error(err))
+			return err
+		}
+		return nil
+	}
+	sessionId, secret, ok := splitRefreshToken(refreshToken)
+	if !ok {
+		return nil
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	session, err := repo.LockSession(ctx, tx, sessionId)
+	if errors.Is(err, errs.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get session", zap.Error(err))
+		return err
+	}
+	// Предыдущий секрет тоже принадлежит владельцу сессии: его мог заменить параллельный запрос
+	if !hash.EqualTokenHash(secret, session.RefreshHash) &&
+		(session.PreviousHash == "" || !hash.EqualTokenHash(secret, session.PreviousHash)) {
+		return nil
+	}
+	if err = repo.RevokeSession(ctx, tx, session.Id); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to revoke session", zap.Error(err))
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit session revocation", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// LogoutAll отзывает все сессии пользователя, включая текущую
+func LogoutAll(ctx context.Context, userId string) (int64, error) {
+	n, err := repo.RevokeUserSessions(ctx, Pool, userId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to revoke sessions", zap.Error(err))
+		return 0, err
+	}
+	return n, nil
+}
+
+// RunSessionJanitor раз в час удаляет истекшие и отозванные сессии и истекшие ссылки из писем.
+// Работает до отмены ctx.
+func RunSessionJanitor(ctx context.Context) {
+	ticker := time.NewTicker(sessionJanitorInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := repo.DeleteStaleSessions(ctx, Pool, time.Now()); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove stale sessions", zap.Error(err))
+		}
+		if _, err := repo.DeleteStaleEmailTokens(ctx, Pool, time.Now()); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove stale email tokens", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
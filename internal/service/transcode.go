@@ -0,0 +1,210 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/pkg/logger"
+	"aumusic/pkg/storage"
+	"aumusic/pkg/transcode"
+
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	Transcoder *transcode.Transcoder
+
+	// renditions не дает одновременно перекодировать один и тот же трек в один и тот же профиль
+	renditions singleflight.Group
+)
+
+// renditionPrefix — каталог в хранилище, где лежат все перекодированные версии трека
+func renditionPrefix(trackId string) string {
+	return path.Join("renditions", trackId) + "/"
+}
+
+// GetTrackRendition отдает трек в запрошенном качестве. Перекодированная версия сохраняется
+// в хранилище при первом запросе, последующие запросы читают ее с поддержкой Range.
+func GetTrackRendition(ctx context.Context, userId, id, quality, codec string) (io.ReadSeekCloser, string, int64, time.Time, error) {
+	profile, ok, err := transcode.ParseProfile(quality, codec)
+	if err != nil {
+		return nil, "", 0, time.Time{}, errs.Wrap(errs.ErrValidation, "quality must be one of original, 320, 128, 64 and codec one of mp3, opus, aac", err)
+	}
+	if !ok {
+		return GetTrack(ctx, userId, id)
+	}
+
+	track, err := ownTrack(ctx, userId, id)
+	if err != nil {
+		return nil, "", 0, time.Time{}, err
+	}
+
+	key := renditionPrefix(track.Id) + profile.Name()
+	_, err = Storage.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Перекодирование не прерывается, если клиент отключился: результат пригодится следующему запросу
+		_, err, _ = renditions.Do(key, func() (any, error) {
+			return nil, transcodeTrack(context.WithoutCancel(ctx), track, key, profile)
+		})
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to prepare rendition", zap.String("key", key), zap.Error(err))
+		return nil, "", 0, time.Time{}, err
+	}
+
+	reader, object, err := storage.NewReader(ctx, Storage, key)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to open rendition", zap.Error(err))
+		return nil, "", 0, time.Time{}, err
+	}
+	return reader, profile.ContentType(), object.Size, object.ModTime, nil
+}
+
+func transcodeTrack(ctx context.Context, track models.TrackDB, key string, profile transcode.Profile) error {
+	src, err := Storage.OpenRange(ctx, track.Path, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pr, pw := io.Pipe()
+	encoded := make(chan struct{})
+	go func() {
+		defer close(encoded)
+		pw.CloseWithError(Transcoder.Transcode(ctx, src, pw, profile))
+	}()
+
+	err = Storage.Put(ctx, key, pr, -1, profile.ContentType())
+	if err != nil {
+		// Останавливаем ffmpeg: результат уже не нужен
+		pr.CloseWithError(err)
+		cancel()
+	}
+	// src закрывается отложенно, поэтому ждем, пока ffmpeg перестанет его читать
+	<-encoded
+	if err != nil {
+		// Недописанная рендиция не должна попасть в кеш
+		if rmErr := Storage.Delete(ctx, key); rmErr != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove rendition", zap.Error(rmErr))
+		}
+		return err
+	}
+	logger.GetLoggerFromCtx(ctx).Info(ctx, "Transcoded track", zap.String("key", key))
+	return nil
+}
+
+func deleteRenditions(ctx context.Context, trackId string) error {
+	objects, err := Storage.List(ctx, renditionPrefix(trackId))
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := Storage.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hlsName пропускает только файлы, которые создает transcode.HLS
+var hlsName = regexp.MustCompile(`^(master\.m3u8|\d+/(index\.m3u8|seg_\d+\.ts))$`)
+
+func hlsPrefix(trackId string) string {
+	return renditionPrefix(trackId) + "hls/"
+}
+
+// GetTrackHLS отдает мастер-плейлист, медиа-плейлист или сегмент HLS трека.
+// При первом обращении сегменты всех вариантов нарезаются и сохраняются в хранилище.
+func GetTrackHLS(ctx context.Context, userId, id, name string) (io.ReadSeekCloser, string, int64, time.Time, error) {
+	track, err := ownTrack(ctx, userId, id)
+	if err != nil {
+		return nil, "", 0, time.Time{}, err
+	}
+	if !hlsName.MatchString(name) {
+		return nil, "", 0, time.Time{}, errs.NotFound("hls file not found", nil)
+	}
+
+	prefix := hlsPrefix(track.Id)
+	_, err = Storage.Stat(ctx, prefix+transcode.HLSMaster)
+	if errors.Is(err, storage.ErrNotFound) {
+		_, err, _ = renditions.Do(prefix, func() (any, error) {
+			return nil, generateHLS(context.WithoutCancel(ctx), track, prefix)
+		})
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to prepare hls", zap.String("track", track.Id), zap.Error(err))
+		return nil, "", 0, time.Time{}, err
+	}
+
+	reader, object, err := storage.NewReader(ctx, Storage, prefix+name)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to open hls file", zap.String("name", name), zap.Error(err))
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, "", 0, time.Time{}, errs.NotFound("hls file not found", err)
+		}
+		return nil, "", 0, time.Time{}, err
+	}
+	return reader, transcode.HLSContentType(name), object.Size, object.ModTime, nil
+}
+
+func generateHLS(ctx context.Context, track models.TrackDB, prefix string) error {
+	dir, err := os.MkdirTemp("", "aumusic-hls-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	open := func() (io.ReadCloser, error) {
+		return Storage.OpenRange(ctx, track.Path, 0, -1)
+	}
+	if err = Transcoder.HLS(ctx, open, dir); err != nil {
+		return err
+	}
+
+	// Мастер-плейлист загружается последним: его наличие означает, что все варианты уже в хранилище
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == transcode.HLSMaster {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		return putFile(ctx, p, prefix+filepath.ToSlash(rel))
+	})
+	if err != nil {
+		return err
+	}
+	if err = putFile(ctx, filepath.Join(dir, transcode.HLSMaster), prefix+transcode.HLSMaster); err != nil {
+		return err
+	}
+
+	logger.GetLoggerFromCtx(ctx).Info(ctx, "Generated hls", zap.String("track", track.Id))
+	return nil
+}
+
+func putFile(ctx context.Context, name, key string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return Storage.Put(ctx, key, file, info.Size(), transcode.HLSContentType(name))
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"aumusic/internal/models"
+	"aumusic/pkg/storage"
+	"aumusic/pkg/transcode"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// failingPut — хранилище, которое сразу отказывает в записи, не читая данные
+type failingPut struct {
+	*storage.Memory
+	source *trackedReader
+}
+
+func (s failingPut) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	return errors.New("disk full")
+}
+
+func (s failingPut) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	return s.source, nil
+}
+
+// trackedReader замечает чтение после Close
+type trackedReader struct {
+	r              io.Reader
+	closed         atomic.Bool
+	readAfterClose atomic.Bool
+}
+
+func (r *trackedReader) Read(p []byte) (int, error) {
+	if r.closed.Load() {
+		r.readAfterClose.Store(true)
+		return 0, os.ErrClosed
+	}
+	return r.r.Read(p)
+}
+
+func (r *trackedReader) Close() error {
+	r.closed.Store(true)
+	return nil
+}
+
+func TestTranscodeTrackWaitsForEncoder(t *testing.T) {
+	// Вместо ffmpeg — скрипт, который медленно читает stdin
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nwhile dd bs=4096 count=1 2>/dev/null; do sleep 0.01; done\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	source := &trackedReader{r: strings.NewReader(strings.Repeat("x", 64<<10))}
+	Storage = failingPut{Memory: storage.NewMemory(), source: source}
+	Transcoder = transcode.New(transcode.Config{FFmpegPath: script})
+	t.Cleanup(func() { Storage, Transcoder = nil, nil })
+
+	profile, _, _ := transcode.ParseProfile("128", "mp3")
+	err := transcodeTrack(testContext(), models.TrackDB{Id: "track-1", Path: "tracks/1"}, "renditions/track-1/128.mp3", profile)
+	if err == nil {
+		t.Fatal("ожидалась ошибка записи")
+	}
+	if !source.closed.Load() {
+		t.Fatal("источник не закрыт")
+	}
+	if source.readAfterClose.Load() {
+		t.Fatal("ffmpeg читал источник после Close")
+	}
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/repo"
+	"aumusic/pkg/hash"
+	"aumusic/pkg/logger"
+	"aumusic/pkg/totp"
+
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// totpIssuer — название сервиса в приложении-аутентификаторе
+	totpIssuer        = "aumusic"
+	recoveryCodeCount = 10
+	// twoFactorLoginTTL — сколько действует вход по паролю в ожидании второго фактора
+	twoFactorLoginTTL      = 5 * time.Minute
+	twoFactorLoginAudience = "2fa-login"
+	// После maxTwoFactorAttempts неверных кодов подряд попытки не принимаются twoFactorLockout
+	maxTwoFactorAttempts = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+var (
+	ErrInvalidTwoFactorCode  = errs.New(errs.ErrUnauthenticated, "two-factor code is invalid")
+	ErrTwoFactorLocked       = errs.New(errs.ErrUnauthenticated, "too many invalid two-factor codes, try again later")
+	ErrTwoFactorLoginExpired = errs.New(errs.ErrUnauthenticated, "two-factor login expired, sign in again")
+	ErrTwoFactorNotEnabled   = errs.Conflict("two-factor authentication is not enabled", nil)
+	ErrTwoFactorEnabled      = errs.Conflict("two-factor authentication is already enabled", nil)
+	ErrTwoFactorNotEnrolled  = errs.Conflict("start two-factor enrollment first", nil)
+)
+
+// TOTPEnrollment — секрет для приложения-аутентификатора и адрес otpauth:// для QR-кода
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// TwoFactorStatus — состояние второго фактора пользователя
+type TwoFactorStatus struct {
+	Enabled           bool
+	RecoveryCodesLeft int
+}
+
+// EnrollTOTP выдает пользователю новый секрет TOTP. Второй фактор включается только после
+// подтверждения первого кода в ConfirmTOTP; до этого повторный вызов заменяет секрет.
+func EnrollTOTP(ctx context.Context, userId, username string) (TOTPEnrollment, error) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	err = repo.SetPendingTOTP(ctx, Pool, userId, secret)
+	if errors.Is(err, errs.ErrConflict) {
+		return TOTPEnrollment{}, ErrTwoFactorEnabled
+	}
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to save totp secret", zap.Error(err))
+		return TOTPEnrollment{}, err
+	}
+	return TOTPEnrollment{Secret: secret, URI: totp.ProvisioningURI(totpIssuer, username, secret)}, nil
+}
+
+// ConfirmTOTP проверяет первый код из аутентификатора, включает второй фактор и возвращает
+// коды восстановления. Показать их можно только сейчас: хранятся лишь их хэши.
+func ConfirmTOTP(ctx context.Context, userId, code string) ([]string, error) {
+	var codes []string
+	err := checkSecondFactor(ctx, userId, code, false, func(tx pgx.Tx) error {
+		var hashes []string
+		var err error
+		codes, hashes, err = newRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		return repo.ReplaceRecoveryCodes(ctx, tx, userId, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP отключает второй фактор; code — текущий код TOTP или код восстановления
+func DisableTOTP(ctx context.Context, userId, code string) error {
+	return checkSecondFactor(ctx, userId, code, true, func(tx pgx.Tx) error {
+		return repo.DeleteTOTP(ctx, tx, userId)
+	})
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления новыми; прежние перестают действовать
+func RegenerateRecoveryCodes(ctx context.Context, userId, code string) ([]string, error) {
+	var codes []string
+	err := checkSecondFactor(ctx, userId, code, true, func(tx pgx.Tx) error {
+		var hashes []string
+		var err error
+		codes, hashes, err = newRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		return repo.ReplaceRecoveryCodes(ctx, tx, userId, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func GetTwoFactorStatus(ctx context.Context, userId string) (TwoFactorStatus, error) {
+	enabled, err := repo.TOTPEnabled(ctx, Pool, userId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get two-factor status", zap.Error(err))
+		return TwoFactorStatus{}, err
+	}
+	if !enabled {
+		return TwoFactorStatus{}, nil
+	}
+	left, err := repo.CountRecoveryCodes(ctx, Pool, userId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to count recovery codes", zap.Error(err))
+		return TwoFactorStatus{}, err
+	}
+	return TwoFactorStatus{Enabled: true, RecoveryCodesLeft: left}, nil
+}
+
+// LoginTwoFactor — второй шаг входа: по challenge из LoginUser и коду TOTP или коду
+// восстановления открывает сессию
+func LoginTwoFactor(ctx context.Context, challenge, code string) (AuthTokens, error) {
+	userId, err := parseTwoFactorLogin(ctx, challenge)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Invalid two-factor challenge", zap.Error(err))
+		return AuthTokens{}, ErrTwoFactorLoginExpired
+	}
+	if err = checkSecondFactor(ctx, userId, code, true, nil); err != nil {
+		return AuthTokens{}, err
+	}
+	user, err := repo.GetUserById(ctx, Pool, userId)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get user", zap.Error(err))
+		return AuthTokens{}, err
+	}
+	return startSession(ctx, user)
+}
+
+// checkSecondFactor проверяет код пользователя и при успехе выполняет then в той же транзакции.
+// enabled == true требует включенного второго фактора и принимает также коды восстановления,
+// enabled == false — только что выданного секрета, который подтверждается кодом TOTP.
+// Неверные коды считаются, и после maxTwoFactorAttempts подряд попытки временно не принимаются.
+func checkSecondFactor(ctx context.Context, userId, code string, enabled bool, then func(tx pgx.Tx) error) error {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to begin transaction", zap.Error(err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	factor, err := repo.LockTOTP(ctx, tx, userId)
+	switch {
+	case errors.Is(err, errs.ErrNotFound) && enabled:
+		return ErrTwoFactorNotEnabled
+	case errors.Is(err, errs.ErrNotFound):
+		return ErrTwoFactorNotEnrolled
+	case err != nil:
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get totp", zap.Error(err))
+		return err
+	case enabled && factor.EnabledAt == nil:
+		return ErrTwoFactorNotEnabled
+	case !enabled && factor.EnabledAt != nil:
+		return ErrTwoFactorEnabled
+	}
+	now := time.Now()
+	if factor.LockedUntil != nil && now.Before(*factor.LockedUntil) {
+		return ErrTwoFactorLocked
+	}
+
+	step, ok := totp.Validate(factor.Secret, code, now)
+	ok = ok && step > factor.LastStep
+	if !ok && enabled && isRecoveryCode(code) {
+		ok, err = repo.UseRecoveryCode(ctx, tx, userId, hash.HashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to use recovery code", zap.Error(err))
+			return err
+		}
+		step = factor.LastStep
+	}
+	if !ok {
+		attempts := factor.FailedAttempts + 1
+		var lockedUntil *time.Time
+		if attempts >= maxTwoFactorAttempts {
+			until := now.Add(twoFactorLockout)
+			lockedUntil, attempts = &until, 0
+		}
+		if err = repo.SetTOTPFailures(ctx, tx, userId, attempts, lockedUntil); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to save two-factor failure", zap.Error(err))
+			return err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit two-factor failure", zap.Error(err))
+			return err
+		}
+		return ErrInvalidTwoFactorCode
+	}
+
+	if err = repo.AcceptTOTP(ctx, tx, userId, step); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to accept totp", zap.Error(err))
+		return err
+	}
+	if then != nil {
+		if err = then(tx); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to update two-factor authentication", zap.Error(err))
+			return err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to commit two-factor authentication", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// Коды восстановления — 12 символов base32 в нижнем регистре, показываются группами: abcd-efgh-ijkl
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// newRecoveryCodes возвращает коды для пользователя и их хэши для БД
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		plain := recoveryEncoding.EncodeToString(b)[:12]
+		codes[i] = plain[:4] + "-" + plain[4:8] + "-" + plain[8:]
+		hashes[i] = hash.HashToken(plain)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode убирает дефисы, пробелы и регистр, с которыми пользователь мог ввести код
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
+
+func isRecoveryCode(code string) bool {
+	return len(normalizeRecoveryCode(code)) == 12
+}
+
+func signTwoFactorLogin(ctx context.Context, userId string, now time.Time) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Subject:   userId,
+		Audience:  jwt.ClaimStrings{twoFactorLoginAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorLoginTTL)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(getConfig(ctx).JWTSecret))
+}
+
+// parseTwoFactorLogin возвращает пользователя, который прошел первый шаг входа
+func parseTwoFactorLogin(ctx context.Context, challenge string) (string, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(challenge, &claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(getConfig(ctx).JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(twoFactorLoginAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject == "" {
+		return "", errors.New("challenge has no user")
+	}
+	return claims.Subject, nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"aumusic/internal/models"
+	"aumusic/pkg/hash"
+	"aumusic/pkg/totp"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("получено %d кодов и %d хешей, ожидалось %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`)
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("код %q в неверном формате", code)
+		}
+		if seen[code] {
+			t.Errorf("код %q повторяется", code)
+		}
+		seen[code] = true
+		// Пользователь может ввести код без дефисов, с пробелами и в верхнем регистре
+		typed := " " + strings.ToUpper(strings.ReplaceAll(code, "-", " ")) + " "
+		if !isRecoveryCode(typed) {
+			t.Errorf("%q не распознан как код восстановления", typed)
+		}
+		if hash.HashToken(normalizeRecoveryCode(typed)) != hashes[i] {
+			t.Errorf("%q: хеш не совпадает", typed)
+		}
+	}
+	if isRecoveryCode("123456") {
+		t.Fatal("код TOTP распознан как код восстановления")
+	}
+}
+
+func TestTwoFactorLoginChallenge(t *testing.T) {
+	ctx := testContext()
+
+	challenge, err := signTwoFactorLogin(ctx, "user-1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId, err := parseTwoFactorLogin(ctx, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId != "user-1" {
+		t.Fatalf("пользователь %q", userId)
+	}
+
+	expired, err := signTwoFactorLogin(ctx, "user-1", time.Now().Add(-twoFactorLoginTTL-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parseTwoFactorLogin(ctx, expired); err == nil {
+		t.Fatal("просроченный challenge принят")
+	}
+
+	// Ни access-токен, ни состояние входа через провайдера не заменяют пройденную проверку пароля
+	access, _, err := signAccessToken(ctx, models.Session{Id: "session-1", UserId: "user-1"}, "alice", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parseTwoFactorLogin(ctx, access); err == nil {
+		t.Fatal("access-токен принят как challenge")
+	}
+	state, err := signOIDCLogin(ctx, oidcLoginClaims{State: "state-1"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parseTwoFactorLogin(ctx, state); err == nil {
+		t.Fatal("состояние входа через провайдера принято как challenge")
+	}
+
+	// И наоборот: challenge не принимается как access-токен
+	if AccessTokenValid(ctx, challenge) {
+		t.Fatal("challenge принят как access-токен")
+	}
+
+	if _, err = LoginTwoFactor(ctx, "garbage", "123456"); !errors.Is(err, ErrTwoFactorLoginExpired) {
+		t.Fatalf("ожидалась ErrTwoFactorLoginExpired, получено %v", err)
+	}
+}
+
+func TestLoginRequiresSecondFactor(t *testing.T) {
+	ctx := testDB(t)
+	user := testUser(t, ctx, &recordingSender{})
+
+	enrollment, err := EnrollTOTP(ctx, user.Id, user.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovery, err := ConfirmTOTP(ctx, user.Id, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, challenge, err := LoginUser(ctx, user.Username, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge == "" || tokens.AccessToken != "" {
+		t.Fatal("вход по паролю открыл сессию без второго фактора")
+	}
+	// Вход через провайдера проверяет второй фактор так же, как вход по паролю
+	tokens, challenge, err = completeLogin(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge == "" || tokens.AccessToken != "" {
+		t.Fatal("вход через провайдера открыл сессию без второго фактора")
+	}
+
+	tokens, err = LoginTwoFactor(ctx, challenge, recovery[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !AccessTokenValid(ctx, tokens.AccessToken) {
+		t.Fatal("после второго фактора не выдан access-токен")
+	}
+}
@@ -0,0 +1,342 @@
+package service
+
+import (
+	"aumusic/internal/errs"
+	"aumusic/internal/models"
+	"aumusic/internal/repo"
+	"aumusic/pkg/logger"
+
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	MaxChunkSize          = 64 << 20
+	uploadJanitorInterval = 10 * time.Minute
+)
+
+var (
+	ErrOffsetMismatch   = errs.New(errs.ErrConflict, "upload offset does not match the server offset")
+	ErrUploadTooLarge   = errs.Validation("upload exceeds the declared size")
+	ErrUploadIncomplete = errs.New(errs.ErrConflict, "upload is not complete")
+	ErrUploadFinishing  = errs.New(errs.ErrConflict, "upload is already being finished")
+)
+
+// uploadPrefix — каталог в хранилище с частями незавершенной загрузки
+func uploadPrefix(sessionId string) string {
+	return path.Join("uploads", sessionId) + "/"
+}
+
+// chunkKey кодирует смещение части в ключе, чтобы при сборке упорядочить части сортировкой ключей.
+// Суффикс не дает параллельным запросам с одинаковым смещением перезаписать друг друга.
+func chunkKey(sessionId string, offset int64) string {
+	return fmt.Sprintf("%s%020d-%s", uploadPrefix(sessionId), offset, uuid.NewString())
+}
+
+func chunkOffset(key string) (int64, error) {
+	name := path.Base(key)
+	if i := strings.IndexByte(name, '-'); i >= 0 {
+		name = name[:i]
+	}
+	return strconv.ParseInt(name, 10, 64)
+}
+
+// ownUploadSession загружает сессию загрузки и проверяет, что она принадлежит пользователю userId
+func ownUploadSession(ctx context.Context, userId, id string) (models.UploadSession, error) {
+	session, err := repo.GetUploadSession(ctx, Pool, id)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get upload session", zap.Error(err))
+		return models.UploadSession{}, err
+	}
+	if userId != session.UserId {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "User is not owner of upload session")
+		return models.UploadSession{}, ErrNotOwner
+	}
+
+	return session, nil
+}
+
+// CreateUpload начинает возобновляемую загрузку одного файла заявленного размера
+func CreateUpload(ctx context.Context, userId, filename string, size int64, artist, album string) (models.UploadSession, error) {
+	if sanitizeName(filename) == "." || sanitizeName(filename) == "/" {
+		return models.UploadSession{}, errs.Validation("filename is required")
+	}
+	if size <= 0 {
+		return models.UploadSession{}, errs.Validation("size must be positive")
+	}
+	if size > MaxUploadSize {
+		return models.UploadSession{}, ErrUploadTooLarge
+	}
+
+	session, err := repo.CreateUploadSession(ctx, Pool, models.UploadSession{
+		UserId:   userId,
+		Filename: filename,
+		Size:     size,
+		Artist:   artist,
+		Album:    album,
+	})
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to create upload session", zap.Error(err))
+		return models.UploadSession{}, err
+	}
+	return session, nil
+}
+
+func GetUpload(ctx context.Context, userId, id string) (models.UploadSession, error) {
+	session, err := ownUploadSession(ctx, userId, id)
+	return session, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteUploadChunk дописывает часть файла, начинающуюся со смещения offset, и возвращает новое смещение.
+// offset должен совпадать с тем, сколько байт сервер уже получил.
+func WriteUploadChunk(ctx context.Context, userId, id string, offset int64, body io.Reader) (int64, error) {
+	session, err := ownUploadSession(ctx, userId, id)
+	if err != nil {
+		return 0, err
+	}
+	if offset != session.Offset {
+		return session.Offset, ErrOffsetMismatch
+	}
+
+	remaining := session.Size - offset
+	counter := &countingReader{r: io.LimitReader(body, remaining+1)}
+	key := chunkKey(id, offset)
+	if err = Storage.Put(ctx, key, counter, -1, "application/octet-stream"); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to store upload chunk", zap.Error(err))
+		Storage.Delete(ctx, key)
+		return session.Offset, err
+	}
+	if counter.n == 0 || counter.n > remaining {
+		Storage.Delete(ctx, key)
+		if counter.n > remaining {
+			return session.Offset, ErrUploadTooLarge
+		}
+		return session.Offset, nil
+	}
+
+	ok, err := repo.AdvanceUploadSession(ctx, Pool, id, offset, offset+counter.n)
+	if err != nil || !ok {
+		Storage.Delete(ctx, key)
+		if err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to advance upload session", zap.Error(err))
+			return session.Offset, err
+		}
+		return session.Offset, ErrOffsetMismatch
+	}
+	removeSupersededChunks(ctx, id, offset, key)
+	return offset + counter.n, nil
+}
+
+// removeSupersededChunks удаляет части с тем же смещением, что и принятая часть key: их записали
+// проигравшие параллельные запросы, которые не успели убрать за собой
+func removeSupersededChunks(ctx context.Context, id string, offset int64, key string) {
+	objects, err := Storage.List(ctx, uploadPrefix(id))
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to list upload chunks", zap.Error(err))
+		return
+	}
+	for _, object := range objects {
+		if object.Key == key {
+			continue
+		}
+		if chunk, err := chunkOffset(object.Key); err == nil && chunk == offset {
+			if err := Storage.Delete(ctx, object.Key); err != nil {
+				logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove superseded upload chunk", zap.Error(err))
+			}
+		}
+	}
+}
+
+// FinishUpload собирает части во временный файл и сохраняет его как трек так же, как LoadTracks
+func FinishUpload(ctx context.Context, userId, id string) (models.Track, error) {
+	session, err := ownUploadSession(ctx, userId, id)
+	if err != nil {
+		return models.Track{}, err
+	}
+	if session.Offset != session.Size {
+		return models.Track{}, ErrUploadIncomplete
+	}
+	claimed, err := repo.ClaimUploadSession(ctx, Pool, id)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to claim upload session", zap.Error(err))
+		return models.Track{}, err
+	}
+	if !claimed {
+		return models.Track{}, ErrUploadFinishing
+	}
+
+	track, err := finishUpload(ctx, session)
+	if err != nil && !errors.Is(err, ErrNotAudio) && !errors.Is(err, ErrDuplicate) {
+		// Сессия остается, и сборку можно повторить
+		if releaseErr := repo.ReleaseUploadSession(ctx, Pool, id); releaseErr != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to release upload session", zap.Error(releaseErr))
+		}
+		return models.Track{}, err
+	}
+	// Не-аудио и дубликат повторная загрузка не исправит, поэтому сессия удаляется и в этих случаях
+	if cleanErr := removeUpload(ctx, id); cleanErr != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove upload session", zap.Error(cleanErr))
+	}
+	if err != nil {
+		return models.Track{}, err
+	}
+	return trackFromDB(track), nil
+}
+
+func finishUpload(ctx context.Context, session models.UploadSession) (models.TrackDB, error) {
+	file, err := os.CreateTemp("", "aumusic-upload-*")
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to create temp file", zap.Error(err))
+		return models.TrackDB{}, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	h := sha256.New()
+	if err = assembleUpload(ctx, session, io.MultiWriter(file, h)); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to assemble upload", zap.Error(err))
+		return models.TrackDB{}, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return models.TrackDB{}, err
+	}
+
+	return storeTrack(ctx, file, session.Filename, hex.EncodeToString(h.Sum(nil)), session.Size, session.Artist, session.Album, session.UserId, nil)
+}
+
+func assembleUpload(ctx context.Context, session models.UploadSession, dst io.Writer) error {
+	objects, err := Storage.List(ctx, uploadPrefix(session.Id))
+	if err != nil {
+		return err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	var expected int64
+	for _, object := range objects {
+		offset, err := chunkOffset(object.Key)
+		if err != nil {
+			return err
+		}
+		if offset < expected {
+			// Две части с одним смещением: неизвестно, какую из них принял сервер
+			return fmt.Errorf("upload %s: ambiguous chunk at offset %d", session.Id, offset)
+		}
+		if offset > expected {
+			return fmt.Errorf("upload %s: missing chunk at offset %d", session.Id, expected)
+		}
+		body, err := Storage.OpenRange(ctx, object.Key, 0, -1)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(dst, body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+		expected += n
+	}
+	if expected != session.Size {
+		return fmt.Errorf("upload %s: assembled %d of %d bytes", session.Id, expected, session.Size)
+	}
+	return nil
+}
+
+func AbortUpload(ctx context.Context, userId, id string) error {
+	if _, err := ownUploadSession(ctx, userId, id); err != nil {
+		return err
+	}
+	if err := removeUpload(ctx, id); err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove upload session", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// removeUpload удаляет части загрузки из хранилища и строку сессии
+func removeUpload(ctx context.Context, id string) error {
+	objects, err := Storage.List(ctx, uploadPrefix(id))
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := Storage.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return repo.DeleteUploadSession(ctx, Pool, id)
+}
+
+// RunUploadJanitor периодически удаляет сессии загрузки, которые не обновлялись дольше ttl,
+// и части загрузок, для которых сессии уже нет. Работает до отмены ctx.
+func RunUploadJanitor(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(uploadJanitorInterval)
+	defer ticker.Stop()
+	for {
+		cleanUploads(ctx, ttl)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func cleanUploads(ctx context.Context, ttl time.Duration) {
+	ids, err := repo.GetStaleUploadSessions(ctx, Pool, time.Now().Add(-ttl))
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to get stale upload sessions", zap.Error(err))
+		return
+	}
+	for _, id := range ids {
+		if err := removeUpload(ctx, id); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove stale upload session", zap.String("id", id), zap.Error(err))
+			continue
+		}
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Removed stale upload session", zap.String("id", id))
+	}
+
+	objects, err := Storage.List(ctx, "uploads/")
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to list upload chunks", zap.Error(err))
+		return
+	}
+	orphans := make(map[string]bool)
+	for _, object := range objects {
+		id := path.Base(path.Dir(object.Key))
+		orphan, checked := orphans[id]
+		if !checked {
+			_, err := repo.GetUploadSession(ctx, Pool, id)
+			orphan = errors.Is(err, errs.ErrNotFound)
+			orphans[id] = orphan
+		}
+		if orphan {
+			if err := Storage.Delete(ctx, object.Key); err != nil {
+				logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to remove orphan upload chunk", zap.Error(err))
+			}
+		}
+	}
+}
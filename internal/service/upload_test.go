@@ -0,0 +1,55 @@
+package service
+
+import (
+	"aumusic/internal/models"
+	"aumusic/pkg/storage"
+
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAssembleUpload(t *testing.T) {
+	ctx := context.Background()
+	Storage = storage.NewMemory()
+	t.Cleanup(func() { Storage = nil })
+
+	session := models.UploadSession{Id: "session-1", Size: 6}
+	for offset, chunk := range map[int64]string{0: "abc", 3: "def"} {
+		if err := Storage.Put(ctx, chunkKey(session.Id, offset), strings.NewReader(chunk), -1, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := assembleUpload(ctx, session, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "abcdef" {
+		t.Fatalf("собрано %q", buf.String())
+	}
+
+	// Часть от проигравшего параллельного запроса удаляет тот, чья часть принята
+	superseded := chunkKey(session.Id, 3)
+	if err := Storage.Put(ctx, superseded, strings.NewReader("xyz"), -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := assembleUpload(ctx, session, &bytes.Buffer{}); err == nil {
+		t.Fatal("две части с одним смещением должны давать ошибку")
+	}
+	objects, _ := Storage.List(ctx, uploadPrefix(session.Id))
+	var accepted string
+	for _, object := range objects {
+		if object.Key != superseded && strings.Contains(object.Key, "00000000000000000003-") {
+			accepted = object.Key
+		}
+	}
+	removeSupersededChunks(ctx, session.Id, 3, accepted)
+	buf.Reset()
+	if err := assembleUpload(ctx, session, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "abcdef" {
+		t.Fatalf("собрано %q", buf.String())
+	}
+}
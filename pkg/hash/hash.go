@@ -2,7 +2,10 @@ package hash
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"golang.org/x/crypto/argon2"
@@ -125,3 +128,24 @@ func decodeHash(encodedHash string) (*Argon2Params, []byte, []byte, error) {
 
 	return params, salt, hash, nil
 }
+
+// NewToken возвращает случайный токен из n байт в base64url без выравнивания
+func NewToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken возвращает SHA-256 токена в hex. Длинные случайные токены не нужно замедлять
+// Argon2, как пароли, а по такому хэшу можно искать в БД.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// EqualTokenHash сравнивает токен с хэшем HashToken за постоянное время
+func EqualTokenHash(token, tokenHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(tokenHash)) == 1
+}
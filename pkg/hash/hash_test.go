@@ -32,3 +32,25 @@ func TestArgon2(t *testing.T) {
 		t.Fatal("Пароль верный (ожидалось false)")
 	}
 }
+
+func TestTokenHash(t *testing.T) {
+	token, err := NewToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 43 {
+		t.Fatalf("длина токена %d, ожидалось 43", len(token))
+	}
+	other, _ := NewToken(32)
+	if token == other {
+		t.Fatal("два токена совпали")
+	}
+
+	h := HashToken(token)
+	if !EqualTokenHash(token, h) {
+		t.Fatal("токен не совпал со своим хешем")
+	}
+	if EqualTokenHash(other, h) {
+		t.Fatal("чужой токен совпал с хешем")
+	}
+}
@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"aumusic/pkg/logger"
+
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// File сохраняет каждое письмо в отдельный файл .eml, который открывается почтовым клиентом
+type File struct {
+	dir  string
+	from string
+}
+
+func NewFile(dir, from string) (*File, error) {
+	if _, err := parseAddress(from); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir, from: from}, nil
+}
+
+func (f *File) Send(ctx context.Context, msg Message) error {
+	from, to, err := addresses(f.from, msg.To)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	data, err := format(from, to, msg, now)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := now.UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+	// Письма содержат одноразовые ссылки, поэтому доступны только владельцу процесса
+	return os.WriteFile(filepath.Join(f.dir, name), data, 0o600)
+}
+
+// Log пишет письма в лог приложения. Ссылки из писем попадают в лог целиком,
+// поэтому этот вариант подходит только для разработки.
+type Log struct {
+	from string
+}
+
+func NewLog(from string) *Log {
+	return &Log{from: from}
+}
+
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	if _, _, err := addresses(l.from, msg.To); err != nil {
+		return err
+	}
+	logger.GetLoggerFromCtx(ctx).Info(ctx, "Mail",
+		zap.String("to", msg.To), zap.String("subject", msg.Subject), zap.String("text", msg.Text))
+	return nil
+}
+
+func addresses(from, to string) (*mail.Address, *mail.Address, error) {
+	fromAddr, err := parseAddress(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	toAddr, err := parseAddress(to)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fromAddr, toAddr, nil
+}
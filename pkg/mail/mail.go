@@ -0,0 +1,119 @@
+// Package mail отправляет письма через SMTP или, для разработки и тестов, складывает их
+// в файлы или в лог. Реализацию выбирает New по MAIL_TYPE; значения по умолчанию у него нет,
+// чтобы одноразовые ссылки из писем не попали в лог рабочего сервера по недосмотру.
+package mail
+
+import (
+	"aumusic/pkg/logger"
+
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	Type string `yaml:"MAIL_TYPE" env:"MAIL_TYPE"`
+	From string `yaml:"MAIL_FROM" env:"MAIL_FROM" env-default:"aumusic <noreply@localhost>"`
+
+	Host     string `yaml:"MAIL_SMTP_HOST" env:"MAIL_SMTP_HOST"`
+	Port     string `yaml:"MAIL_SMTP_PORT" env:"MAIL_SMTP_PORT" env-default:"587"`
+	Username string `yaml:"MAIL_SMTP_USERNAME" env:"MAIL_SMTP_USERNAME"`
+	Password string `yaml:"MAIL_SMTP_PASSWORD" env:"MAIL_SMTP_PASSWORD"`
+	// ImplicitTLS — TLS с первого байта (обычно порт 465); без него STARTTLS используется, если сервер его предлагает
+	ImplicitTLS bool `yaml:"MAIL_SMTP_TLS" env:"MAIL_SMTP_TLS"`
+
+	// Dir — каталог для писем при MAIL_TYPE=file
+	Dir string `yaml:"MAIL_DIR" env:"MAIL_DIR" env-default:"/app/media/mail"`
+}
+
+var ErrBadAddress = errors.New("mail: invalid address")
+
+// Message — простое текстовое письмо одному получателю
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New выбирает реализацию по cfg.Type: smtp, file или log
+func New(ctx context.Context, cfg Config) (Sender, error) {
+	switch cfg.Type {
+	case "":
+		return nil, errors.New("mail: MAIL_TYPE is required (smtp, file or log)")
+	case "smtp":
+		if cfg.Host == "" {
+			return nil, errors.New("mail: MAIL_SMTP_HOST is required for smtp")
+		}
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Sending mail over smtp", zap.String("host", cfg.Host), zap.String("port", cfg.Port))
+		return NewSMTP(cfg), nil
+	case "file":
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Writing mail to files", zap.String("dir", cfg.Dir))
+		return NewFile(cfg.Dir, cfg.From)
+	case "log":
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Writing mail to log")
+		return NewLog(cfg.From), nil
+	}
+	return nil, fmt.Errorf("mail: unknown type %q", cfg.Type)
+}
+
+// parseAddress проверяет адрес и отбрасывает переводы строк, через которые в письмо
+// можно было бы подставить свои заголовки
+func parseAddress(addr string) (*mail.Address, error) {
+	if strings.ContainsAny(addr, "\r\n") {
+		return nil, ErrBadAddress
+	}
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadAddress, addr)
+	}
+	return parsed, nil
+}
+
+// format собирает письмо по RFC 5322: текст в UTF-8 в quoted-printable, тема в encoded-word
+func format(from *mail.Address, to *mail.Address, msg Message, now time.Time) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndexByte(from.Address, '@'); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", strings.NewReplacer("\r", "", "\n", " ").Replace(msg.Subject)))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(msg.Text, "\r\n", "\n"), "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
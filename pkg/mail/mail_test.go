@@ -0,0 +1,207 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// smtpSink — минимальный SMTP-сервер, который принимает одно письмо и запоминает его
+type smtpSink struct {
+	addr     string
+	auth     string
+	from     string
+	rcpt     []string
+	received chan []byte
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	sink := &smtpSink{addr: ln.Addr().String(), received: make(chan []byte, 1)}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sink.serve(conn)
+	}()
+	return sink
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 sink ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250-sink")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			plain, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			s.auth = string(plain)
+			reply("235 ok")
+		case "MAIL":
+			s.from = line
+			reply("250 ok")
+		case "RCPT":
+			s.rcpt = append(s.rcpt, line)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data []byte
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data = append(data, strings.TrimPrefix(l, ".")...)
+			}
+			s.received <- data
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func readMessage(t *testing.T, data []byte) (*mail.Message, string) {
+	t.Helper()
+	m, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, string(body)
+}
+
+func TestSMTP(t *testing.T) {
+	sink := newSMTPSink(t)
+	host, port, _ := net.SplitHostPort(sink.addr)
+	sender := NewSMTP(Config{Host: host, Port: port, Username: "app", Password: "pass", From: "aumusic <noreply@example.com>"})
+
+	text := "Привет!\nОткройте ссылку: https://music.example.com/verify-email?token=" + strings.Repeat("x", 80)
+	err := sender.Send(context.Background(), Message{To: "alice@example.com", Subject: "Подтвердите адрес", Text: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := <-sink.received
+	if sink.auth != "\x00app\x00pass" {
+		t.Errorf("AUTH %q", sink.auth)
+	}
+	if from := strings.SplitN(sink.from, " BODY", 2)[0]; from != "MAIL FROM:<noreply@example.com>" {
+		t.Errorf("%s", from)
+	}
+	if !slices.Equal(sink.rcpt, []string{"RCPT TO:<alice@example.com>"}) {
+		t.Errorf("получатели %q", sink.rcpt)
+	}
+
+	m, body := readMessage(t, data)
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Подтвердите адрес" {
+		t.Errorf("тема %q", subject)
+	}
+	if to := m.Header.Get("To"); to != "<alice@example.com>" {
+		t.Errorf("To %q", to)
+	}
+	if m.Header.Get("Message-ID") == "" {
+		t.Error("нет Message-ID")
+	}
+	// net/smtp завершает данные переводом строки перед точкой
+	if want := strings.ReplaceAll(text, "\n", "\r\n"); strings.TrimSuffix(body, "\r\n") != want {
+		t.Errorf("текст %q, ожидался %q", body, want)
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	sender := NewLog("noreply@example.com")
+	for _, to := range []string{"alice@example.com\r\nBcc: eve@example.com", "not an address"} {
+		if err := sender.Send(context.Background(), Message{To: to, Subject: "x"}); !errors.Is(err, ErrBadAddress) {
+			t.Errorf("%q: ожидалась ErrBadAddress, получено %v", to, err)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	sender, err := NewFile(dir, "noreply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Перевод строки в теме не должен начать новый заголовок
+	err = sender.Send(context.Background(), Message{To: "bob@example.com", Subject: "Reset\r\nBcc: eve@example.com", Text: "line 1\nline 2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0].Name(), ".eml") {
+		t.Fatalf("в каталоге %v, ожидалось одно письмо .eml", files)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, body := readMessage(t, data)
+	if bcc := m.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("в письмо попал заголовок Bcc: %q", bcc)
+	}
+	if body != "line 1\r\nline 2" {
+		t.Errorf("текст %q", body)
+	}
+}
+
+func TestNew(t *testing.T) {
+	// Тип не задан, SMTP без адреса сервера, неизвестный тип
+	for _, cfg := range []Config{{}, {Type: "smtp"}, {Type: "pigeon"}} {
+		if _, err := New(context.Background(), cfg); err == nil {
+			t.Errorf("%+v: ожидалась ошибка", cfg)
+		}
+	}
+	sender, err := New(context.Background(), Config{Type: "log", From: "noreply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sender.(*Log); !ok {
+		t.Fatalf("получен %T, ожидался *Log", sender)
+	}
+}
@@ -16,9 +16,11 @@ type Config struct {
 	AccessKey string `yaml:"access_key" env:"MINIO_ACCESS_KEY" env-default:"minio"`
 	SecretKey string `yaml:"secret_key" env:"MINIO_SECRET_KEY" env-default:"minio123"`
 	UseSSL    bool   `yaml:"use_ssl" env:"MINIO_USE_SSL" env-default:"false"`
+	Bucket    string `yaml:"bucket" env:"MINIO_BUCKET" env-default:"music"`
 }
 
-func New(ctx context.Context, endpoint, accessKey, secretKey string, useSSL bool) (*minio.Client, error) {
+// New подключается к MinIO и создает бакет, если его еще нет
+func New(ctx context.Context, endpoint, accessKey, secretKey, bucket string, useSSL bool) (*minio.Client, error) {
 	minioClient, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
 		Secure: useSSL,
@@ -30,5 +32,18 @@ func New(ctx context.Context, endpoint, accessKey, secretKey string, useSSL bool
 
 	log.Printf("%#v\n", minioClient) // minioClient is now set up
 
+	exists, err := minioClient.BucketExists(ctx, bucket)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to check minio bucket", zap.Error(err))
+		return nil, err
+	}
+	if !exists {
+		if err := minioClient.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			logger.GetLoggerFromCtx(ctx).Info(ctx, "Failed to create minio bucket", zap.Error(err))
+			return nil, err
+		}
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Created minio bucket", zap.String("bucket", bucket))
+	}
+
 	return minioClient, nil
 }
@@ -0,0 +1,37 @@
+package minio
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// Тест запускается против локального контейнера MinIO:
+// MINIO_TEST_ENDPOINT=localhost:9000 go test ./pkg/minio/
+func TestNewCreatesBucket(t *testing.T) {
+	endpoint := os.Getenv("MINIO_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_TEST_ENDPOINT is not set")
+	}
+
+	ctx := context.Background()
+	bucket := "aumusic-test"
+	client, err := New(ctx, endpoint, "minio", "minio123", bucket, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.RemoveBucket(ctx, bucket)
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("бакет не создан")
+	}
+
+	// Повторный вызов не должен падать на существующем бакете
+	if _, err := New(ctx, endpoint, "minio", "minio123", bucket, false); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,211 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider — минимальный провайдер OpenID Connect: discovery, JWKS и token endpoint,
+// который проверяет PKCE и выдает ID-токен с claims
+type mockProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	// challenges — code_challenge, запомненные для выданных кодов
+	challenges map[string]string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{key: key, challenges: make(map[string]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		challenge, ok := m.challenges[r.PostFormValue("code")]
+		switch {
+		case id != "aumusic" || secret != "s3cret":
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		case !ok || CodeChallenge(r.PostFormValue("code_verifier")) != challenge:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, m.claims), "token_type": "Bearer"})
+		}
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// authorize имитирует вход пользователя у провайдера: запоминает code_challenge и возвращает код
+func (m *mockProvider) authorize(t *testing.T, authURL string) (string, url.Values) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	m.challenges["code-1"] = query.Get("code_challenge")
+	return "code-1", query
+}
+
+func (m *mockProvider) idClaims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            m.URL,
+		"aud":            "aumusic",
+		"sub":            "user-42",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+}
+
+func TestLoginFlow(t *testing.T) {
+	m := newMockProvider(t)
+	p := New(Config{Issuer: m.URL, ClientID: "aumusic", ClientSecret: "s3cret", Scopes: []string{"email"}, RedirectURL: "http://app/auth/oidc/callback"}, nil)
+	ctx := context.Background()
+
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, query := m.authorize(t, authURL)
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"code_challenge_method": "S256",
+		"scope":                 "openid email",
+		"state":                 "state-1",
+		"redirect_uri":          "http://app/auth/oidc/callback",
+	} {
+		if got := query.Get(param); got != want {
+			t.Errorf("%s = %q, ожидалось %q", param, got, want)
+		}
+	}
+
+	m.claims = m.idClaims("nonce-1")
+	claims, err := p.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Claims{Subject: "user-42", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}); claims != want {
+		t.Fatalf("получено %+v, ожидалось %+v", claims, want)
+	}
+
+	// Код без верного code_verifier провайдер не обменяет
+	if _, err = p.Exchange(ctx, code, "other-verifier", "nonce-1"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("ожидалась ошибка invalid_grant, получено %v", err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	m := newMockProvider(t)
+	p := New(Config{Issuer: m.URL, ClientID: "aumusic", RedirectURL: "http://app/cb"}, nil)
+	ctx := context.Background()
+
+	claims := m.idClaims("nonce-1")
+	claims["email_verified"] = "true"
+	got, err := p.VerifyIDToken(ctx, m.sign(t, claims), "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.EmailVerified {
+		t.Fatal(`email_verified "true" не принят`)
+	}
+
+	if _, err = p.VerifyIDToken(ctx, m.sign(t, m.idClaims("nonce-1")), "nonce-2"); !errors.Is(err, ErrNonceMismatch) {
+		t.Fatalf("ожидалась ErrNonceMismatch, получено %v", err)
+	}
+
+	for name, change := range map[string]func(jwt.MapClaims){
+		"audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"expired":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"azp":      func(c jwt.MapClaims) { c["aud"] = []string{"aumusic", "other"} },
+		"subject":  func(c jwt.MapClaims) { delete(c, "sub") },
+	} {
+		claims := m.idClaims("nonce-1")
+		change(claims)
+		if _, err := p.VerifyIDToken(ctx, m.sign(t, claims), "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: ожидалась ErrInvalidIDToken, получено %v", name, err)
+		}
+	}
+
+	// Подпись чужим ключом не принимается
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, m.idClaims("nonce-1"))
+	forged.Header["kid"] = "test"
+	raw, err := forged.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.VerifyIDToken(ctx, raw, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("ожидалась ErrInvalidIDToken, получено %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	p := New(Config{Issuer: m.URL + "/", ClientID: "aumusic", RedirectURL: "http://app/cb"}, nil)
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Fatalf("ожидалась ошибка issuer, получено %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+type MinIO struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewMinIO(client *minio.Client, bucket string) *MinIO {
+	return &MinIO{client: client, bucket: bucket}
+}
+
+func notFound(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *MinIO) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *MinIO) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	end := int64(0)
+	if length > 0 {
+		end = offset + length - 1
+	}
+	if offset > 0 || end > 0 {
+		if err := opts.SetRange(offset, end); err != nil {
+			return nil, err
+		}
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, key, opts)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return object, nil
+}
+
+func (s *MinIO) Stat(ctx context.Context, key string) (Object, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return Object{}, notFound(err)
+	}
+	return Object{
+		Key:         key,
+		Size:        info.Size,
+		ModTime:     info.LastModified,
+		ContentType: info.ContentType,
+	}, nil
+}
+
+func (s *MinIO) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *MinIO) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		objects = append(objects, Object{
+			Key:         info.Key,
+			Size:        info.Size,
+			ModTime:     info.LastModified,
+			ContentType: info.ContentType,
+		})
+	}
+	return objects, nil
+}
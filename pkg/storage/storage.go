@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"aumusic/pkg/logger"
+	"aumusic/pkg/minio"
+
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var ErrNotFound = errors.New("storage: object not found")
+
+type Config struct {
+	Type string `yaml:"STORAGE_TYPE" env:"STORAGE_TYPE" env-default:"minio"`
+	Path string `yaml:"STORAGE_PATH" env:"STORAGE_PATH" env-default:"/app/media/music"`
+}
+
+type Object struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// Storage хранит файлы по ключам вида "a/b/c". Delete для отсутствующего ключа не считается ошибкой.
+type Storage interface {
+	// Put сохраняет содержимое r; size = -1, если размер заранее неизвестен
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// OpenRange открывает length байт начиная с offset; length < 0 читает до конца объекта
+	OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// New выбирает реализацию хранилища по cfg.Type: fs, minio или memory
+func New(ctx context.Context, cfg Config, minioCfg minio.Config) (Storage, error) {
+	switch cfg.Type {
+	case "fs":
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Using filesystem storage", zap.String("path", cfg.Path))
+		return NewFS(cfg.Path)
+	case "minio", "s3":
+		client, err := minio.New(ctx, minioCfg.Endpoint, minioCfg.AccessKey, minioCfg.SecretKey, minioCfg.Bucket, minioCfg.UseSSL)
+		if err != nil {
+			return nil, err
+		}
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Using minio storage", zap.String("bucket", minioCfg.Bucket))
+		return NewMinIO(client, minioCfg.Bucket), nil
+	case "memory":
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "Using in-memory storage")
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("storage: unknown type %q", cfg.Type)
+}
+
+// Reader читает объект с произвольным позиционированием поверх OpenRange,
+// поэтому его можно передавать в http.ServeContent
+type Reader struct {
+	ctx     context.Context
+	storage Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+// NewReader проверяет, что объект существует, и возвращает ленивый Reader для него
+func NewReader(ctx context.Context, s Storage, key string) (*Reader, Object, error) {
+	object, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return &Reader{ctx: ctx, storage: s, key: key, size: object.Size}, object, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.storage.OpenRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+	if abs != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+func (r *Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
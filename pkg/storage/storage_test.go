@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	data := "0123456789"
+
+	if err := s.Put(ctx, "user/artist/album/track.mp3", strings.NewReader(data), int64(len(data)), "audio/mpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "other/track.mp3", strings.NewReader(data), -1, "audio/mpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := s.Stat(ctx, "user/artist/album/track.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.Size != int64(len(data)) {
+		t.Fatalf("размер %d, ожидалось %d", object.Size, len(data))
+	}
+
+	body, err := s.OpenRange(ctx, "user/artist/album/track.mp3", 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "3456" {
+		t.Fatalf("диапазон %q, ожидалось %q", got, "3456")
+	}
+
+	objects, err := s.List(ctx, "user/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "user/artist/album/track.mp3" {
+		t.Fatalf("неожиданный список объектов: %+v", objects)
+	}
+
+	reader, _, err := NewReader(ctx, s, "user/artist/album/track.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Seek(-2, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	got, err = io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "89" {
+		t.Fatalf("чтение после Seek %q, ожидалось %q", got, "89")
+	}
+
+	if err := s.Delete(ctx, "user/artist/album/track.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "user/artist/album/track.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(ctx, "user/artist/album/track.mp3"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ожидалась ErrNotFound, получено %v", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStorage(t, NewMemory())
+}
+
+func TestFS(t *testing.T) {
+	s, err := NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+}
+
+func TestFSKeyEscape(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := s.path("../../etc/passwd"); !strings.HasPrefix(p, root) {
+		t.Fatalf("ключ вышел за пределы корня: %s", p)
+	}
+}
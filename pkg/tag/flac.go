@@ -0,0 +1,75 @@
+package tag
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+func readFLAC(r io.ReadSeeker) (Tags, error) {
+	if _, err := r.Seek(4, io.SeekStart); err != nil {
+		return Tags{}, err
+	}
+
+	var t Tags
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return Tags{}, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		switch blockType {
+		case flacStreamInfo, flacVorbisComment, flacPicture:
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return Tags{}, err
+			}
+			switch blockType {
+			case flacStreamInfo:
+				t.Duration = flacDuration(block)
+			case flacVorbisComment:
+				duration, picture := t.Duration, t.Picture
+				t = parseVorbisComment(block)
+				t.Duration = duration
+				if picture.better(t.Picture) {
+					t.Picture = picture
+				}
+			case flacPicture:
+				if picture := parseFLACPicture(block); picture.better(t.Picture) {
+					t.Picture = picture
+				}
+			}
+		default:
+			if _, err := r.Seek(length, io.SeekCurrent); err != nil {
+				return Tags{}, err
+			}
+		}
+
+		if last {
+			return t, nil
+		}
+	}
+}
+
+// flacDuration вычисляет длительность по частоте дискретизации и числу сэмплов из STREAMINFO
+func flacDuration(b []byte) time.Duration {
+	if len(b) < 18 {
+		return 0
+	}
+	v := binary.BigEndian.Uint64(b[10:18])
+	sampleRate := v >> 44
+	totalSamples := v & (1<<36 - 1)
+	if sampleRate == 0 {
+		return 0
+	}
+	return seconds(float64(totalSamples) / float64(sampleRate))
+}
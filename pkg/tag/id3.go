@@ -0,0 +1,280 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Текстовые кадры ID3v2.2 переводятся в имена ID3v2.3/2.4
+var id3v22Frames = map[string]string{
+	"TT2": "TIT2",
+	"TP1": "TPE1",
+	"TAL": "TALB",
+	"TP2": "TPE2",
+	"TRK": "TRCK",
+	"TPA": "TPOS",
+	"TYE": "TYER",
+	"TCO": "TCON",
+}
+
+// maxID3Body — наибольший тег ID3v2, который читается в память: с запасом вмещает обложку
+// допустимого размера. Тег больше пропускается целиком, длительность при этом считается.
+const maxID3Body = 24 << 20
+
+func readMP3(r io.ReadSeeker, size int64) (Tags, error) {
+	var t Tags
+	audioStart, audioEnd := int64(0), size
+
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(r, head); err == nil && bytes.Equal(head[:3], []byte("ID3")) {
+		bodySize := syncsafe(head[6:10])
+		tagSize := int64(10 + bodySize)
+		if head[5]&0x10 != 0 {
+			// футер
+			tagSize += 10
+		}
+		// Размер из заголовка не заслуживает доверия, пока не сверен с размером файла
+		if tagSize > size {
+			return Tags{}, errors.New("tag: id3 tag exceeds file size")
+		}
+		if bodySize <= maxID3Body {
+			body := make([]byte, bodySize)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return Tags{}, err
+			}
+			t = parseID3v2(head, body)
+		}
+		audioStart = tagSize
+	}
+
+	if size >= 128 {
+		tail := make([]byte, 128)
+		if _, err := r.Seek(size-128, io.SeekStart); err != nil {
+			return Tags{}, err
+		}
+		if _, err := io.ReadFull(r, tail); err == nil && bytes.Equal(tail[:3], []byte("TAG")) {
+			t.merge(parseID3v1(tail))
+			audioEnd = size - 128
+		}
+	}
+
+	duration, err := mp3Duration(r, audioStart, audioEnd)
+	if err != nil {
+		return Tags{}, err
+	}
+	t.Duration = duration
+	return t, nil
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// unsync убирает байты 0x00, вставленные после 0xFF схемой unsynchronisation
+func unsync(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xFF && i+1 < len(b) && b[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+// id3v2Frame — один кадр тега после снятия флагов кадра
+type id3v2Frame struct {
+	id   string
+	data []byte
+}
+
+// id3v2Frames разбирает тело тега (без 10-байтного заголовка) на кадры.
+// Сжатые и зашифрованные кадры пропускаются.
+func id3v2Frames(head, body []byte) []id3v2Frame {
+	major, flags := head[3], head[5]
+	if flags&0x80 != 0 && major < 4 {
+		body = unsync(body)
+	}
+
+	pos := 0
+	if flags&0x40 != 0 && len(body) >= 4 {
+		switch major {
+		case 3:
+			pos = 4 + int(binary.BigEndian.Uint32(body[:4]))
+		case 4:
+			pos = syncsafe(body[:4])
+		}
+	}
+
+	var frames []id3v2Frame
+	for {
+		var id string
+		var frameSize int
+		var frameFlags [2]byte
+		if major == 2 {
+			if pos+6 > len(body) {
+				break
+			}
+			id = string(body[pos : pos+3])
+			frameSize = int(body[pos+3])<<16 | int(body[pos+4])<<8 | int(body[pos+5])
+			pos += 6
+		} else {
+			if pos+10 > len(body) {
+				break
+			}
+			id = string(body[pos : pos+4])
+			if major == 4 {
+				frameSize = syncsafe(body[pos+4 : pos+8])
+			} else {
+				frameSize = int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+			}
+			copy(frameFlags[:], body[pos+8:pos+10])
+			pos += 10
+		}
+		if id[0] == 0 || frameSize < 0 || pos+frameSize > len(body) {
+			// начались padding-байты или тег поврежден
+			break
+		}
+		data := body[pos : pos+frameSize]
+		pos += frameSize
+
+		switch major {
+		case 2:
+			if mapped, ok := id3v22Frames[id]; ok {
+				id = mapped
+			}
+		case 3:
+			if frameFlags[1]&0xC0 != 0 {
+				continue
+			}
+			if frameFlags[1]&0x20 != 0 && len(data) > 0 {
+				data = data[1:]
+			}
+		case 4:
+			if frameFlags[1]&0x0C != 0 {
+				continue
+			}
+			if frameFlags[1]&0x40 != 0 && len(data) > 0 {
+				data = data[1:]
+			}
+			if frameFlags[1]&0x01 != 0 && len(data) >= 4 {
+				data = data[4:]
+			}
+			if frameFlags[1]&0x02 != 0 || flags&0x80 != 0 {
+				data = unsync(data)
+			}
+		}
+		frames = append(frames, id3v2Frame{id: id, data: data})
+	}
+	return frames
+}
+
+func parseID3v2(head, body []byte) Tags {
+	var t Tags
+	for _, frame := range id3v2Frames(head, body) {
+		if frame.id == "APIC" || frame.id == "PIC" {
+			if picture := parseAPIC(frame.data, frame.id == "PIC"); picture.better(t.Picture) {
+				t.Picture = picture
+			}
+			continue
+		}
+		if !strings.HasPrefix(frame.id, "T") || len(frame.data) == 0 {
+			continue
+		}
+		value := decodeText(frame.data[0], frame.data[1:])
+		switch frame.id {
+		case "TIT2":
+			t.Title = value
+		case "TPE1":
+			t.Artist = value
+		case "TALB":
+			t.Album = value
+		case "TPE2":
+			t.AlbumArtist = value
+		case "TRCK":
+			t.Track = parseNumber(value)
+		case "TPOS":
+			t.Disc = parseNumber(value)
+		case "TYER", "TDRC", "TDOR":
+			if t.Year == 0 {
+				t.Year = parseYear(value)
+			}
+		case "TCON":
+			t.Genre = parseGenre(value)
+		}
+	}
+	return t
+}
+
+// decodeText декодирует текст кадра ID3v2 и возвращает первое из значений, разделенных нулем
+func decodeText(encoding byte, b []byte) string {
+	var s string
+	switch encoding {
+	case 0:
+		s = latin1(b)
+	case 1, 2:
+		s = decodeUTF16(b, encoding == 2)
+	default:
+		s = string(b)
+	}
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	if len(b) >= 2 {
+		switch {
+		case b[0] == 0xFE && b[1] == 0xFF:
+			bigEndian, b = true, b[2:]
+		case b[0] == 0xFF && b[1] == 0xFE:
+			bigEndian, b = false, b[2:]
+		}
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		if bigEndian {
+			u = append(u, binary.BigEndian.Uint16(b[i:]))
+		} else {
+			u = append(u, binary.LittleEndian.Uint16(b[i:]))
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func parseID3v1(b []byte) Tags {
+	field := func(f []byte) string {
+		if i := bytes.IndexByte(f, 0); i >= 0 {
+			f = f[:i]
+		}
+		return strings.TrimSpace(latin1(f))
+	}
+
+	t := Tags{
+		Title:  field(b[3:33]),
+		Artist: field(b[33:63]),
+		Album:  field(b[63:93]),
+		Year:   parseYear(field(b[93:97])),
+	}
+	// ID3v1.1 хранит номер трека в последнем байте комментария
+	if b[125] == 0 && b[126] != 0 {
+		t.Track = int(b[126])
+	}
+	if int(b[127]) < len(genres) {
+		t.Genre = genres[b[127]]
+	}
+	return t
+}
@@ -0,0 +1,138 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+var mp3Bitrates = [2][3][16]int{
+	// MPEG1: Layer I, II, III
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	// MPEG2/2.5: Layer I, II, III
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var mp3SampleRates = map[byte][3]int{
+	3: {44100, 48000, 32000}, // MPEG1
+	2: {22050, 24000, 16000}, // MPEG2
+	0: {11025, 12000, 8000},  // MPEG2.5
+}
+
+type mp3Frame struct {
+	version    byte // 3 — MPEG1, 2 — MPEG2, 0 — MPEG2.5
+	layer      int  // 1, 2 или 3
+	bitrate    int  // кбит/с
+	sampleRate int
+	mono       bool
+	length     int
+}
+
+func (f mp3Frame) samples() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && f.version != 3:
+		return 576
+	}
+	return 1152
+}
+
+func parseMP3Frame(b []byte) (mp3Frame, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+	version := (b[1] >> 3) & 3
+	layerBits := (b[1] >> 1) & 3
+	bitrateIdx := b[2] >> 4
+	rateIdx := (b[2] >> 2) & 3
+	if version == 1 || layerBits == 0 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return mp3Frame{}, false
+	}
+
+	f := mp3Frame{
+		version:    version,
+		layer:      4 - int(layerBits),
+		sampleRate: mp3SampleRates[version][rateIdx],
+		mono:       b[3]>>6 == 3,
+	}
+	table := 0
+	if version != 3 {
+		table = 1
+	}
+	f.bitrate = mp3Bitrates[table][f.layer-1][bitrateIdx]
+	padding := int(b[2]>>1) & 1
+	if f.layer == 1 {
+		f.length = (12*f.bitrate*1000/f.sampleRate + padding) * 4
+	} else {
+		f.length = f.samples()/8*f.bitrate*1000/f.sampleRate + padding
+	}
+	return f, true
+}
+
+// mp3Duration ищет первый кадр MPEG и берет длительность из заголовка Xing/Info/VBRI,
+// а если его нет — оценивает ее по битрейту первого кадра
+func mp3Duration(r io.ReadSeeker, start, end int64) (time.Duration, error) {
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 64<<10)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, err
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		f, ok := parseMP3Frame(buf[i:])
+		if !ok {
+			continue
+		}
+		// Проверяем, что следующий кадр тоже начинается с синхрослова, чтобы не принять мусор за кадр
+		if next := i + f.length; next+4 <= len(buf) {
+			if _, ok := parseMP3Frame(buf[next:]); !ok {
+				continue
+			}
+		}
+
+		if frames := vbrFrames(buf[i:], f); frames > 0 {
+			return seconds(float64(frames) * float64(f.samples()) / float64(f.sampleRate)), nil
+		}
+		audio := end - start - int64(i)
+		return seconds(float64(audio*8) / float64(f.bitrate*1000)), nil
+	}
+	return 0, nil
+}
+
+// vbrFrames возвращает число кадров из заголовка Xing/Info или VBRI, либо 0
+func vbrFrames(b []byte, f mp3Frame) int64 {
+	side := 32
+	switch {
+	case f.version == 3 && f.mono:
+		side = 17
+	case f.version != 3 && !f.mono:
+		side = 17
+	case f.version != 3 && f.mono:
+		side = 9
+	}
+	if off := 4 + side; off+12 <= len(b) {
+		if id := b[off : off+4]; bytes.Equal(id, []byte("Xing")) || bytes.Equal(id, []byte("Info")) {
+			if binary.BigEndian.Uint32(b[off+4:])&1 != 0 {
+				return int64(binary.BigEndian.Uint32(b[off+8:]))
+			}
+		}
+	}
+	if off := 36; off+18 <= len(b) && bytes.Equal(b[off:off+4], []byte("VBRI")) {
+		return int64(binary.BigEndian.Uint32(b[off+14:]))
+	}
+	return 0
+}
@@ -0,0 +1,143 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const maxOggHeaderPacket = 16 << 20
+
+type oggPage struct {
+	granule int64
+	serial  uint32
+	lacing  []byte
+	body    []byte
+}
+
+func readOggPage(r io.Reader) (oggPage, error) {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return oggPage{}, err
+	}
+	if !bytes.Equal(header[:4], []byte("OggS")) {
+		return oggPage{}, errors.New("tag: bad ogg page")
+	}
+	page := oggPage{
+		granule: int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:  binary.LittleEndian.Uint32(header[14:18]),
+		lacing:  make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.lacing); err != nil {
+		return oggPage{}, err
+	}
+	size := 0
+	for _, l := range page.lacing {
+		size += int(l)
+	}
+	page.body = make([]byte, size)
+	if _, err := io.ReadFull(r, page.body); err != nil {
+		return oggPage{}, err
+	}
+	return page, nil
+}
+
+// oggPackets собирает первые n пакетов первого логического потока
+func oggPackets(r io.Reader, n int) ([][]byte, uint32, error) {
+	var packets [][]byte
+	var current []byte
+	var serial uint32
+	for first := true; len(packets) < n; first = false {
+		page, err := readOggPage(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		if first {
+			serial = page.serial
+		} else if page.serial != serial {
+			continue
+		}
+		pos := 0
+		for _, l := range page.lacing {
+			current = append(current, page.body[pos:pos+int(l)]...)
+			pos += int(l)
+			if len(current) > maxOggHeaderPacket {
+				return nil, 0, errors.New("tag: ogg header packet too large")
+			}
+			if l < 255 {
+				packets = append(packets, current)
+				current = nil
+				if len(packets) == n {
+					break
+				}
+			}
+		}
+	}
+	return packets, serial, nil
+}
+
+func readOgg(r io.ReadSeeker, size int64) (Tags, error) {
+	packets, serial, err := oggPackets(r, 2)
+	if err != nil {
+		return Tags{}, err
+	}
+	id, comment := packets[0], packets[1]
+
+	var t Tags
+	var sampleRate, preSkip int64
+	switch {
+	case len(id) >= 16 && bytes.HasPrefix(id, []byte("\x01vorbis")):
+		sampleRate = int64(binary.LittleEndian.Uint32(id[12:16]))
+		if bytes.HasPrefix(comment, []byte("\x03vorbis")) {
+			t = parseVorbisComment(comment[7:])
+		}
+	case len(id) >= 12 && bytes.HasPrefix(id, []byte("OpusHead")):
+		// Гранулы Opus всегда считаются в 48 кГц
+		sampleRate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(id[10:12]))
+		if bytes.HasPrefix(comment, []byte("OpusTags")) {
+			t = parseVorbisComment(comment[8:])
+		}
+	default:
+		return Tags{}, ErrUnknownFormat
+	}
+
+	granule, err := lastOggGranule(r, size, serial)
+	if err != nil {
+		return Tags{}, err
+	}
+	if sampleRate > 0 && granule > preSkip {
+		t.Duration = seconds(float64(granule-preSkip) / float64(sampleRate))
+	}
+	return t, nil
+}
+
+// lastOggGranule находит позицию гранулы последней страницы потока в хвосте файла
+func lastOggGranule(r io.ReadSeeker, size int64, serial uint32) (int64, error) {
+	start := size - 64<<10
+	if start < 0 {
+		start = 0
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	tail := make([]byte, size-start)
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return 0, err
+	}
+
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if i+27 > len(tail) {
+			continue
+		}
+		if binary.LittleEndian.Uint32(tail[i+14:]) != serial {
+			continue
+		}
+		granule := int64(binary.LittleEndian.Uint64(tail[i+6:]))
+		if granule >= 0 {
+			return granule, nil
+		}
+	}
+	return 0, nil
+}
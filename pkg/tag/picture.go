@@ -0,0 +1,141 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+)
+
+// Тип изображения APIC/PICTURE для лицевой стороны обложки
+const pictureFrontCover = 3
+
+// Picture — встроенное в файл изображение
+type Picture struct {
+	MimeType string
+	Type     byte
+	Data     []byte
+}
+
+// better сообщает, стоит ли предпочесть p уже найденному изображению cur: лицевая обложка важнее прочих
+func (p *Picture) better(cur *Picture) bool {
+	if p == nil || len(p.Data) == 0 {
+		return false
+	}
+	return cur == nil || cur.Type != pictureFrontCover && p.Type == pictureFrontCover
+}
+
+// parseAPIC разбирает кадр APIC (ID3v2.3/2.4) или PIC (ID3v2.2)
+func parseAPIC(data []byte, v22 bool) *Picture {
+	if len(data) < 2 {
+		return nil
+	}
+	encoding, data := data[0], data[1:]
+
+	var mimeType string
+	if v22 {
+		if len(data) < 3 {
+			return nil
+		}
+		switch strings.ToUpper(string(data[:3])) {
+		case "JPG":
+			mimeType = "image/jpeg"
+		case "PNG":
+			mimeType = "image/png"
+		}
+		data = data[3:]
+	} else {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return nil
+		}
+		mimeType = strings.ToLower(string(data[:end]))
+		data = data[end+1:]
+	}
+	if len(data) < 1 {
+		return nil
+	}
+	pictureType, data := data[0], data[1:]
+
+	// Описание заканчивается нулем, в UTF-16 — двумя нулями на границе символа
+	if encoding == 1 || encoding == 2 {
+		end := -1
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				end = i + 2
+				break
+			}
+		}
+		if end < 0 {
+			return nil
+		}
+		data = data[end:]
+	} else {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return nil
+		}
+		data = data[end+1:]
+	}
+	return &Picture{MimeType: pictureMimeType(mimeType, data), Type: pictureType, Data: data}
+}
+
+// parseFLACPicture разбирает блок PICTURE FLAC; в Vorbis comment он же хранится в base64
+// в поле METADATA_BLOCK_PICTURE
+func parseFLACPicture(b []byte) *Picture {
+	field := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.BigEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+		v := b[4 : 4+n]
+		b = b[4+n:]
+		return v, true
+	}
+
+	if len(b) < 4 {
+		return nil
+	}
+	pictureType := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	mimeType, ok := field()
+	if !ok {
+		return nil
+	}
+	if _, ok = field(); !ok { // описание
+		return nil
+	}
+	if len(b) < 16 { // ширина, высота, глубина цвета, размер палитры
+		return nil
+	}
+	b = b[16:]
+	data, ok := field()
+	if !ok {
+		return nil
+	}
+	return &Picture{MimeType: pictureMimeType(strings.ToLower(string(mimeType)), data), Type: byte(pictureType), Data: data}
+}
+
+func parseVorbisPicture(value string) *Picture {
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+	return parseFLACPicture(b)
+}
+
+// pictureMimeType доверяет сигнатуре больше, чем заявленному типу: теги часто пишут "image/jpg" или пустую строку
+func pictureMimeType(declared string, data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xFF\xD8\xFF")):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return "image/gif"
+	}
+	return declared
+}
@@ -0,0 +1,51 @@
+package tag
+
+import (
+	"bytes"
+)
+
+// SniffLen — сколько первых байт файла нужно передать в ContentType. Вмещает самый длинный
+// кадр MPEG (Layer II, 160 кбит/с, 8 кГц — 2881 байт) и заголовок следующего за ним кадра.
+const SniffLen = 4096
+
+// mp4AudioBrands — только чисто аудио бренды: под isom, mp42 и т.п. обычно лежит видео,
+// а moov для проверки дорожек может находиться в конце файла
+var mp4AudioBrands = [][]byte{
+	[]byte("M4A "), []byte("M4B "), []byte("M4P "), []byte("F4A "),
+}
+
+// ContentType определяет MIME-тип аудио по сигнатуре в начале файла.
+// Для не-аудио возвращает false.
+func ContentType(head []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return "audio/mpeg", true
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return "audio/flac", true
+	case bytes.HasPrefix(head, []byte("OggS")):
+		if bytes.Contains(head, []byte("OpusHead")) {
+			return "audio/ogg; codecs=opus", true
+		}
+		return "audio/ogg", true
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WAVE")):
+		return "audio/wav", true
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("FORM")) &&
+		(bytes.Equal(head[8:12], []byte("AIFF")) || bytes.Equal(head[8:12], []byte("AIFC"))):
+		return "audio/aiff", true
+	case len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")):
+		for _, brand := range mp4AudioBrands {
+			if bytes.Equal(head[8:12], brand) {
+				return "audio/mp4", true
+			}
+		}
+		return "", false
+	}
+	// MP3 без ID3: файл начинается сразу с кадра MPEG, за которым следует еще один кадр.
+	// Одного заголовка мало: четыре подходящих байта легко встретить в начале любого файла.
+	if f, ok := parseMP3Frame(head); ok && f.layer != 1 && f.length+4 <= len(head) {
+		if _, ok := parseMP3Frame(head[f.length:]); ok {
+			return "audio/mpeg", true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,165 @@
+package tag
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownFormat = errors.New("tag: unknown format")
+
+// Tags содержит метаданные, извлеченные из аудиофайла. Незаполненные поля остаются нулевыми.
+type Tags struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Genre       string
+	Track       int
+	Disc        int
+	Year        int
+	Duration    time.Duration
+	// Picture — обложка, встроенная в файл: лицевая, если их несколько
+	Picture *Picture
+}
+
+// Read определяет формат по первым байтам и читает теги ID3v2/ID3v1 (MP3),
+// FLAC или Vorbis comment (Ogg Vorbis/Opus). Позиция r после вызова не определена.
+func Read(r io.ReadSeeker) (Tags, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Tags{}, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return Tags{}, err
+	}
+
+	head := make([]byte, 4)
+	if _, err = io.ReadFull(r, head); err != nil {
+		return Tags{}, ErrUnknownFormat
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return Tags{}, err
+	}
+
+	switch {
+	case bytes.Equal(head, []byte("fLaC")):
+		return readFLAC(r)
+	case bytes.Equal(head, []byte("OggS")):
+		return readOgg(r, size)
+	case bytes.Equal(head[:3], []byte("ID3")), head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		return readMP3(r, size)
+	}
+	return Tags{}, ErrUnknownFormat
+}
+
+// merge заполняет пустые поля t значениями из other
+func (t *Tags) merge(other Tags) {
+	if t.Title == "" {
+		t.Title = other.Title
+	}
+	if t.Artist == "" {
+		t.Artist = other.Artist
+	}
+	if t.Album == "" {
+		t.Album = other.Album
+	}
+	if t.AlbumArtist == "" {
+		t.AlbumArtist = other.AlbumArtist
+	}
+	if t.Genre == "" {
+		t.Genre = other.Genre
+	}
+	if t.Track == 0 {
+		t.Track = other.Track
+	}
+	if t.Disc == 0 {
+		t.Disc = other.Disc
+	}
+	if t.Year == 0 {
+		t.Year = other.Year
+	}
+	if t.Duration == 0 {
+		t.Duration = other.Duration
+	}
+	if t.Picture == nil {
+		t.Picture = other.Picture
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// parseNumber разбирает значения вида "3" и "3/12"
+func parseNumber(s string) int {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseYear берет год из дат вида "2001" и "2001-05-03"
+func parseYear(s string) int {
+	s = strings.TrimSpace(s)
+	if len(s) < 4 {
+		return 0
+	}
+	n, err := strconv.Atoi(s[:4])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseGenre раскрывает числовые жанры ID3 вида "17", "(17)" и "(17)Rock"
+func parseGenre(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "(") {
+		end := strings.IndexByte(s, ')')
+		if end > 0 {
+			if rest := strings.TrimSpace(s[end+1:]); rest != "" {
+				return rest
+			}
+			s = s[1:end]
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n >= 0 && n < len(genres) {
+			return genres[n]
+		}
+		return ""
+	}
+	return s
+}
+
+// genres — стандартный список жанров ID3v1 с расширениями Winamp
+var genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap",
+	"Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska", "Death Metal", "Pranks",
+	"Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance",
+	"Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi",
+	"Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebob", "Latin", "Revival",
+	"Celtic", "Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock", "Slow Rock",
+	"Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour", "Speech", "Chanson", "Opera",
+	"Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam",
+	"Club", "Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle",
+	"Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House", "Dance Hall", "Goa", "Drum & Bass",
+	"Club-House", "Hardcore", "Terror", "Indie", "BritPop", "Negerpunk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover", "Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "JPop", "Synthpop",
+}
@@ -0,0 +1,298 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func id3Frame(id string, text []byte) []byte {
+	b := []byte(id)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(text)))
+	b = append(b, 0, 0)
+	return append(b, text...)
+}
+
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+// mp3Frames возвращает n кадров MPEG1 Layer III 128 кбит/с 44.1 кГц без полезных данных
+func mp3Frames(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	return bytes.Repeat(frame, n)
+}
+
+// mpegFrames возвращает n кадров длиной length с заголовком header
+func mpegFrames(header []byte, length, n int) []byte {
+	frame := make([]byte, length)
+	copy(frame, header)
+	return bytes.Repeat(frame, n)
+}
+
+func TestID3v2(t *testing.T) {
+	var frames []byte
+	frames = append(frames, id3Frame("TIT2", append([]byte{0}, "Song"...))...)
+	// UTF-16 с BOM
+	frames = append(frames, id3Frame("TPE1", []byte{1, 0xFF, 0xFE, 'A', 0, 'r', 0, 't', 0})...)
+	frames = append(frames, id3Frame("TALB", append([]byte{3}, "Альбом"...))...)
+	frames = append(frames, id3Frame("TPE2", append([]byte{0}, "Various"...))...)
+	frames = append(frames, id3Frame("TRCK", append([]byte{0}, "3/12"...))...)
+	frames = append(frames, id3Frame("TPOS", append([]byte{0}, "2"...))...)
+	frames = append(frames, id3Frame("TYER", append([]byte{0}, "2001"...))...)
+	frames = append(frames, id3Frame("TCON", append([]byte{0}, "(17)"...))...)
+	frames = append(frames, make([]byte, 32)...) // padding
+
+	file := append([]byte("ID3\x03\x00\x00"), syncsafeBytes(len(frames))...)
+	file = append(file, frames...)
+	file = append(file, mp3Frames(100)...)
+
+	tags, err := Read(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Tags{
+		Title:       "Song",
+		Artist:      "Art",
+		Album:       "Альбом",
+		AlbumArtist: "Various",
+		Genre:       "Rock",
+		Track:       3,
+		Disc:        2,
+		Year:        2001,
+	}
+	duration := tags.Duration
+	tags.Duration = 0
+	if tags != want {
+		t.Fatalf("получено %+v, ожидалось %+v", tags, want)
+	}
+	// 100 кадров по 417 байт при 128 кбит/с
+	if duration < 2600*time.Millisecond || duration > 2610*time.Millisecond {
+		t.Fatalf("длительность %v", duration)
+	}
+}
+
+func TestID3v2Size(t *testing.T) {
+	// Заголовок обещает тег почти в 256 МиБ, а файл намного меньше
+	file := append([]byte("ID3\x03\x00\x00"), syncsafeBytes(1<<28-1)...)
+	file = append(file, mp3Frames(10)...)
+	if _, err := Read(bytes.NewReader(file)); err == nil {
+		t.Fatal("тег длиннее файла принят")
+	}
+
+	// Слишком большой тег пропускается без разбора, длительность все равно считается
+	frames := id3Frame("TIT2", append([]byte{0}, "Song"...))
+	frames = append(frames, make([]byte, maxID3Body)...)
+	file = append([]byte("ID3\x03\x00\x00"), syncsafeBytes(len(frames))...)
+	file = append(file, frames...)
+	file = append(file, mp3Frames(100)...)
+	tags, err := Read(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title != "" {
+		t.Fatalf("тег больше maxID3Body разобран: %+v", tags)
+	}
+	if tags.Duration < 2600*time.Millisecond || tags.Duration > 2610*time.Millisecond {
+		t.Fatalf("длительность %v", tags.Duration)
+	}
+}
+
+func TestID3v1(t *testing.T) {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:], "Title")
+	copy(tag[33:], "Artist")
+	copy(tag[63:], "Album")
+	copy(tag[93:], "1999")
+	tag[126] = 7
+	tag[127] = 8
+
+	file := append(mp3Frames(10), tag...)
+	tags, err := Read(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title != "Title" || tags.Artist != "Artist" || tags.Album != "Album" ||
+		tags.Year != 1999 || tags.Track != 7 || tags.Genre != "Jazz" {
+		t.Fatalf("неверные теги: %+v", tags)
+	}
+}
+
+func vorbisComment(comments ...string) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, 6)
+	b = append(b, "vendor"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(comments)))
+	for _, c := range comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c)))
+		b = append(b, c...)
+	}
+	return b
+}
+
+func TestFLAC(t *testing.T) {
+	streamInfo := make([]byte, 34)
+	// 44100 Гц, 2 канала, 16 бит, 441000 сэмплов
+	v := uint64(44100)<<44 | uint64(1)<<41 | uint64(15)<<36 | 441000
+	binary.BigEndian.PutUint64(streamInfo[10:], v)
+	comment := vorbisComment("TITLE=Flac Song", "artist=Flac Artist", "ALBUM=Flac Album", "TRACKNUMBER=5", "DATE=2010-01-01", "GENRE=Ambient")
+
+	file := []byte("fLaC")
+	file = append(file, 0, 0, 0, 34)
+	file = append(file, streamInfo...)
+	file = append(file, 0x80|4, byte(len(comment)>>16), byte(len(comment)>>8), byte(len(comment)))
+	file = append(file, comment...)
+
+	tags, err := Read(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title != "Flac Song" || tags.Artist != "Flac Artist" || tags.Album != "Flac Album" ||
+		tags.Track != 5 || tags.Year != 2010 || tags.Genre != "Ambient" {
+		t.Fatalf("неверные теги: %+v", tags)
+	}
+	if tags.Duration != 10*time.Second {
+		t.Fatalf("длительность %v", tags.Duration)
+	}
+}
+
+func oggPageBytes(granule int64, packet []byte) []byte {
+	b := []byte("OggS\x00\x00")
+	b = binary.LittleEndian.AppendUint64(b, uint64(granule))
+	b = binary.LittleEndian.AppendUint32(b, 1)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	var lacing []byte
+	n := len(packet)
+	for ; n >= 255; n -= 255 {
+		lacing = append(lacing, 255)
+	}
+	lacing = append(lacing, byte(n))
+	b = append(b, byte(len(lacing)))
+	b = append(b, lacing...)
+	return append(b, packet...)
+}
+
+func TestOggVorbis(t *testing.T) {
+	id := []byte("\x01vorbis")
+	id = append(id, 0, 0, 0, 0, 2)
+	id = binary.LittleEndian.AppendUint32(id, 44100)
+	id = append(id, make([]byte, 14)...)
+	// Длинный комментарий занимает несколько сегментов
+	comment := append([]byte("\x03vorbis"), vorbisComment("TITLE=Ogg Song", "ALBUMARTIST=Band", "DISCNUMBER=1/2", "COMMENT="+string(bytes.Repeat([]byte("x"), 600)))...)
+	comment = append(comment, 1)
+
+	var file []byte
+	file = append(file, oggPageBytes(0, id)...)
+	file = append(file, oggPageBytes(0, comment)...)
+	file = append(file, oggPageBytes(88200, []byte("audio"))...)
+
+	tags, err := Read(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title != "Ogg Song" || tags.AlbumArtist != "Band" || tags.Disc != 1 {
+		t.Fatalf("неверные теги: %+v", tags)
+	}
+	if tags.Duration != 2*time.Second {
+		t.Fatalf("длительность %v", tags.Duration)
+	}
+}
+
+func flacPictureBlock(pictureType uint32, mimeType string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, pictureType)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(mimeType)))
+	b = append(b, mimeType...)
+	b = binary.BigEndian.AppendUint32(b, 4)
+	b = append(b, "desc"...)
+	b = append(b, make([]byte, 16)...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+func TestPictures(t *testing.T) {
+	jpeg := []byte("\xFF\xD8\xFF\xE0jpeg data")
+	png := []byte("\x89PNG\r\n\x1a\npng data")
+
+	// Задняя обложка идет первой, но выбрана должна быть лицевая; описание в UTF-16
+	var frames []byte
+	frames = append(frames, id3Frame("APIC", append([]byte("\x00image/png\x00\x04back\x00"), png...))...)
+	frames = append(frames, id3Frame("APIC", append([]byte("\x01image/jpg\x00\x03\xFF\xFEf\x00\x00\x00"), jpeg...))...)
+	file := append([]byte("ID3\x03\x00\x00"), syncsafeBytes(len(frames))...)
+	file = append(file, frames...)
+	file = append(file, mp3Frames(10)...)
+
+	tags, err := Read(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Picture == nil || tags.Picture.MimeType != "image/jpeg" || !bytes.Equal(tags.Picture.Data, jpeg) {
+		t.Fatalf("неверная обложка MP3: %+v", tags.Picture)
+	}
+
+	block := flacPictureBlock(3, "image/png", png)
+	file = []byte("fLaC")
+	file = append(file, 0, 0, 0, 34)
+	file = append(file, make([]byte, 34)...)
+	file = append(file, 0x80|6, byte(len(block)>>16), byte(len(block)>>8), byte(len(block)))
+	file = append(file, block...)
+
+	tags, err = Read(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Picture == nil || tags.Picture.MimeType != "image/png" || !bytes.Equal(tags.Picture.Data, png) {
+		t.Fatalf("неверная обложка FLAC: %+v", tags.Picture)
+	}
+
+	comment := vorbisComment("METADATA_BLOCK_PICTURE=" + base64.StdEncoding.EncodeToString(flacPictureBlock(3, "", jpeg)))
+	if picture := parseVorbisComment(comment).Picture; picture == nil || picture.MimeType != "image/jpeg" {
+		t.Fatalf("неверная обложка Vorbis comment: %+v", picture)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte("not an audio file"))); err != ErrUnknownFormat {
+		t.Fatalf("ожидалась ErrUnknownFormat, получено %v", err)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"id3", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "audio/mpeg"},
+		{"mp3 frames", mp3Frames(2), "audio/mpeg"},
+		// 320 кбит/с, 44.1 кГц: кадр 1044 байта
+		{"mp3 320 kbps", mpegFrames([]byte{0xFF, 0xFB, 0xE0, 0x00}, 1044, 2), "audio/mpeg"},
+		// MPEG 2.5 Layer II, 160 кбит/с, 8 кГц: самый длинный кадр, 2881 байт с padding
+		{"mp3 longest frame", mpegFrames([]byte{0xFF, 0xE5, 0xEA, 0x00}, 2881, 2), "audio/mpeg"},
+		{"mp3 single header", mpegFrames([]byte{0xFF, 0xFB, 0xE0, 0x00}, 1044, 1), ""},
+		{"mp3 header and garbage", append(mp3Frames(1), bytes.Repeat([]byte("x"), 1000)...), ""},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), "audio/flac"},
+		{"vorbis", oggPageBytes(0, []byte("\x01vorbis")), "audio/ogg"},
+		{"opus", oggPageBytes(0, []byte("OpusHead")), "audio/ogg; codecs=opus"},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "audio/wav"},
+		{"aiff", []byte("FORM\x00\x00\x00\x00AIFFCOMM"), "audio/aiff"},
+		{"m4a", []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00"), "audio/mp4"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), ""},
+		{"text", []byte("hello, world"), ""},
+		{"mp4 video", []byte("\x00\x00\x00\x20ftypqt  \x00\x00\x00\x00"), ""},
+		{"isom video", []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), ""},
+	}
+	for _, tt := range tests {
+		head := tt.head
+		if len(head) > SniffLen {
+			head = head[:SniffLen]
+		}
+		got, ok := ContentType(head)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: получено %q, %v; ожидалось %q", tt.name, got, ok, tt.want)
+		}
+	}
+}
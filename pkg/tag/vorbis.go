@@ -0,0 +1,66 @@
+package tag
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// parseVorbisComment разбирает блок Vorbis comment, общий для FLAC, Ogg Vorbis и Opus
+func parseVorbisComment(b []byte) Tags {
+	var t Tags
+	if len(b) < 4 {
+		return t
+	}
+	vendor := int(binary.LittleEndian.Uint32(b))
+	pos := 4 + vendor
+	if pos+4 > len(b) {
+		return t
+	}
+	count := int(binary.LittleEndian.Uint32(b[pos:]))
+	pos += 4
+
+	for i := 0; i < count && pos+4 <= len(b); i++ {
+		length := int(binary.LittleEndian.Uint32(b[pos:]))
+		pos += 4
+		if length < 0 || pos+length > len(b) {
+			break
+		}
+		comment := string(b[pos : pos+length])
+		pos += length
+
+		key, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			t.Title = value
+		case "ARTIST":
+			if t.Artist == "" {
+				t.Artist = value
+			}
+		case "ALBUM":
+			t.Album = value
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			t.AlbumArtist = value
+		case "TRACKNUMBER":
+			t.Track = parseNumber(value)
+		case "DISCNUMBER":
+			t.Disc = parseNumber(value)
+		case "DATE", "YEAR":
+			if t.Year == 0 {
+				t.Year = parseYear(value)
+			}
+		case "GENRE":
+			if t.Genre == "" {
+				t.Genre = value
+			}
+		case "METADATA_BLOCK_PICTURE":
+			if picture := parseVorbisPicture(value); picture.better(t.Picture) {
+				t.Picture = picture
+			}
+		}
+	}
+	return t
+}
@@ -0,0 +1,120 @@
+// Package thumbnail уменьшает обложки без внешних зависимостей: декодирует JPEG, PNG и GIF
+// стандартной библиотекой и масштабирует усреднением по площади.
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Quality — качество JPEG для миниатюр
+const Quality = 85
+
+// MaxPixels ограничивает размер декодируемого изображения, чтобы заголовок с огромными
+// размерами не заставил выделить гигабайты памяти
+const MaxPixels = 50_000_000
+
+// Decode читает изображение JPEG, PNG или GIF и возвращает его вместе с названием формата
+func Decode(data []byte) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, "", image.ErrFormat
+	}
+	return image.Decode(bytes.NewReader(data))
+}
+
+// Fit уменьшает изображение так, чтобы большая сторона не превышала size, сохраняя пропорции.
+// Прозрачные области заливаются белым, так как миниатюры сохраняются в JPEG.
+// Изображения меньше size не увеличиваются.
+func Fit(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	switch {
+	case w >= h && w > size:
+		dw, dh = size, max(1, (h*size+w/2)/w)
+	case h > w && h > size:
+		dw, dh = max(1, (w*size+h/2)/h), size
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Over)
+	if dw == w && dh == h {
+		return rgba
+	}
+	return scale(scale(rgba, dw, true), dh, false)
+}
+
+// Encode сохраняет изображение в JPEG
+func Encode(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: Quality})
+}
+
+// span — отрезок исходных пикселей, покрывающий один пиксель результата, с долями каждого
+type span struct {
+	start   int
+	weights []float64
+}
+
+// spans делит srcLen пикселей на dstLen равных отрезков; крайние пиксели отрезка входят частично
+func spans(srcLen, dstLen int) []span {
+	ratio := float64(srcLen) / float64(dstLen)
+	result := make([]span, dstLen)
+	for i := range result {
+		from, to := float64(i)*ratio, float64(i+1)*ratio
+		start := int(from)
+		sp := span{start: start}
+		for s := start; float64(s) < to && s < srcLen; s++ {
+			w := min(to, float64(s+1)) - max(from, float64(s))
+			sp.weights = append(sp.weights, w/ratio)
+		}
+		result[i] = sp
+	}
+	return result
+}
+
+// scale меняет ширину (horizontal) или высоту изображения до n пикселей
+func scale(src *image.RGBA, n int, horizontal bool) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	srcLen, lines := w, h
+	dst := image.NewRGBA(image.Rect(0, 0, n, h))
+	if !horizontal {
+		srcLen, lines = h, w
+		dst = image.NewRGBA(image.Rect(0, 0, w, n))
+	}
+	// offset возвращает индекс пикселя pos на линии line в Pix
+	offset := func(img *image.RGBA, line, pos int) int {
+		if horizontal {
+			return line*img.Stride + pos*4
+		}
+		return pos*img.Stride + line*4
+	}
+
+	sps := spans(srcLen, n)
+	for line := 0; line < lines; line++ {
+		for i, sp := range sps {
+			var acc [4]float64
+			for k, weight := range sp.weights {
+				p := offset(src, line, sp.start+k)
+				for c := range acc {
+					acc[c] += float64(src.Pix[p+c]) * weight
+				}
+			}
+			p := offset(dst, line, i)
+			for c, v := range acc {
+				dst.Pix[p+c] = uint8(min(255, v+0.5))
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,73 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	// Черно-белые вертикальные полосы шириной в пиксель при уменьшении сливаются в серый
+	src := image.NewGray(image.Rect(0, 0, 400, 200))
+	for x := 0; x < 400; x += 2 {
+		for y := 0; y < 200; y++ {
+			src.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	thumb := Fit(src, 100)
+	if bounds := thumb.Bounds(); bounds != image.Rect(0, 0, 100, 50) {
+		t.Fatalf("размер %v", bounds)
+	}
+	r, g, b, a := thumb.At(37, 21).RGBA()
+	if r>>8 < 127 || r>>8 > 129 || g != r || b != r || a != 0xFFFF {
+		t.Fatalf("цвет %d %d %d %d, ожидался серый", r>>8, g>>8, b>>8, a>>8)
+	}
+
+	// Маленькое изображение не увеличивается, неровное деление не теряет пиксели по краям
+	if bounds := Fit(image.NewGray(image.Rect(0, 0, 30, 60)), 100).Bounds(); bounds != image.Rect(0, 0, 30, 60) {
+		t.Errorf("маленькое изображение: размер %v", bounds)
+	}
+	if bounds := Fit(image.NewGray(image.Rect(0, 0, 300, 448)), 64).Bounds(); bounds != image.Rect(0, 0, 43, 64) {
+		t.Errorf("неровное деление: размер %v", bounds)
+	}
+}
+
+func TestTransparentBecomesWhite(t *testing.T) {
+	thumb := Fit(image.NewNRGBA(image.Rect(0, 0, 10, 10)), 5)
+	if c := thumb.RGBAAt(2, 2); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Fatalf("цвет %v, ожидался белый", c)
+	}
+}
+
+func TestDecodeEncode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 4))); err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" {
+		t.Fatalf("формат %s", format)
+	}
+
+	buf.Reset()
+	if err = Encode(&buf, Fit(img, 4)); err != nil {
+		t.Fatal(err)
+	}
+	img, format, err = Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || img.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("формат %s, размер %v", format, img.Bounds())
+	}
+
+	if _, _, err = Decode([]byte("not an image")); err == nil {
+		t.Fatal("мусор декодирован как изображение")
+	}
+}
@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Векторы RFC 6238, приложение B, для SHA-1; там 8 цифр, здесь берутся последние 6
+func TestCodeRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		got, err := Code(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("T=%d: код %s, ожидался %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	current, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if step, ok := Validate(secret, current, now); !ok || step != Step(now) {
+		t.Fatalf("текущий код: шаг %d, %v", step, ok)
+	}
+
+	// Расхождение часов на один шаг допускается, на два — нет
+	if step, ok := Validate(secret, current, now.Add(Period)); !ok || step != Step(now) {
+		t.Fatalf("код предыдущего шага: шаг %d, %v", step, ok)
+	}
+	if _, ok := Validate(secret, current, now.Add(2*Period)); ok {
+		t.Fatal("принят код двух шагов назад")
+	}
+
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Fatal("принят код из 5 цифр")
+	}
+	if _, ok := Validate("not base32!", current, now); ok {
+		t.Fatal("принят неверный секрет")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("aumusic", "alice smith", "JBSWY3DPEHPK3PXP")
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/aumusic:alice smith" {
+		t.Fatalf("адрес %s", uri)
+	}
+	query := u.Query()
+	if query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("issuer") != "aumusic" || query.Get("digits") != "6" {
+		t.Fatalf("параметры %s", u.RawQuery)
+	}
+}
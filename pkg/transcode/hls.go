@@ -0,0 +1,76 @@
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	HLSMaster        = "master.m3u8"
+	HLSMediaPlaylist = "index.m3u8"
+	hlsSegmentTime   = 6
+)
+
+// HLSBitrates — варианты качества в мастер-плейлисте, кбит/с
+var HLSBitrates = []int{64, 128, 320}
+
+// HLS нарезает аудио на сегменты AAC/MPEG-TS для каждого битрейта и пишет в dir файлы
+// <битрейт>/index.m3u8, <битрейт>/seg_NNN.ts и общий master.m3u8.
+// open вызывается для каждого варианта, так как ffmpeg читает источник из stdin.
+func (t *Transcoder) HLS(ctx context.Context, open func() (io.ReadCloser, error), dir string) error {
+	for _, bitrate := range HLSBitrates {
+		variant := filepath.Join(dir, strconv.Itoa(bitrate))
+		if err := os.MkdirAll(variant, os.ModePerm); err != nil {
+			return err
+		}
+		if err := t.hlsVariant(ctx, open, variant, bitrate); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, HLSMaster), []byte(MasterPlaylist(HLSBitrates)), 0o644)
+}
+
+func (t *Transcoder) hlsVariant(ctx context.Context, open func() (io.ReadCloser, error), dir string, bitrate int) error {
+	src, err := open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-map", "0:a:0", "-vn",
+		"-c:a", "aac", "-b:a", strconv.Itoa(bitrate) + "k",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentTime),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "seg_%03d.ts"),
+		filepath.Join(dir, HLSMediaPlaylist),
+	}
+	return t.run(ctx, src, io.Discard, args)
+}
+
+// MasterPlaylist перечисляет варианты с относительными путями к медиа-плейлистам
+func MasterPlaylist(bitrates []int) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, bitrate := range bitrates {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"mp4a.40.2\"\n%d/%s\n", bitrate*1000, bitrate, HLSMediaPlaylist)
+	}
+	return b.String()
+}
+
+// HLSContentType возвращает MIME-тип файла HLS по расширению
+func HLSContentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,50 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ErrRetagFormat возвращается Retag для форматов, теги которых ffmpeg не умеет перезаписывать
+var ErrRetagFormat = errors.New("transcode: tags cannot be written to this format")
+
+// retagMuxers сопоставляет MIME-типы, которые определяет tag.ContentType, мультиплексорам ffmpeg
+var retagMuxers = map[string]string{
+	"audio/mpeg":             "mp3",
+	"audio/flac":             "flac",
+	"audio/ogg":              "ogg",
+	"audio/ogg; codecs=opus": "ogg",
+	"audio/mp4":              "ipod",
+	"audio/aiff":             "aiff",
+}
+
+// CanRetag сообщает, поддерживает ли Retag файлы с этим MIME-типом
+func CanRetag(contentType string) bool {
+	_, ok := retagMuxers[contentType]
+	return ok
+}
+
+// Retag копирует файл in в out без перекодирования, заменяя теги из metadata. Ключи — имена тегов
+// ffmpeg (title, artist, album, album_artist, track, genre, date); остальные теги и обложка сохраняются.
+// Пути нужны вместо потоков, потому что мультиплексоры FLAC и MP4 дописывают заголовки в начало файла.
+func (t *Transcoder) Retag(ctx context.Context, in, out, contentType string, metadata map[string]string) error {
+	muxer, ok := retagMuxers[contentType]
+	if !ok {
+		return ErrRetagFormat
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-y", "-i", in, "-map", "0", "-c", "copy", "-map_metadata", "0"}
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		args = append(args, "-metadata", key+"="+strings.ReplaceAll(metadata[key], "\n", " "))
+	}
+	args = append(args, "-f", muxer, out)
+	return t.run(ctx, nil, io.Discard, args)
+}
@@ -0,0 +1,101 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const Original = "original"
+
+var ErrBadProfile = errors.New("transcode: unsupported quality or codec")
+
+type Config struct {
+	FFmpegPath string `yaml:"FFMPEG_PATH" env:"FFMPEG_PATH" env-default:"ffmpeg"`
+}
+
+type codec struct {
+	ext         string
+	contentType string
+	args        []string
+}
+
+var codecs = map[string]codec{
+	"mp3":  {ext: "mp3", contentType: "audio/mpeg", args: []string{"-c:a", "libmp3lame", "-f", "mp3"}},
+	"opus": {ext: "opus", contentType: "audio/ogg; codecs=opus", args: []string{"-c:a", "libopus", "-f", "ogg"}},
+	"aac":  {ext: "aac", contentType: "audio/aac", args: []string{"-c:a", "aac", "-f", "adts"}},
+}
+
+var bitrates = map[string]int{"320": 320, "128": 128, "64": 64}
+
+// Profile описывает целевой формат рендиции
+type Profile struct {
+	Codec   string
+	Bitrate int // кбит/с
+}
+
+// ParseProfile разбирает параметры quality и codec запроса. Пустой codec означает mp3.
+// Для quality "original" или пустой строки возвращает false: перекодировать не нужно.
+func ParseProfile(quality, codecName string) (Profile, bool, error) {
+	if quality == "" || quality == Original {
+		return Profile{}, false, nil
+	}
+	bitrate, ok := bitrates[quality]
+	if !ok {
+		return Profile{}, false, ErrBadProfile
+	}
+	if codecName == "" {
+		codecName = "mp3"
+	}
+	if _, ok := codecs[codecName]; !ok {
+		return Profile{}, false, ErrBadProfile
+	}
+	return Profile{Codec: codecName, Bitrate: bitrate}, true, nil
+}
+
+// Name используется как имя файла закешированной рендиции, например "128.mp3"
+func (p Profile) Name() string {
+	return strconv.Itoa(p.Bitrate) + "." + codecs[p.Codec].ext
+}
+
+func (p Profile) ContentType() string {
+	return codecs[p.Codec].contentType
+}
+
+// Args возвращает аргументы кодека и битрейта для ffmpeg
+func (p Profile) Args() []string {
+	return append([]string{"-b:a", strconv.Itoa(p.Bitrate) + "k"}, codecs[p.Codec].args...)
+}
+
+// Transcoder перекодирует аудио внешним ffmpeg через stdin/stdout
+type Transcoder struct {
+	ffmpeg string
+}
+
+func New(cfg Config) *Transcoder {
+	return &Transcoder{ffmpeg: cfg.FFmpegPath}
+}
+
+func (t *Transcoder) Transcode(ctx context.Context, in io.Reader, out io.Writer, p Profile) error {
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-map", "0:a:0", "-vn"}
+	args = append(args, p.Args()...)
+	args = append(args, "pipe:1")
+	return t.run(ctx, in, out, args)
+}
+
+func (t *Transcoder) run(ctx context.Context, in io.Reader, out io.Writer, args []string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.ffmpeg, args...)
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("transcode: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseProfile(t *testing.T) {
+	if _, ok, err := ParseProfile("original", "opus"); ok || err != nil {
+		t.Fatalf("original не должен перекодироваться: %v %v", ok, err)
+	}
+	p, ok, err := ParseProfile("128", "")
+	if !ok || err != nil {
+		t.Fatalf("неожиданный результат: %v %v", ok, err)
+	}
+	if p.Name() != "128.mp3" || p.ContentType() != "audio/mpeg" {
+		t.Fatalf("неверный профиль: %s %s", p.Name(), p.ContentType())
+	}
+	if _, _, err := ParseProfile("100", "mp3"); err != ErrBadProfile {
+		t.Fatalf("ожидалась ErrBadProfile, получено %v", err)
+	}
+	if _, _, err := ParseProfile("64", "wma"); err != ErrBadProfile {
+		t.Fatalf("ожидалась ErrBadProfile, получено %v", err)
+	}
+}
+
+// Вместо ffmpeg запускается скрипт, который пишет свои аргументы и копирует stdin в stdout
+func TestTranscodePipes(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\"\ncat\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _, _ := ParseProfile("64", "opus")
+	var out bytes.Buffer
+	err = New(Config{FFmpegPath: script}).Transcode(context.Background(), strings.NewReader("audio"), &out, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "-b:a 64k -c:a libopus -f ogg pipe:1") {
+		t.Fatalf("неверные аргументы: %q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "audio") {
+		t.Fatalf("stdin не передан: %q", out.String())
+	}
+}
+
+func TestTranscodeError(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho broken input >&2\nexit 1\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _, _ := ParseProfile("128", "mp3")
+	err = New(Config{FFmpegPath: script}).Transcode(context.Background(), strings.NewReader(""), &bytes.Buffer{}, p)
+	if err == nil || !strings.Contains(err.Error(), "broken input") {
+		t.Fatalf("ожидалась ошибка со stderr, получено %v", err)
+	}
+}
+
+func TestHLS(t *testing.T) {
+	// Скрипт копирует stdin в последний аргумент — путь медиа-плейлиста
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	err := os.WriteFile(script, []byte("#!/bin/sh\nfor last; do :; done\ncat > \"$last\"\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	open := func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("#EXTM3U\n")), nil }
+	if err := New(Config{FFmpegPath: script}).HLS(context.Background(), open, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	master, err := os.ReadFile(filepath.Join(dir, HLSMaster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bitrate := range HLSBitrates {
+		variant := strconv.Itoa(bitrate) + "/" + HLSMediaPlaylist
+		if !strings.Contains(string(master), variant) {
+			t.Fatalf("в мастер-плейлисте нет %s:\n%s", variant, master)
+		}
+		if _, err := os.Stat(filepath.Join(dir, variant)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRetag(t *testing.T) {
+	// Скрипт записывает свои аргументы в последний аргумент — путь выходного файла
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	err := os.WriteFile(script, []byte("#!/bin/sh\nfor last; do :; done\necho \"$@\" > \"$last\"\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	metadata := map[string]string{"title": "Time", "artist": "Pink Floyd", "track": "4"}
+	err = New(Config{FFmpegPath: script}).Retag(context.Background(), "in.flac", out, "audio/flac", metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ := os.ReadFile(out)
+	want := "-i in.flac -map 0 -c copy -map_metadata 0 -metadata artist=Pink Floyd -metadata title=Time -metadata track=4 -f flac " + out
+	if !strings.Contains(string(args), want) {
+		t.Fatalf("неверные аргументы: %q", args)
+	}
+
+	if err := New(Config{FFmpegPath: script}).Retag(context.Background(), "in.wav", out, "audio/wav", metadata); err != ErrRetagFormat {
+		t.Fatalf("ожидалась ErrRetagFormat, получено %v", err)
+	}
+}